@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"stash.appscode.dev/apimachinery/apis"
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
 	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
 	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
 	stashinformers "stash.appscode.dev/apimachinery/client/informers/externalversions"
@@ -90,12 +91,12 @@ func (c *BackupSessionController) RunBackup(targetInfo invoker.BackupTargetInfo,
 
 	// for Deployment and DeploymentConfig run BackupSession watcher only in leader pod.
 	// for others workload i.e. DaemonSet and StatefulSet run BackupSession watcher in all pods.
-	switch targetInfo.Target.Ref.Kind {
-	case apis.KindDeployment, apis.KindDeploymentConfig:
+	// the workloads registered through an adapter follow their host model.
+	if util.IsSingleHostWorkload(targetInfo.Target.Ref.APIVersion, targetInfo.Target.Ref.Kind) {
 		if err := c.electLeaderPod(targetInfo, invokerRef, stopCh); err != nil {
 			return err
 		}
-	default:
+	} else {
 		if err := c.runBackupSessionController(invokerRef, stopCh); err != nil {
 			return err
 		}
@@ -215,12 +216,10 @@ func (c *BackupSessionController) startBackupProcess(backupSession *api_v1beta1.
 	// For StatefulSet and DaemonSet all pods are running this controller and all will try to backup simultaneously. But, restic repository can be
 	// locked by only one pod. So, we need a leader election to determine who will take backup first. Once backup is complete, the leader pod will
 	// step down from leadership so that another replica can acquire leadership and start taking backup.
-	switch targetInfo.Target.Ref.Kind {
-	case apis.KindDeployment, apis.KindDeploymentConfig:
+	if util.IsSingleHostWorkload(targetInfo.Target.Ref.APIVersion, targetInfo.Target.Ref.Kind) {
 		return c.backupHost(inv, targetInfo, backupSession)
-	default:
-		return c.electBackupLeader(backupSession, inv, targetInfo)
 	}
+	return c.electBackupLeader(backupSession, inv, targetInfo)
 }
 
 func (c *BackupSessionController) backupHost(inv invoker.BackupInvoker, targetInfo invoker.BackupTargetInfo, backupSession *api_v1beta1.BackupSession) error {
@@ -241,7 +240,7 @@ func (c *BackupSessionController) backupHost(inv invoker.BackupInvoker, targetIn
 }
 
 func (c *BackupSessionController) backup(inv invoker.BackupInvoker, targetInfo invoker.BackupTargetInfo, backupSession *api_v1beta1.BackupSession) (*restic.BackupOutput, error) {
-	_, err := c.setSetupOptions(inv.GetRepoRef())
+	_, _, err := c.setSetupOptions(inv.GetRepoRef())
 	if err != nil {
 		return nil, err
 	}
@@ -273,17 +272,30 @@ func (c *BackupSessionController) backup(inv invoker.BackupInvoker, targetInfo i
 		return nil, nil
 	}
 
-	extraOpt, err := c.setSetupOptions(inv.GetRepoRef())
+	extraOpt, repository, err := c.setSetupOptions(inv.GetRepoRef())
+	if err != nil {
+		return nil, err
+	}
+
+	// share the per-node bandwidth with the other backup and restore processes running on this node
+	setupOpt := c.SetupOpt
+	release, err := util.ReserveNodeBandwidth(&setupOpt)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
 	// init restic wrapper
-	resticWrapper, err := restic.NewResticWrapper(c.SetupOpt)
+	resticWrapper, err := restic.NewResticWrapper(setupOpt)
 	if err != nil {
 		return nil, err
 	}
-	backupOpt := util.BackupOptionsForBackupTarget(targetInfo.Target, inv.GetRetentionPolicy(), *extraOpt)
+	backupOpt := util.BackupOptionsForBackupTarget(targetInfo.Target, repository, inv.GetRetentionPolicy(), *extraOpt)
+	statusOpt := status.UpdateStatusOptions{
+		StashClient: c.StashClient,
+		TargetRef:   targetInfo.Target.Ref,
+	}
+	backupOpt.OnProgress = statusOpt.BackupProgressReporter(backupSession, backupOpt.Host)
 	return resticWrapper.RunBackup(backupOpt, targetInfo.Target.Ref)
 }
 
@@ -531,16 +543,16 @@ func (c *BackupSessionController) targetMatched(ref api_v1beta1.TargetRef) bool
 	return false
 }
 
-func (c *BackupSessionController) setSetupOptions(repo kmapi.ObjectReference) (*util.ExtraOptions, error) {
+func (c *BackupSessionController) setSetupOptions(repo kmapi.ObjectReference) (*util.ExtraOptions, *api_v1alpha1.Repository, error) {
 	// get repository
 	repository, err := c.StashClient.StashV1alpha1().Repositories(repo.Namespace).Get(context.TODO(), repo.Name, metav1.GetOptions{})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	secret, err := c.K8sClient.CoreV1().Secrets(repository.Namespace).Get(context.TODO(), repository.Spec.Backend.StorageSecretName, metav1.GetOptions{})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// configure SourceHost, SecretDirectory, EnableCache and ScratchDirectory
@@ -554,19 +566,19 @@ func (c *BackupSessionController) setSetupOptions(repo kmapi.ObjectReference) (*
 	// configure setupOption
 	c.SetupOpt, err = util.SetupOptionsForRepository(*repository, *extraOpt)
 	if err != nil {
-		return nil, fmt.Errorf("setup option for repository fail")
+		return nil, nil, fmt.Errorf("setup option for repository fail")
 	}
 
 	// apply nice, ionice settings from env
 	c.SetupOpt.Nice, err = v1.NiceSettingsFromEnv()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	c.SetupOpt.IONice, err = v1.IONiceSettingsFromEnv()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return extraOpt, nil
+	return extraOpt, repository, nil
 }
 
 func (c *BackupSessionController) executePreBackupHook(inv invoker.BackupInvoker, targetInfo invoker.BackupTargetInfo, backupSession *api_v1beta1.BackupSession) error {
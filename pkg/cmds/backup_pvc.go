@@ -146,12 +146,16 @@ func NewCmdBackupPVC() *cobra.Command {
 	cmd.Flags().StringVar(&opt.setupOpt.ScratchDir, "scratch-dir", opt.setupOpt.ScratchDir, "Temporary directory")
 	cmd.Flags().BoolVar(&opt.setupOpt.EnableCache, "enable-cache", opt.setupOpt.EnableCache, "Specify whether to enable caching for restic")
 	cmd.Flags().Int64Var(&opt.setupOpt.MaxConnections, "max-connections", opt.setupOpt.MaxConnections, "Specify maximum concurrent connections for GCS, Azure and B2 backend")
+	cmd.Flags().Int32Var(&opt.setupOpt.UploadLimit, "upload-limit", opt.setupOpt.UploadLimit, "Upload bandwidth limit in KiB/s (0 means unlimited)")
+	cmd.Flags().Int32Var(&opt.setupOpt.DownloadLimit, "download-limit", opt.setupOpt.DownloadLimit, "Download bandwidth limit in KiB/s (0 means unlimited)")
 
 	cmd.Flags().StringVar(&opt.backupSessionName, "backupsession", opt.backupSessionName, "Name of the Backup Session")
 	cmd.Flags().StringVar(&opt.backupOpt.Host, "hostname", opt.backupOpt.Host, "Name of the host machine")
 	cmd.Flags().StringSliceVar(&opt.backupOpt.BackupPaths, "backup-paths", opt.backupOpt.BackupPaths, "List of paths to backup")
 	cmd.Flags().StringSliceVar(&opt.backupOpt.Exclude, "exclude", opt.backupOpt.Exclude, "List of pattern for directory/file to ignore during backup. Stash will not backup those files that matches these patterns.")
 	cmd.Flags().StringSliceVar(&opt.backupOpt.Args, "args", opt.backupOpt.Args, "Arguments to pass to the backup command.")
+	cmd.Flags().StringVar(&opt.backupOpt.Compression, "compression", opt.backupOpt.Compression, "Compression mode of the backed up data (auto, off or max)")
+	cmd.Flags().Int32Var(&opt.backupOpt.PackSize, "pack-size", opt.backupOpt.PackSize, "Target size of the pack files in MiB")
 	cmd.Flags().StringVar(&opt.invokerKind, "invoker-kind", opt.invokerKind, "Kind of the backup invoker")
 	cmd.Flags().StringVar(&opt.invokerName, "invoker-name", opt.invokerName, "Name of the respective backup invoker")
 	cmd.Flags().StringVar(&opt.targetRef.Name, "target-name", opt.targetRef.Name, "Name of the Target")
@@ -209,6 +213,13 @@ func (opt *pvcOptions) backupPVC(targetRef api_v1beta1.TargetRef) (*restic.Backu
 		return nil, err
 	}
 
+	// share the per-node bandwidth with the other backup and restore processes running on this node
+	release, err := util.ReserveNodeBandwidth(&opt.setupOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// init restic wrapper
 	resticWrapper, err := restic.NewResticWrapper(opt.setupOpt)
 	if err != nil {
@@ -0,0 +1,208 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	stash_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1alpha1/util"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
+
+	"github.com/spf13/cobra"
+	"gomodules.xyz/pointer"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+type maintenanceOptions struct {
+	kubeClient  kubernetes.Interface
+	stashClient cs.Interface
+
+	repoName           string
+	repoNamespace      string
+	task               string
+	repackUncompressed bool
+}
+
+func NewCmdMaintainRepository() *cobra.Command {
+	var (
+		masterURL      string
+		kubeconfigPath string
+		opt            = maintenanceOptions{}
+	)
+
+	cmd := &cobra.Command{
+		Use:               "maintain-repository",
+		Short:             "Run a maintenance task on a Repository",
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfigPath)
+			if err != nil {
+				klog.Fatalf("Could not get Kubernetes config: %s", err)
+			}
+			opt.kubeClient = kubernetes.NewForConfigOrDie(config)
+			opt.stashClient = cs.NewForConfigOrDie(config)
+
+			if err = opt.maintainRepository(); err != nil {
+				klog.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&masterURL, "master", "", "The address of the Kubernetes API server (overrides any value in kubeconfig)")
+	cmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", "", "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
+	cmd.Flags().StringVar(&opt.repoName, "repo-name", opt.repoName, "Name of the Repository")
+	cmd.Flags().StringVar(&opt.repoNamespace, "repo-namespace", opt.repoNamespace, "Namespace of the Repository")
+	cmd.Flags().StringVar(&opt.task, "task", opt.task, "Maintenance task to run. One of: check, prune, unlock, migrate")
+	cmd.Flags().BoolVar(&opt.repackUncompressed, "repack-uncompressed", opt.repackUncompressed, "Compress the existing data of the repository too during the migration")
+
+	return cmd
+}
+
+func (opt *maintenanceOptions) maintainRepository() error {
+	repo, err := opt.stashClient.StashV1alpha1().Repositories(opt.repoNamespace).Get(context.TODO(), opt.repoName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if repo.Spec.Maintenance == nil && opt.task != util.MaintenanceTaskMigrate {
+		return fmt.Errorf("maintenance is not configured for Repository %s/%s", repo.Namespace, repo.Name)
+	}
+	secret, err := opt.kubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	scratchDir, err := os.MkdirTemp(apis.ScratchDirMountPath, "maintenance")
+	if err != nil {
+		return err
+	}
+	defer util.RemoveDirWithLogErr(scratchDir)
+
+	setupOpt, err := util.SetupOptionsForRepository(*repo, util.ExtraOptions{
+		StorageSecret: secret,
+		ScratchDir:    scratchDir,
+	})
+	if err != nil {
+		return err
+	}
+	w, err := restic.NewResticWrapper(setupOpt)
+	if err != nil {
+		return err
+	}
+
+	// the result is recorded even if the task has failed, i.e. when the integrity check has found errors
+	transform, taskErr := opt.runTask(w, repo.Spec.Maintenance)
+	if transform != nil {
+		_, err = stash_util.UpdateRepositoryStatus(
+			context.TODO(),
+			opt.stashClient.StashV1alpha1(),
+			repo.ObjectMeta,
+			func(in *api_v1alpha1.RepositoryStatus) (types.UID, *api_v1alpha1.RepositoryStatus) {
+				transform(in)
+				return repo.UID, in
+			},
+			metav1.UpdateOptions{},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if taskErr != nil {
+		eventer.CreateEventWithLog(
+			opt.kubeClient,
+			eventer.EventSourceRepositoryMaintenanceJob,
+			repo,
+			core.EventTypeWarning,
+			eventer.EventReasonRepositoryMaintenanceFailed,
+			fmt.Sprintf("Maintenance task %s has failed. Reason: %v", opt.task, taskErr),
+		)
+		return taskErr
+	}
+	return nil
+}
+
+// runTask runs the maintenance task and returns the function that records its result in the Repository status.
+// A check that has found errors and a failed migration return both the function and an error.
+func (opt *maintenanceOptions) runTask(w *restic.ResticWrapper, m *api_v1alpha1.RepositoryMaintenance) (func(in *api_v1alpha1.RepositoryStatus), error) {
+	now := metav1.Now()
+	switch api_v1alpha1.MaintenanceTask(opt.task) {
+	case api_v1alpha1.MaintenanceTaskCheck:
+		if m.Check == nil {
+			return nil, fmt.Errorf("check is not configured for the Repository")
+		}
+		integrity, err := w.CheckRepository(restic.CheckOptions{ReadDataSubset: m.Check.ReadDataSubset})
+		if err != nil {
+			return nil, err
+		}
+		transform := func(in *api_v1alpha1.RepositoryStatus) {
+			in.Integrity = pointer.BoolP(integrity)
+			in.LastCheckTime = &now
+		}
+		if !integrity {
+			return transform, fmt.Errorf("integrity check has found errors in the restic repository")
+		}
+		return transform, nil
+	case api_v1alpha1.MaintenanceTaskPrune:
+		if m.Prune == nil {
+			return nil, fmt.Errorf("prune is not configured for the Repository")
+		}
+		reclaimed, err := w.PruneRepository(restic.PruneOptions{
+			MaxUnusedLimit:      m.Prune.MaxUnused,
+			MaxRepackSize:       m.Prune.MaxRepackSize,
+			RepackSmall:         m.Prune.RepackSmall,
+			RepackUncompressed:  m.Prune.RepackUncompressed,
+			RepackCacheableOnly: m.Prune.RepackCacheableOnly,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return func(in *api_v1alpha1.RepositoryStatus) {
+			in.LastPruneTime = &now
+			in.ReclaimedBytes = int64(reclaimed)
+		}, nil
+	case util.MaintenanceTaskMigrate:
+		if err := util.MigrateResticRepositoryToV2(w, opt.repackUncompressed); err != nil {
+			// the controller reports the message once it finds the migration Job failed
+			return func(in *api_v1alpha1.RepositoryStatus) {
+				if in.Migration != nil {
+					in.Migration.Message = err.Error()
+				}
+			}, err
+		}
+		return nil, nil
+	case api_v1alpha1.MaintenanceTaskUnlock:
+		if err := w.RemoveStaleLocks(); err != nil {
+			return nil, err
+		}
+		return func(in *api_v1alpha1.RepositoryStatus) {
+			in.LastUnlockTime = &now
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown maintenance task %q", opt.task)
+	}
+}
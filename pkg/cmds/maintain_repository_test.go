@@ -0,0 +1,123 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"testing"
+
+	"stash.appscode.dev/apimachinery/pkg/restic"
+)
+
+func TestExtractPruneInfo(t *testing.T) {
+	testCases := []struct {
+		description string
+		out         string
+		expected    uint64
+		expectErr   bool
+	}{
+		{
+			description: "data removed",
+			out: `counting files in repo
+building new index for repo
+[0:00] 100.00%  6 / 6 packs
+
+collecting packs for deletion and repacking
+to repack:           9 blobs / 1.027 KiB
+this removes:        3 blobs / 359 B
+to delete:          74 blobs / 1.072 MiB
+total prune:        77 blobs / 1.072 MiB
+remaining:          38 blobs / 76.396 KiB
+`,
+			expected: 1124073,
+		},
+		{
+			description: "nothing removed",
+			out: `loading indexes...
+loading all snapshots...
+finding data that is still in use for 1 snapshots
+collecting packs for deletion and repacking
+`,
+			expected: 0,
+		},
+		{
+			description: "malformed total prune line",
+			out:         "total prune: 77 blobs\n",
+			expectErr:   true,
+		},
+		{
+			description: "invalid size",
+			out:         "total prune: 77 blobs / many MiB\n",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			size, err := restic.ExtractPruneInfo([]byte(tc.out))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, found size %d", size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if size != tc.expected {
+				t.Errorf("expected size %d, found %d", tc.expected, size)
+			}
+		})
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	testCases := []struct {
+		description string
+		size        string
+		expected    uint64
+		expectErr   bool
+	}{
+		{description: "bytes", size: "359 B", expected: 359},
+		{description: "kibibytes", size: "1.5 KiB", expected: 1536},
+		{description: "mebibytes", size: "2 MiB", expected: 2 << 20},
+		{description: "gibibytes", size: "0.5 GiB", expected: 1 << 29},
+		{description: "tebibytes", size: "1 TiB", expected: 1 << 40},
+		{description: "zero", size: "0 B", expected: 0},
+		{description: "missing unit", size: "1024", expectErr: true},
+		{description: "unknown unit", size: "1 PiB", expectErr: true},
+		{description: "decimal unit", size: "1 MB", expectErr: true},
+		{description: "invalid value", size: "one KiB", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			size, err := restic.ParseBytes(tc.size)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, found size %d", size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if size != tc.expected {
+				t.Errorf("expected size %d, found %d", tc.expected, size)
+			}
+		})
+	}
+}
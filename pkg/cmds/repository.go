@@ -0,0 +1,476 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	"stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	stash_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1alpha1/util"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/util"
+
+	"github.com/spf13/cobra"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	condutil "kmodules.xyz/client-go/conditions"
+)
+
+type repositoryOptions struct {
+	kubeClient  kubernetes.Interface
+	stashClient cs.Interface
+
+	masterURL      string
+	kubeConfigPath string
+	passphraseFile string
+}
+
+func NewCmdRepository() *cobra.Command {
+	opt := &repositoryOptions{}
+
+	cmd := &cobra.Command{
+		Use:               "repository",
+		Short:             "Export, import and migrate Repositories",
+		DisableAutoGenTag: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			config, err := clientcmd.BuildConfigFromFlags(opt.masterURL, opt.kubeConfigPath)
+			if err != nil {
+				return err
+			}
+			opt.kubeClient = kubernetes.NewForConfigOrDie(config)
+			opt.stashClient = cs.NewForConfigOrDie(config)
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.masterURL, "master", opt.masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
+	cmd.PersistentFlags().StringVar(&opt.kubeConfigPath, "kubeconfig", opt.kubeConfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
+	cmd.PersistentFlags().StringVar(&opt.passphraseFile, "passphrase-file", opt.passphraseFile, "Path to a file containing the passphrase used to encrypt/decrypt the bundle. The bundle is not encrypted if it is empty.")
+
+	cmd.AddCommand(newCmdExportRepository(opt))
+	cmd.AddCommand(newCmdImportRepository(opt))
+	cmd.AddCommand(newCmdMigrateRepository(opt))
+	return cmd
+}
+
+func newCmdExportRepository(opt *repositoryOptions) *cobra.Command {
+	var repo, output string
+
+	cmd := &cobra.Command{
+		Use:               "export",
+		Short:             "Export a Repository, its storage Secrets and its snapshot index into a portable bundle",
+		Example:           "stash repository export --repo demo/gcs-repo --output gcs-repo.json --passphrase-file passphrase.txt",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace, name, found := strings.Cut(repo, "/")
+			if !found || namespace == "" || name == "" {
+				return fmt.Errorf("invalid repository %q. Use <namespace>/<name> format", repo)
+			}
+			passphrase, err := readPassphrase(opt.passphraseFile)
+			if err != nil {
+				return err
+			}
+			bundle, err := opt.exportRepository(namespace, name)
+			if err != nil {
+				return err
+			}
+			if len(passphrase) == 0 {
+				klog.Warningln("No passphrase has been provided. The credentials of the storage Secrets will be written into the bundle in cleartext.")
+			}
+			data, err := encodeRepositoryBundle(bundle, passphrase)
+			if err != nil {
+				return err
+			}
+			if output == "" || output == "-" {
+				_, err = fmt.Println(string(data))
+				return err
+			}
+			return os.WriteFile(output, data, 0o600)
+		},
+	}
+	cmd.Flags().StringVar(&repo, "repo", repo, "Repository to export in <namespace>/<name> format")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "File where the bundle will be written (default stdout)")
+	return cmd
+}
+
+func newCmdImportRepository(opt *repositoryOptions) *cobra.Command {
+	var input, namespace string
+
+	cmd := &cobra.Command{
+		Use:               "import",
+		Short:             "Recreate a Repository and its storage Secrets from an exported bundle",
+		Example:           "stash repository import --input gcs-repo.json --namespace demo --passphrase-file passphrase.txt",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passphrase, err := readPassphrase(opt.passphraseFile)
+			if err != nil {
+				return err
+			}
+			var data []byte
+			if input == "" || input == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(input)
+			}
+			if err != nil {
+				return err
+			}
+			bundle, err := decodeRepositoryBundle(data, passphrase)
+			if err != nil {
+				return err
+			}
+			if len(passphrase) == 0 {
+				klog.Warningln("The bundle is not encrypted. Its storage Secret credentials have been stored in cleartext, so delete the bundle file once it has been imported.")
+			}
+			if namespace != "" {
+				bundle.Repository.Namespace = namespace
+			}
+			repo, err := opt.importRepository(bundle)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Repository %s/%s has been imported with %d snapshots\n", repo.Namespace, repo.Name, len(bundle.Snapshots))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&input, "input", "i", input, "File to read the bundle from (default stdin)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", namespace, "Namespace where the Repository will be imported (default is the namespace of the exported Repository)")
+	return cmd
+}
+
+func newCmdMigrateRepository(opt *repositoryOptions) *cobra.Command {
+	var (
+		repo               string
+		repackUncompressed bool
+		timeout            = 30 * time.Minute
+	)
+
+	cmd := &cobra.Command{
+		Use:               "migrate",
+		Short:             "Migrate the restic repository of a Repository to format version 2",
+		Long:              "Migrate the restic repository of a Repository to format version 2 so that the backed up data gets compressed. The BackupConfigurations and BackupBatches using the Repository are paused during the migration.",
+		Example:           "stash repository migrate --repo demo/gcs-repo --repack-uncompressed",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace, name, found := strings.Cut(repo, "/")
+			if !found || namespace == "" || name == "" {
+				return fmt.Errorf("invalid repository %q. Use <namespace>/<name> format", repo)
+			}
+			if err := opt.migrateRepository(namespace, name, repackUncompressed, timeout); err != nil {
+				return err
+			}
+			fmt.Printf("Repository %s/%s has been migrated to %s\n", namespace, name, apis.MigrateRepositoryToV2)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&repo, "repo", repo, "Repository to migrate in <namespace>/<name> format")
+	cmd.Flags().BoolVar(&repackUncompressed, "repack-uncompressed", repackUncompressed, "Compress the existing data of the repository too")
+	cmd.Flags().DurationVar(&timeout, "timeout", timeout, "Time to wait for the running and pending backups to complete before the migration")
+	return cmd
+}
+
+func (opt *repositoryOptions) exportRepository(namespace, name string) (*RepositoryBundle, error) {
+	repo, err := opt.stashClient.StashV1alpha1().Repositories(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &RepositoryBundle{
+		Repository: v1alpha1.Repository{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       v1alpha1.ResourceKindRepository,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      repo.Name,
+				Namespace: repo.Namespace,
+				Labels:    repo.Labels,
+			},
+			Spec: repo.Spec,
+		},
+		ExportTime: metav1.Now(),
+	}
+
+	secretNames := []string{repo.Spec.Backend.StorageSecretName}
+	for _, replica := range repo.Spec.Replicas {
+		secretNames = append(secretNames, replica.Backend.StorageSecretName)
+	}
+	for _, secretName := range secretNames {
+		secret, err := opt.kubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		bundle.Secrets = append(bundle.Secrets, BundleSecret{Name: secret.Name, Data: secret.Data})
+	}
+
+	w, cleanup, err := newRepositoryResticWrapper(repo, bundle.Secrets[0].Data)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if !w.RepositoryAlreadyExist() {
+		return nil, fmt.Errorf("restic repository of Repository %s/%s does not exist in the backend", repo.Namespace, repo.Name)
+	}
+	bundle.Snapshots, err = w.ListSnapshots(nil)
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// importRepository creates the storage Secrets and the Repository of the bundle. The objects that already exist
+// with identical content are kept as they are, so an import can be run again. If the import fails mid-way, the
+// objects created by this run are deleted.
+func (opt *repositoryOptions) importRepository(bundle *RepositoryBundle) (repo *v1alpha1.Repository, err error) {
+	in := bundle.Repository.DeepCopy()
+	if err := in.IsValid(); err != nil {
+		return nil, err
+	}
+	if len(bundle.Secrets) == 0 {
+		return nil, fmt.Errorf("repository bundle does not contain the storage Secret")
+	}
+
+	// make sure the backend is reachable from this cluster before creating anything
+	w, cleanup, err := newRepositoryResticWrapper(in, bundle.Secrets[0].Data)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if !w.RepositoryAlreadyExist() {
+		return nil, fmt.Errorf("restic repository of Repository %s/%s is not reachable from this cluster", in.Namespace, in.Name)
+	}
+
+	var rollbacks []func()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			rollbacks[i]()
+		}
+	}()
+
+	for _, s := range bundle.Secrets {
+		created, err := opt.importSecret(in.Namespace, s)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			name := s.Name
+			rollbacks = append(rollbacks, func() {
+				if err := opt.kubeClient.CoreV1().Secrets(in.Namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+					klog.Warningf("Failed to delete Secret %s/%s. Reason: %v", in.Namespace, name, err)
+				}
+			})
+		}
+	}
+
+	repo, err = opt.stashClient.StashV1alpha1().Repositories(in.Namespace).Get(context.TODO(), in.Name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		if !equality.Semantic.DeepEqual(repo.Spec, in.Spec) {
+			return nil, fmt.Errorf("repository %s/%s already exists with a different spec", in.Namespace, in.Name)
+		}
+		klog.Infof("Repository %s/%s already exists. Skipped creating it.", in.Namespace, in.Name)
+	case kerr.IsNotFound(err):
+		repo, err = opt.stashClient.StashV1alpha1().Repositories(in.Namespace).Create(context.TODO(), &v1alpha1.Repository{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      in.Name,
+				Namespace: in.Namespace,
+				Labels:    in.Labels,
+			},
+			Spec: in.Spec,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		rollbacks = append(rollbacks, func() {
+			if err := opt.stashClient.StashV1alpha1().Repositories(in.Namespace).Delete(context.TODO(), in.Name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+				klog.Warningf("Failed to delete Repository %s/%s. Reason: %v", in.Namespace, in.Name, err)
+			}
+		})
+	default:
+		return nil, err
+	}
+
+	return stash_util.UpdateRepositoryStatus(
+		context.TODO(),
+		opt.stashClient.StashV1alpha1(),
+		repo.ObjectMeta,
+		func(status *v1alpha1.RepositoryStatus) (types.UID, *v1alpha1.RepositoryStatus) {
+			status.SnapshotCount = int64(len(bundle.Snapshots))
+			for _, snapshot := range bundle.Snapshots {
+				t := metav1.NewTime(snapshot.Time)
+				if status.FirstBackupTime == nil || t.Before(status.FirstBackupTime) {
+					status.FirstBackupTime = &t
+				}
+				if status.LastBackupTime == nil || status.LastBackupTime.Before(&t) {
+					status.LastBackupTime = &t
+				}
+			}
+			status.Conditions = condutil.SetCondition(status.Conditions, kmapi.Condition{
+				Type:               v1alpha1.RepositoryReady,
+				Status:             metav1.ConditionTrue,
+				Reason:             v1alpha1.BackendRepositoryReachable,
+				Message:            fmt.Sprintf("Repository has been imported from a bundle exported at %s.", bundle.ExportTime.UTC().Format("2006-01-02T15:04:05Z")),
+				LastTransitionTime: metav1.Now(),
+			})
+			return repo.UID, status
+		},
+		metav1.UpdateOptions{},
+	)
+}
+
+// importSecret creates a storage Secret of the bundle. It returns true if the Secret has been created by this call.
+// An existing Secret with the same data is kept as it is, but an existing Secret with different data is never overwritten.
+func (opt *repositoryOptions) importSecret(namespace string, s BundleSecret) (bool, error) {
+	cur, err := opt.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), s.Name, metav1.GetOptions{})
+	if err == nil {
+		if !equality.Semantic.DeepEqual(cur.Data, s.Data) {
+			return false, fmt.Errorf("secret %s/%s already exists with different data", namespace, s.Name)
+		}
+		klog.Infof("Secret %s/%s already exists. Skipped creating it.", namespace, s.Name)
+		return false, nil
+	}
+	if !kerr.IsNotFound(err) {
+		return false, err
+	}
+	_, err = opt.kubeClient.CoreV1().Secrets(namespace).Create(context.TODO(), &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.Name,
+			Namespace: namespace,
+		},
+		Data: s.Data,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// migrateRepository pauses the BackupConfigurations and BackupBatches using the Repository, migrates the restic repository
+// once the running and pending backups have been completed and then resumes the paused invokers.
+func (opt *repositoryOptions) migrateRepository(namespace, name string, repackUncompressed bool, timeout time.Duration) (err error) {
+	repo, err := opt.stashClient.StashV1alpha1().Repositories(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if repo.Status.Migration != nil && repo.Status.Migration.Phase == v1alpha1.RepositoryMigrationRunning {
+		return fmt.Errorf("a migration of Repository %s/%s is already running", namespace, name)
+	}
+	secret, err := opt.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	paused, err := util.PauseBackupInvokers(opt.stashClient, repo.Status.References)
+	defer func() {
+		if resumeErr := util.ResumeBackupInvokers(opt.stashClient, paused); resumeErr != nil && err == nil {
+			err = resumeErr
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	startTime := metav1.Now()
+	defer func() {
+		_, statusErr := stash_util.UpdateRepositoryStatus(
+			context.TODO(),
+			opt.stashClient.StashV1alpha1(),
+			repo.ObjectMeta,
+			func(in *v1alpha1.RepositoryStatus) (types.UID, *v1alpha1.RepositoryStatus) {
+				now := metav1.Now()
+				in.Migration = &v1alpha1.RepositoryMigrationStatus{
+					Version:        apis.MigrateRepositoryToV2,
+					Phase:          v1alpha1.RepositoryMigrationSucceeded,
+					StartTime:      &startTime,
+					CompletionTime: &now,
+				}
+				if err != nil {
+					in.Migration.Phase = v1alpha1.RepositoryMigrationFailed
+					in.Migration.Message = err.Error()
+				}
+				return repo.UID, in
+			},
+			metav1.UpdateOptions{},
+		)
+		if statusErr != nil && err == nil {
+			err = statusErr
+		}
+	}()
+
+	// the migration needs an exclusive lock on the restic repository
+	err = wait.PollUntilContextTimeout(context.Background(), 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		active, err := util.HasActiveBackupSession(opt.stashClient, repo.Status.References)
+		return !active, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to wait for the running and pending backups to complete. Reason: %v", err)
+	}
+
+	w, cleanup, err := newRepositoryResticWrapper(repo, secret.Data)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return util.MigrateResticRepositoryToV2(w, repackUncompressed)
+}
+
+// newRepositoryResticWrapper configures a restic wrapper for the Repository using the given storage Secret keys.
+// The caller must call the returned function to remove the scratch directory.
+func newRepositoryResticWrapper(repo *v1alpha1.Repository, secretData map[string][]byte) (*restic.ResticWrapper, func(), error) {
+	tempDir, err := os.MkdirTemp("", "stash")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { util.RemoveDirWithLogErr(tempDir) }
+
+	setupOpt, err := util.SetupOptionsForRepository(*repo, util.ExtraOptions{
+		StorageSecret: &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      repo.Spec.Backend.StorageSecretName,
+				Namespace: repo.Namespace,
+			},
+			Data: secretData,
+		},
+		ScratchDir: tempDir,
+	})
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	w, err := restic.NewResticWrapper(setupOpt)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return w, cleanup, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	"golang.org/x/crypto/scrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	repositoryBundleVersion = "v1"
+	bundleEncryption        = "scrypt-aes-256-gcm"
+
+	// scrypt parameters recommended for interactive logins
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	scryptSalt   = 16
+)
+
+// RepositoryBundle holds everything that is needed to recreate a Repository in another cluster.
+type RepositoryBundle struct {
+	// Repository is the exported Repository. Only the name, namespace, labels and spec are kept.
+	Repository v1alpha1.Repository `json:"repository"`
+	// Secrets holds the storage Secrets of the Repository and its replicas
+	Secrets []BundleSecret `json:"secrets"`
+	// Snapshots is the index of the snapshots stored in the repository at the time of export
+	Snapshots []restic.Snapshot `json:"snapshots"`
+	// ExportTime is the time when the bundle was exported
+	ExportTime metav1.Time `json:"exportTime"`
+}
+
+// BundleSecret holds the keys of a storage Secret.
+type BundleSecret struct {
+	Name string            `json:"name"`
+	Data map[string][]byte `json:"data"`
+}
+
+// repositoryBundleFile is the on-disk format of a RepositoryBundle.
+// When a passphrase is given, the bundle is stored encrypted in Data instead of Bundle.
+type repositoryBundleFile struct {
+	Version    string            `json:"version"`
+	Encryption string            `json:"encryption,omitempty"`
+	Salt       []byte            `json:"salt,omitempty"`
+	Nonce      []byte            `json:"nonce,omitempty"`
+	Data       []byte            `json:"data,omitempty"`
+	Bundle     *RepositoryBundle `json:"bundle,omitempty"`
+}
+
+func encodeRepositoryBundle(bundle *RepositoryBundle, passphrase []byte) ([]byte, error) {
+	file := repositoryBundleFile{
+		Version: repositoryBundleVersion,
+	}
+	if len(passphrase) == 0 {
+		file.Bundle = bundle
+		return json.MarshalIndent(file, "", "  ")
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	file.Encryption = bundleEncryption
+	file.Salt = make([]byte, scryptSalt)
+	if _, err := rand.Read(file.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newBundleCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, data, []byte(file.Version))
+	return json.MarshalIndent(file, "", "  ")
+}
+
+func decodeRepositoryBundle(data, passphrase []byte) (*RepositoryBundle, error) {
+	var file repositoryBundleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid repository bundle. Reason: %v", err)
+	}
+	if file.Version != repositoryBundleVersion {
+		return nil, fmt.Errorf("unsupported repository bundle version %q", file.Version)
+	}
+
+	switch file.Encryption {
+	case "":
+		if file.Bundle == nil {
+			return nil, fmt.Errorf("repository bundle is empty")
+		}
+		return file.Bundle, nil
+	case bundleEncryption:
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("repository bundle is encrypted. Provide the passphrase using --passphrase-file flag")
+		}
+		gcm, err := newBundleCipher(passphrase, file.Salt)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := gcm.Open(nil, file.Nonce, file.Data, []byte(file.Version))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt repository bundle. Make sure the passphrase is correct")
+		}
+		var bundle RepositoryBundle
+		if err := json.Unmarshal(plain, &bundle); err != nil {
+			return nil, err
+		}
+		return &bundle, nil
+	default:
+		return nil, fmt.Errorf("unsupported repository bundle encryption %q", file.Encryption)
+	}
+}
+
+func newBundleCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func readPassphrase(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase file %s is empty", path)
+	}
+	return []byte(passphrase), nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	store "kmodules.xyz/objectstore-api/api/v1"
+)
+
+func TestRepositoryBundleRoundTrip(t *testing.T) {
+	bundle := &RepositoryBundle{
+		Repository: v1alpha1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Name: "gcs-repo", Namespace: "demo"},
+			Spec: v1alpha1.RepositorySpec{
+				Backend: store.Backend{
+					StorageSecretName: "gcs-secret",
+					GCS:               &store.GCSSpec{Bucket: "stash-backup", Prefix: "demo"},
+				},
+			},
+		},
+		Secrets: []BundleSecret{
+			{Name: "gcs-secret", Data: map[string][]byte{restic.RESTIC_PASSWORD: []byte("not@secret")}},
+		},
+		Snapshots:  []restic.Snapshot{{ID: "4bc21d6f", Hostname: "host-0", Paths: []string{"/source/data"}}},
+		ExportTime: metav1.NewTime(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)),
+	}
+
+	testCases := []struct {
+		description string
+		passphrase  []byte
+	}{
+		{description: "without passphrase"},
+		{description: "with passphrase", passphrase: []byte("correct horse battery staple")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			data, err := encodeRepositoryBundle(bundle, tc.passphrase)
+			if err != nil {
+				t.Fatalf("failed to encode bundle: %v", err)
+			}
+			decoded, err := decodeRepositoryBundle(data, tc.passphrase)
+			if err != nil {
+				t.Fatalf("failed to decode bundle: %v", err)
+			}
+			// compare the serialized form as the time zone of the decoded timestamps may differ
+			expected, _ := json.Marshal(bundle)
+			found, _ := json.Marshal(decoded)
+			if !bytes.Equal(found, expected) {
+				t.Errorf("expected bundle %s, found %s", expected, found)
+			}
+		})
+	}
+}
+
+func TestDecodeEncryptedRepositoryBundleErrors(t *testing.T) {
+	bundle := &RepositoryBundle{
+		Secrets: []BundleSecret{{Name: "gcs-secret", Data: map[string][]byte{restic.RESTIC_PASSWORD: []byte("not@secret")}}},
+	}
+	data, err := encodeRepositoryBundle(bundle, []byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatalf("failed to encode bundle: %v", err)
+	}
+
+	if _, err := decodeRepositoryBundle(data, []byte("wrong passphrase")); err == nil {
+		t.Errorf("expected error for wrong passphrase")
+	}
+	if _, err := decodeRepositoryBundle(data, nil); err == nil {
+		t.Errorf("expected error for missing passphrase")
+	}
+	if _, err := decodeRepositoryBundle([]byte(`{"version":"v0"}`), nil); err == nil {
+		t.Errorf("expected error for unsupported version")
+	}
+}
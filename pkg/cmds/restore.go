@@ -49,11 +49,15 @@ func NewCmdRestore() *cobra.Command {
 		RestoreModel: restore.RestoreModelInitContainer,
 	}
 
+	var workloadAdapters []string
 	cmd := &cobra.Command{
 		Use:               "restore",
 		Short:             "Restore from backup",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := registerWorkloadAdapters(workloadAdapters); err != nil {
+				return err
+			}
 			// create client
 			config, err := clientcmd.BuildConfigFromFlags(opt.MasterURL, opt.KubeconfigPath)
 			if err != nil {
@@ -122,6 +126,10 @@ func NewCmdRestore() *cobra.Command {
 	cmd.Flags().BoolVar(&opt.Metrics.Enabled, "metrics-enabled", opt.Metrics.Enabled, "Specify whether to export Prometheus metrics")
 	cmd.Flags().StringVar(&opt.Metrics.PushgatewayURL, "pushgateway-url", opt.Metrics.PushgatewayURL, "Pushgateway URL where the metrics will be pushed")
 	cmd.Flags().StringVar(&opt.RestoreModel, "restore-model", opt.RestoreModel, "Specify whether using job or init-container to restore (default init-container)")
+	cmd.Flags().StringArrayVar(&workloadAdapters, "workload-adapter", workloadAdapters, "Workload adapter of the target when it is not a built-in workload")
+
+	cmd.AddCommand(NewCmdRestoreToPVC())
+	cmd.AddCommand(NewCmdRestorePlan())
 
 	return cmd
 }
@@ -0,0 +1,100 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	"stash.appscode.dev/stash/pkg/util"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type restorePlanOptions struct {
+	kubeClient  kubernetes.Interface
+	stashClient cs.Interface
+
+	masterURL      string
+	kubeConfigPath string
+
+	restoreSession string
+}
+
+// NewCmdRestorePlan prints what a RestoreSession would restore on each host without running the restore.
+// The RestoreSession does not need to be a dry run. Only its Repository is read.
+func NewCmdRestorePlan() *cobra.Command {
+	opt := restorePlanOptions{}
+
+	cmd := &cobra.Command{
+		Use:               "plan",
+		Short:             "Show what a RestoreSession would restore",
+		Example:           "stash restore plan --restore-session demo/sample-restore",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opt.restoreSession == "" {
+				return fmt.Errorf("--restore-session flag is required")
+			}
+
+			config, err := clientcmd.BuildConfigFromFlags(opt.masterURL, opt.kubeConfigPath)
+			if err != nil {
+				return err
+			}
+			opt.kubeClient = kubernetes.NewForConfigOrDie(config)
+			opt.stashClient = cs.NewForConfigOrDie(config)
+
+			return opt.plan()
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.masterURL, "master", opt.masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
+	cmd.Flags().StringVar(&opt.kubeConfigPath, "kubeconfig", opt.kubeConfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
+	cmd.Flags().StringVar(&opt.restoreSession, "restore-session", opt.restoreSession, "RestoreSession to plan in <namespace>/<name> format")
+
+	return cmd
+}
+
+func (opt *restorePlanOptions) plan() error {
+	namespace, name, found := strings.Cut(opt.restoreSession, "/")
+	if !found || namespace == "" || name == "" {
+		return fmt.Errorf("invalid RestoreSession %q. Use <namespace>/<name> format", opt.restoreSession)
+	}
+	rs, err := opt.stashClient.StashV1beta1().RestoreSessions(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	repoNamespace := rs.Spec.Repository.Namespace
+	if repoNamespace == "" {
+		repoNamespace = rs.Namespace
+	}
+	repo, err := opt.stashClient.StashV1alpha1().Repositories(repoNamespace).Get(context.TODO(), rs.Spec.Repository.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	plan, err := util.PlanRestore(opt.kubeClient, rs.Namespace, repo, rs.Spec.Driver, rs.Spec.Target)
+	if err != nil {
+		return err
+	}
+	return printJSON(plan)
+}
@@ -18,7 +18,10 @@ package cmds
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
 	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
@@ -37,6 +40,8 @@ import (
 )
 
 func NewCmdRestorePVC() *cobra.Command {
+	var pointInTime string
+	var pathMappings []string
 	opt := pvcOptions{
 		restoreOpt: restic.RestoreOptions{
 			Host: restic.DefaultHost,
@@ -56,6 +61,18 @@ func NewCmdRestorePVC() *cobra.Command {
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			flags.EnsureRequiredFlags(cmd, "restore-dirs", "provider")
+			if pointInTime != "" {
+				t, err := parsePointInTime(pointInTime)
+				if err != nil {
+					return err
+				}
+				opt.restoreOpt.PointInTime = t
+			}
+			mappings, err := parsePathMappings(pathMappings)
+			if err != nil {
+				return err
+			}
+			opt.restoreOpt.PathMappings = mappings
 
 			config, err := clientcmd.BuildConfigFromFlags(opt.masterURL, opt.kubeConfigPath)
 			if err != nil {
@@ -66,6 +83,32 @@ func NewCmdRestorePVC() *cobra.Command {
 			opt.k8sClient = kubernetes.NewForConfigOrDie(config)
 			opt.stashClient = cs.NewForConfigOrDie(config)
 
+			// without any invoker, restore into the target given by the flags (i.e. a Job created by "stash restore pvc")
+			if opt.invokerKind == "" {
+				restoreOutput, err := opt.restorePVC(opt.targetRef)
+				if err != nil {
+					restoreOutput = &restic.RestoreOutput{
+						RestoreTargetStatus: api_v1beta1.RestoreMemberStatus{
+							Ref: opt.targetRef,
+							Stats: []api_v1beta1.HostRestoreStats{
+								{
+									Hostname: opt.restoreOpt.Host,
+									Phase:    api_v1beta1.HostRestoreFailed,
+									Error:    err.Error(),
+								},
+							},
+						},
+					}
+				}
+				if opt.outputDir != "" {
+					if writeErr := restoreOutput.WriteOutput(filepath.Join(opt.outputDir, restic.DefaultOutputFileName)); writeErr != nil {
+						return writeErr
+					}
+				}
+				// the Job must fail even though the failure has been reported in the output
+				return err
+			}
+
 			inv, err := invoker.NewRestoreInvoker(opt.k8sClient, opt.stashClient, opt.invokerKind, opt.invokerName, opt.namespace)
 			if err != nil {
 				return err
@@ -78,6 +121,13 @@ func NewCmdRestorePVC() *cobra.Command {
 					if err != nil {
 						return err
 					}
+					// restore the data of the respective host of the source workload
+					if targetInfo.Target.Source != nil {
+						opt.restoreOpt.SourceHost, err = util.SourceHostForHost(targetInfo.Target, opt.restoreOpt.Host)
+						if err != nil {
+							return err
+						}
+					}
 
 					// run backup
 					restoreOutput, err := opt.restorePVC(targetInfo.Target.Ref)
@@ -119,6 +169,8 @@ func NewCmdRestorePVC() *cobra.Command {
 	cmd.Flags().StringVar(&opt.setupOpt.ScratchDir, "scratch-dir", opt.setupOpt.ScratchDir, "Temporary directory")
 	cmd.Flags().BoolVar(&opt.setupOpt.EnableCache, "enable-cache", opt.setupOpt.EnableCache, "Specify whether to enable caching for restic")
 	cmd.Flags().Int64Var(&opt.setupOpt.MaxConnections, "max-connections", opt.setupOpt.MaxConnections, "Specify maximum concurrent connections for GCS, Azure and B2 backend")
+	cmd.Flags().Int32Var(&opt.setupOpt.UploadLimit, "upload-limit", opt.setupOpt.UploadLimit, "Upload bandwidth limit in KiB/s (0 means unlimited)")
+	cmd.Flags().Int32Var(&opt.setupOpt.DownloadLimit, "download-limit", opt.setupOpt.DownloadLimit, "Download bandwidth limit in KiB/s (0 means unlimited)")
 
 	cmd.Flags().StringVar(&opt.restoreOpt.Host, "hostname", opt.restoreOpt.Host, "Name of the host machine")
 	cmd.Flags().StringSliceVar(&opt.restoreOpt.RestorePaths, "restore-paths", opt.restoreOpt.RestorePaths, "List of paths to restore")
@@ -126,6 +178,8 @@ func NewCmdRestorePVC() *cobra.Command {
 	cmd.Flags().StringSliceVar(&opt.restoreOpt.Include, "include", opt.restoreOpt.Include, "List of pattern for directory/file to restore. Stash will restore only those files that matches these patterns.")
 	cmd.Flags().StringSliceVar(&opt.restoreOpt.Args, "args", opt.restoreOpt.Args, "Arguments to pass to the restore command.")
 	cmd.Flags().StringSliceVar(&opt.restoreOpt.Snapshots, "snapshots", opt.restoreOpt.Snapshots, "List of snapshots to be restored")
+	cmd.Flags().StringVar(&pointInTime, "point-in-time", pointInTime, "Restore the newest snapshots taken at or before this time (RFC3339 format)")
+	cmd.Flags().StringSliceVar(&pathMappings, "path-mappings", pathMappings, "List of backed up paths to restore into different paths (i.e. /var/lib/data:/restore/data)")
 
 	cmd.Flags().StringVar(&opt.invokerKind, "invoker-kind", opt.invokerKind, "Kind of the backup invoker")
 	cmd.Flags().StringVar(&opt.invokerName, "invoker-name", opt.invokerName, "Name of the respective backup invoker")
@@ -156,6 +210,13 @@ func (opt *pvcOptions) restorePVC(targetRef api_v1beta1.TargetRef) (*restic.Rest
 		return nil, err
 	}
 
+	// share the per-node bandwidth with the other backup and restore processes running on this node
+	release, err := util.ReserveNodeBandwidth(&opt.setupOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// init restic wrapper
 	resticWrapper, err := restic.NewResticWrapper(opt.setupOpt)
 	if err != nil {
@@ -164,3 +225,30 @@ func (opt *pvcOptions) restorePVC(targetRef api_v1beta1.TargetRef) (*restic.Rest
 	// Run restore
 	return resticWrapper.RunRestore(opt.restoreOpt, targetRef)
 }
+
+func parsePointInTime(value string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid point in time %q. Use RFC3339 format (i.e. 2024-01-02T14:05:00Z)", value)
+	}
+	return &t, nil
+}
+
+// parsePathMappings parses the path mappings given in "<source path>:<target path>" format
+func parsePathMappings(values []string) ([]api_v1beta1.PathMapping, error) {
+	var mappings []api_v1beta1.PathMapping
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		source, target, found := strings.Cut(value, ":")
+		if !found || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid path mapping %q. Use <source path>:<target path> format (i.e. /var/lib/data:/restore/data)", value)
+		}
+		mappings = append(mappings, api_v1beta1.PathMapping{
+			SourcePath: source,
+			TargetPath: target,
+		})
+	}
+	return mappings, nil
+}
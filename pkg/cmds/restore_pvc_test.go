@@ -0,0 +1,93 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"stash.appscode.dev/apimachinery/pkg/restic"
+)
+
+func TestNewestSnapshotOfPath(t *testing.T) {
+	now := time.Now()
+	snapshots := []restic.Snapshot{
+		{ID: "data-old", Time: now.Add(-2 * time.Hour), Paths: []string{"/data"}},
+		{ID: "data-new", Time: now.Add(-time.Hour), Paths: []string{"/data"}},
+		{ID: "config", Time: now.Add(-3 * time.Hour), Paths: []string{"/config"}},
+		{ID: "logs", Time: now, Paths: []string{"/logs", "/data/logs"}},
+	}
+
+	if paths, expected := restic.BackedUpPaths(snapshots), []string{"/config", "/data", "/data/logs", "/logs"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected backed up paths %v, found %v", expected, paths)
+	}
+
+	testCases := []struct {
+		description string
+		path        string
+		expected    string
+	}{
+		{description: "newest of multiple snapshots", path: "/data", expected: "data-new"},
+		{description: "single snapshot", path: "/config", expected: "config"},
+		{description: "snapshot with multiple paths", path: "/data/logs", expected: "logs"},
+		{description: "path not backed up", path: "/tmp", expected: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var id string
+			if snapshot := restic.NewestSnapshotOfPath(snapshots, tc.path); snapshot != nil {
+				id = snapshot.ID
+			}
+			if id != tc.expected {
+				t.Errorf("expected snapshot %q, found %q", tc.expected, id)
+			}
+		})
+	}
+}
+
+func TestSnapshotContainsPath(t *testing.T) {
+	snapshot := restic.Snapshot{Paths: []string{"/var/lib/data", "/etc/config/"}}
+
+	testCases := []struct {
+		description string
+		snapshot    *restic.Snapshot
+		path        string
+		expected    bool
+	}{
+		{description: "backed up path", path: "/var/lib/data", expected: true},
+		{description: "path inside a backed up path", path: "/var/lib/data/db/file", expected: true},
+		{description: "trailing slash", path: "/var/lib/data/", expected: true},
+		{description: "backed up path with trailing slash", path: "/etc/config/app.yaml", expected: true},
+		{description: "unclean path", path: "/var/lib/./data/../data/db", expected: true},
+		{description: "parent of a backed up path", path: "/var/lib", expected: false},
+		{description: "sibling with the same prefix", path: "/var/lib/database", expected: false},
+		{description: "unrelated path", path: "/tmp", expected: false},
+		{description: "backed up root", snapshot: &restic.Snapshot{Paths: []string{"/"}}, path: "/data", expected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			s := snapshot
+			if tc.snapshot != nil {
+				s = *tc.snapshot
+			}
+			if found := restic.SnapshotContainsPath(s, tc.path); found != tc.expected {
+				t.Errorf("expected %v, found %v", tc.expected, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,626 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	repov1alpha1 "stash.appscode.dev/apimachinery/apis/repositories/v1alpha1"
+	"stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/resolver"
+	"stash.appscode.dev/stash/pkg/util"
+
+	"github.com/spf13/cobra"
+	"gomodules.xyz/pointer"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+	rbac_util "kmodules.xyz/client-go/rbac/v1"
+	ofst "kmodules.xyz/offshoot-api/api/v1"
+)
+
+const (
+	pvcRestoreFunction = "pvc-restore"
+
+	// restoredSnapshotAnnotation records the snapshot that is being restored into a PVC created by "stash restore pvc"
+	restoredSnapshotAnnotation = "restore.stash.appscode.com/snapshot"
+	// restoreOutputDir is the directory where the restore Job writes its output
+	restoreOutputDir = "/stash-output"
+
+	restoreJobPollInterval = 2 * time.Second
+	restoreJobPodTimeout   = 10 * time.Minute
+)
+
+type restoreToPVCOptions struct {
+	kubeClient  kubernetes.Interface
+	stashClient cs.Interface
+
+	masterURL      string
+	kubeConfigPath string
+
+	repo           string
+	snapshot       string
+	pointInTime    string
+	hostname       string
+	pvcName        string
+	namespace      string
+	storageClass   string
+	size           string
+	accessModes    []string
+	serviceAccount string
+}
+
+// NewCmdRestoreToPVC restores a snapshot into a new PVC using a one-off restore Job.
+// Unlike "restore-pvc", it does not need any restore invoker and it is meant to be run by the users.
+func NewCmdRestoreToPVC() *cobra.Command {
+	opt := restoreToPVCOptions{
+		accessModes: []string{string(core.ReadWriteOnce)},
+	}
+
+	cmd := &cobra.Command{
+		Use:               "pvc",
+		Short:             "Restore a snapshot into a new PersistentVolumeClaim",
+		Example:           "stash restore pvc --repo demo/gcs-repo --snapshot 4bc21d6f --to-pvc restored-data --size 10Gi --storage-class standard",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opt.repo == "" || opt.pvcName == "" || opt.size == "" {
+				return fmt.Errorf("--repo, --to-pvc and --size flags are required")
+			}
+			if (opt.snapshot == "") == (opt.pointInTime == "") {
+				return fmt.Errorf("exactly one of the --snapshot and --point-in-time flags is required")
+			}
+
+			config, err := clientcmd.BuildConfigFromFlags(opt.masterURL, opt.kubeConfigPath)
+			if err != nil {
+				return err
+			}
+			opt.kubeClient = kubernetes.NewForConfigOrDie(config)
+			opt.stashClient = cs.NewForConfigOrDie(config)
+
+			stats, err := opt.restore()
+			if err != nil {
+				return err
+			}
+			if err := printJSON(stats); err != nil {
+				return err
+			}
+			if stats.Phase != api_v1beta1.HostRestoreSucceeded {
+				return fmt.Errorf("failed to restore snapshot %s into PVC %s/%s", opt.snapshot, opt.namespace, opt.pvcName)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.masterURL, "master", opt.masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
+	cmd.Flags().StringVar(&opt.kubeConfigPath, "kubeconfig", opt.kubeConfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
+	cmd.Flags().StringVar(&opt.repo, "repo", opt.repo, "Repository to restore from in <namespace>/<name> format")
+	cmd.Flags().StringVar(&opt.snapshot, "snapshot", opt.snapshot, "ID of the snapshot to restore")
+	cmd.Flags().StringVar(&opt.pointInTime, "point-in-time", opt.pointInTime, "Restore the newest snapshot taken at or before this time (RFC3339 format, i.e. 2024-01-02T14:05:00Z)")
+	cmd.Flags().StringVar(&opt.hostname, "hostname", opt.hostname, "Host whose snapshot will be chosen by --point-in-time (default is any host)")
+	cmd.Flags().StringVar(&opt.pvcName, "to-pvc", opt.pvcName, "Name of the PVC to create and restore into")
+	cmd.Flags().StringVar(&opt.namespace, "namespace", opt.namespace, "Namespace of the PVC (default is the namespace of the Repository)")
+	cmd.Flags().StringVar(&opt.storageClass, "storage-class", opt.storageClass, "StorageClass of the PVC (default is the default StorageClass of the cluster)")
+	cmd.Flags().StringVar(&opt.size, "size", opt.size, "Requested storage size of the PVC (i.e. 10Gi)")
+	cmd.Flags().StringSliceVar(&opt.accessModes, "access-modes", opt.accessModes, "Access modes of the PVC")
+	cmd.Flags().StringVar(&opt.serviceAccount, "service-account", opt.serviceAccount, "ServiceAccount of the restore Job. It must be able to read the storage Secret of the Repository. If empty, a temporary ServiceAccount will be created.")
+
+	return cmd
+}
+
+// restore creates the PVC, the temporary RBAC resources and the restore Job. The resources are cleaned up in
+// the reverse order of their creation once the restore is finished. The PVC is kept only if the restore succeeds.
+// The resources left by an interrupted run are reused, so the command can be run again with the same flags.
+func (opt *restoreToPVCOptions) restore() (stats *api_v1beta1.HostRestoreStats, err error) {
+	var cleanups []func()
+	defer func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}()
+
+	repoNamespace, repoName, found := strings.Cut(opt.repo, "/")
+	if !found || repoNamespace == "" || repoName == "" {
+		return nil, fmt.Errorf("invalid repository %q. Use <namespace>/<name> format", opt.repo)
+	}
+	if opt.namespace == "" {
+		opt.namespace = repoNamespace
+	}
+	if opt.pointInTime != "" {
+		if err := opt.resolvePointInTime(repoNamespace, repoName); err != nil {
+			return nil, err
+		}
+	}
+	if len(opt.snapshot) < apis.SnapshotIDLength {
+		return nil, fmt.Errorf("snapshot ID must be at least %d characters long", apis.SnapshotIDLength)
+	}
+
+	repo, err := opt.stashClient.StashV1alpha1().Repositories(repoNamespace).Get(context.TODO(), repoName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := opt.stashClient.RepositoriesV1alpha1().Snapshots(repoNamespace).Get(context.TODO(), meta_util.NameWithSuffix(repoName, opt.snapshot[:apis.SnapshotIDLength]), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the PVC can be mounted only at a single path
+	if len(snapshot.Status.Paths) != 1 {
+		return nil, fmt.Errorf("snapshot %s contains %d paths. Only the snapshots of a single path can be restored into a PVC", opt.snapshot, len(snapshot.Status.Paths))
+	}
+	fn, err := opt.stashClient.StashV1beta1().Functions().Get(context.TODO(), pvcRestoreFunction, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := opt.ensurePVC(string(snapshot.UID))
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		cleanups = append(cleanups, func() {
+			if stats == nil || stats.Phase != api_v1beta1.HostRestoreSucceeded {
+				opt.deletePVC()
+			}
+		})
+	}
+
+	serviceAccount := opt.serviceAccount
+	if serviceAccount == "" {
+		serviceAccount = meta_util.ValidNameWithPrefix("restore-pvc", opt.pvcName)
+		if err := opt.ensureTemporaryRBAC(serviceAccount, repo, &cleanups); err != nil {
+			return nil, err
+		}
+	}
+
+	job, err := opt.createRestoreJob(repo, string(snapshot.UID), snapshot.Status.Paths[0], fn.Spec.Image, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+	cleanups = append(cleanups, func() { opt.deleteRestoreJob(job.Name) })
+	klog.Infof("Restore Job %s/%s has been created", job.Namespace, job.Name)
+
+	if err := opt.streamLogs(job); err != nil {
+		klog.Warningf("Failed to stream the logs of the restore Job. Reason: %v", err)
+	}
+	return opt.waitForCompletion(job)
+}
+
+// resolvePointInTime chooses the newest snapshot of the Repository taken at or before the point in time.
+func (opt *restoreToPVCOptions) resolvePointInTime(repoNamespace, repoName string) error {
+	pointInTime, err := parsePointInTime(opt.pointInTime)
+	if err != nil {
+		return err
+	}
+	selector := map[string]string{"repository": repoName}
+	if opt.hostname != "" {
+		selector["hostname"] = opt.hostname
+	}
+	snapshots, err := opt.stashClient.RepositoriesV1alpha1().Snapshots(repoNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		return err
+	}
+	var newest *repov1alpha1.Snapshot
+	for i, snapshot := range snapshots.Items {
+		if snapshot.CreationTimestamp.After(*pointInTime) {
+			continue
+		}
+		if newest == nil || snapshot.CreationTimestamp.After(newest.CreationTimestamp.Time) {
+			newest = &snapshots.Items[i]
+		}
+	}
+	if newest == nil {
+		return fmt.Errorf("no snapshot of Repository %s/%s has been taken at or before %s", repoNamespace, repoName, opt.pointInTime)
+	}
+	klog.Infof("Restoring snapshot %s taken at %s", newest.UID, newest.CreationTimestamp.Format(time.RFC3339))
+	opt.snapshot = string(newest.UID)
+	return nil
+}
+
+// ensurePVC creates the PVC to restore into. A PVC left by an earlier run for the same snapshot is reused,
+// but any other existing PVC is never overwritten. It returns true if the PVC has been created by this run.
+func (opt *restoreToPVCOptions) ensurePVC(snapshotID string) (bool, error) {
+	cur, err := opt.kubeClient.CoreV1().PersistentVolumeClaims(opt.namespace).Get(context.TODO(), opt.pvcName, metav1.GetOptions{})
+	if err == nil {
+		if cur.Annotations[restoredSnapshotAnnotation] != snapshotID {
+			return false, fmt.Errorf("PVC %s/%s already exists", opt.namespace, opt.pvcName)
+		}
+		klog.Infof("Reusing PVC %s/%s created by an earlier run", opt.namespace, opt.pvcName)
+		return false, nil
+	}
+	if !kerr.IsNotFound(err) {
+		return false, err
+	}
+
+	size, err := resource.ParseQuantity(opt.size)
+	if err != nil {
+		return false, fmt.Errorf("invalid PVC size %q. Reason: %v", opt.size, err)
+	}
+	template := ofst.PersistentVolumeClaim{
+		PartialObjectMeta: ofst.PartialObjectMeta{
+			Name:      opt.pvcName,
+			Namespace: opt.namespace,
+			Annotations: map[string]string{
+				restoredSnapshotAnnotation: snapshotID,
+			},
+		},
+		Spec: core.PersistentVolumeClaimSpec{
+			Resources: core.VolumeResourceRequirements{
+				Requests: core.ResourceList{
+					core.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	for _, mode := range opt.accessModes {
+		template.Spec.AccessModes = append(template.Spec.AccessModes, core.PersistentVolumeAccessMode(mode))
+	}
+	if opt.storageClass != "" {
+		template.Spec.StorageClassName = pointer.StringP(opt.storageClass)
+	}
+
+	pvcList, err := resolver.VolumeTemplateOptions{
+		VolumeTemplates: []ofst.PersistentVolumeClaim{template},
+	}.Resolve()
+	if err != nil {
+		return false, err
+	}
+	if err := util.CreateBatchPVC(opt.kubeClient, opt.namespace, pvcList); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (opt *restoreToPVCOptions) deletePVC() {
+	if err := opt.kubeClient.CoreV1().PersistentVolumeClaims(opt.namespace).Delete(context.TODO(), opt.pvcName, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+		klog.Warningf("Failed to delete PVC %s/%s. Reason: %v", opt.namespace, opt.pvcName, err)
+	}
+}
+
+// ensureTemporaryRBAC creates a ServiceAccount for the restore Job that is only allowed to read the storage Secret of the Repository.
+// The deletion of each resource is added to the cleanups as soon as the resource exists.
+func (opt *restoreToPVCOptions) ensureTemporaryRBAC(name string, repo *v1alpha1.Repository, cleanups *[]func()) error {
+	_, _, err := core_util.CreateOrPatchServiceAccount(
+		context.TODO(),
+		opt.kubeClient,
+		metav1.ObjectMeta{Name: name, Namespace: opt.namespace},
+		func(in *core.ServiceAccount) *core.ServiceAccount {
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	if err != nil {
+		return err
+	}
+	*cleanups = append(*cleanups, func() {
+		if err := opt.kubeClient.CoreV1().ServiceAccounts(opt.namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+			klog.Warningf("Failed to delete ServiceAccount %s/%s. Reason: %v", opt.namespace, name, err)
+		}
+	})
+
+	_, _, err = rbac_util.CreateOrPatchRole(
+		context.TODO(),
+		opt.kubeClient,
+		metav1.ObjectMeta{Name: name, Namespace: repo.Namespace},
+		func(in *rbac.Role) *rbac.Role {
+			in.Rules = []rbac.PolicyRule{
+				{
+					APIGroups:     []string{core.GroupName},
+					Resources:     []string{"secrets"},
+					ResourceNames: []string{repo.Spec.Backend.StorageSecretName},
+					Verbs:         []string{"get"},
+				},
+			}
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	if err != nil {
+		return err
+	}
+	*cleanups = append(*cleanups, func() {
+		if err := opt.kubeClient.RbacV1().Roles(repo.Namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+			klog.Warningf("Failed to delete Role %s/%s. Reason: %v", repo.Namespace, name, err)
+		}
+	})
+
+	_, _, err = rbac_util.CreateOrPatchRoleBinding(
+		context.TODO(),
+		opt.kubeClient,
+		metav1.ObjectMeta{Name: name, Namespace: repo.Namespace},
+		func(in *rbac.RoleBinding) *rbac.RoleBinding {
+			in.RoleRef = rbac.RoleRef{
+				APIGroup: rbac.GroupName,
+				Kind:     "Role",
+				Name:     name,
+			}
+			in.Subjects = []rbac.Subject{
+				{
+					Kind:      rbac.ServiceAccountKind,
+					Name:      name,
+					Namespace: opt.namespace,
+				},
+			}
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	if err != nil {
+		return err
+	}
+	*cleanups = append(*cleanups, func() {
+		if err := opt.kubeClient.RbacV1().RoleBindings(repo.Namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+			klog.Warningf("Failed to delete RoleBinding %s/%s. Reason: %v", repo.Namespace, name, err)
+		}
+	})
+	return nil
+}
+
+func (opt *restoreToPVCOptions) createRestoreJob(repo *v1alpha1.Repository, snapshotID, mountPath, image, serviceAccount string) (*batch.Job, error) {
+	setupOpt, err := util.SetupOptionsForRepository(*repo, util.ExtraOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	name := meta_util.ValidNameWithPrefix("restore-pvc", opt.pvcName)
+	if err := opt.removeFinishedRestoreJob(name); err != nil {
+		return nil, err
+	}
+
+	const (
+		targetVolume  = "target"
+		scratchVolume = "scratch"
+	)
+	job := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opt.namespace,
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit: pointer.Int32P(0),
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					RestartPolicy:      core.RestartPolicyNever,
+					ServiceAccountName: serviceAccount,
+					Containers: []core.Container{
+						{
+							Name:  pvcRestoreFunction,
+							Image: image,
+							Args: []string{
+								"restore-pvc",
+								"--provider=" + setupOpt.Provider,
+								"--bucket=" + setupOpt.Bucket,
+								"--endpoint=" + setupOpt.Endpoint,
+								fmt.Sprintf("--insecure-tls=%t", setupOpt.InsecureTLS),
+								"--region=" + setupOpt.Region,
+								"--path=" + setupOpt.Path,
+								"--enable-cache=false",
+								fmt.Sprintf("--max-connections=%d", setupOpt.MaxConnections),
+								"--snapshots=" + snapshotID,
+								"--storage-secret-name=" + repo.Spec.Backend.StorageSecretName,
+								"--storage-secret-namespace=" + repo.Namespace,
+								"--target-kind=" + apis.KindPersistentVolumeClaim,
+								"--target-name=" + opt.pvcName,
+								"--target-namespace=" + opt.namespace,
+								"--scratch-dir=" + restic.DefaultScratchDir,
+								"--output-dir=" + restoreOutputDir,
+							},
+							// the restore output is reported back through the termination message of the container
+							TerminationMessagePath: filepath.Join(restoreOutputDir, restic.DefaultOutputFileName),
+							VolumeMounts: []core.VolumeMount{
+								{
+									Name:      targetVolume,
+									MountPath: mountPath,
+								},
+								{
+									Name:      scratchVolume,
+									MountPath: restic.DefaultScratchDir,
+								},
+							},
+						},
+					},
+					Volumes: []core.Volume{
+						{
+							Name: targetVolume,
+							VolumeSource: core.VolumeSource{
+								PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+									ClaimName: opt.pvcName,
+								},
+							},
+						},
+						{
+							Name: scratchVolume,
+							VolumeSource: core.VolumeSource{
+								EmptyDir: &core.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return opt.kubeClient.BatchV1().Jobs(opt.namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+}
+
+// removeFinishedRestoreJob deletes the restore Job left by an earlier run so that it can be created again.
+// A restore Job that is still running is never deleted.
+func (opt *restoreToPVCOptions) removeFinishedRestoreJob(name string) error {
+	cur, err := opt.kubeClient.BatchV1().Jobs(opt.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !jobFinished(cur) {
+		return fmt.Errorf("restore Job %s/%s of an earlier run is still running", opt.namespace, name)
+	}
+	opt.deleteRestoreJob(name)
+	return wait.PollUntilContextTimeout(context.Background(), restoreJobPollInterval, restoreJobPodTimeout, true, func(ctx context.Context) (bool, error) {
+		_, err := opt.kubeClient.BatchV1().Jobs(opt.namespace).Get(ctx, name, metav1.GetOptions{})
+		return kerr.IsNotFound(err), nil
+	})
+}
+
+func (opt *restoreToPVCOptions) deleteRestoreJob(name string) {
+	err := opt.kubeClient.BatchV1().Jobs(opt.namespace).Delete(context.TODO(), name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		klog.Warningf("Failed to delete Job %s/%s. Reason: %v", opt.namespace, name, err)
+	}
+}
+
+func jobFinished(job *batch.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status == core.ConditionTrue && (cond.Type == batch.JobComplete || cond.Type == batch.JobFailed) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamLogs follows the logs of the pod of the restore Job until the container terminates.
+func (opt *restoreToPVCOptions) streamLogs(job *batch.Job) error {
+	var podName string
+	err := wait.PollUntilContextTimeout(context.Background(), restoreJobPollInterval, restoreJobPodTimeout, true, func(ctx context.Context) (bool, error) {
+		pods, err := opt.kubeClient.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", batch.JobNameLabel, job.Name),
+		})
+		if err != nil {
+			return false, nil
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != core.PodPending {
+				podName = pod.Name
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	stream, err := opt.kubeClient.CoreV1().Pods(job.Namespace).GetLogs(podName, &core.PodLogOptions{Follow: true}).Stream(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = io.Copy(os.Stdout, stream)
+	return err
+}
+
+// waitForCompletion waits for the restore Job to finish and returns the restore statistics reported by the Job.
+// The statistics are built from the Job conditions only if the Job could not report them (i.e. it failed before restoring).
+func (opt *restoreToPVCOptions) waitForCompletion(job *batch.Job) (*api_v1beta1.HostRestoreStats, error) {
+	stats := &api_v1beta1.HostRestoreStats{
+		Hostname: restic.DefaultHost,
+	}
+	err := wait.PollUntilContextTimeout(context.Background(), restoreJobPollInterval, 24*time.Hour, true, func(ctx context.Context) (bool, error) {
+		cur, err := opt.kubeClient.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		for _, cond := range cur.Status.Conditions {
+			if cond.Status != core.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batch.JobComplete:
+				stats.Phase = api_v1beta1.HostRestoreSucceeded
+			case batch.JobFailed:
+				stats.Phase = api_v1beta1.HostRestoreFailed
+				stats.Error = cond.Message
+			default:
+				continue
+			}
+			if cur.Status.StartTime != nil {
+				stats.Duration = cond.LastTransitionTime.Sub(cur.Status.StartTime.Time).String()
+			}
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	reported, err := opt.readRestoreOutput(job)
+	if err != nil {
+		klog.Warningf("Failed to read the restore output of Job %s/%s. Reason: %v", job.Namespace, job.Name, err)
+		return stats, nil
+	}
+	if reported == nil {
+		return stats, nil
+	}
+	// the Job may fail after restic has finished, so a failure of the Job always takes precedence
+	if stats.Phase == api_v1beta1.HostRestoreFailed && reported.Phase != api_v1beta1.HostRestoreFailed {
+		reported.Phase = stats.Phase
+		reported.Error = stats.Error
+	}
+	return reported, nil
+}
+
+// readRestoreOutput returns the restore statistics written into the termination message of the restore container.
+// It returns nil if the container did not report any output.
+func (opt *restoreToPVCOptions) readRestoreOutput(job *batch.Job) (*api_v1beta1.HostRestoreStats, error) {
+	pods, err := opt.kubeClient.CoreV1().Pods(job.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", batch.JobNameLabel, job.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != pvcRestoreFunction || status.State.Terminated == nil || status.State.Terminated.Message == "" {
+				continue
+			}
+			var output restic.RestoreOutput
+			if err := json.Unmarshal([]byte(status.State.Terminated.Message), &output); err != nil {
+				return nil, err
+			}
+			if len(output.RestoreTargetStatus.Stats) == 0 {
+				return nil, nil
+			}
+			return &output.RestoreTargetStatus.Stats[0], nil
+		}
+	}
+	return nil, nil
+}
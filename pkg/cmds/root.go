@@ -53,6 +53,8 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(NewCmdCreateBackupSession())
 	rootCmd.AddCommand(NewCmdRestore())
 	rootCmd.AddCommand(NewCmdRunBackup())
+	rootCmd.AddCommand(NewCmdRepository())
+	rootCmd.AddCommand(NewCmdMaintainRepository())
 
 	rootCmd.AddCommand(NewCmdBackupPVC())
 	rootCmd.AddCommand(NewCmdRestorePVC())
@@ -51,11 +51,15 @@ func NewCmdRunBackup() *cobra.Command {
 		},
 	}
 
+	var workloadAdapters []string
 	cmd := &cobra.Command{
 		Use:               "run-backup",
 		Short:             "Take backup of workload paths",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := registerWorkloadAdapters(workloadAdapters); err != nil {
+				return err
+			}
 			config, err := clientcmd.BuildConfigFromFlags(opt.MasterURL, opt.KubeconfigPath)
 			if err != nil {
 				klog.Fatalf("Could not get Kubernetes config: %s", err)
@@ -114,10 +118,25 @@ func NewCmdRunBackup() *cobra.Command {
 	cmd.Flags().Int64Var(&opt.SetupOpt.MaxConnections, "max-connections", opt.SetupOpt.MaxConnections, "Specify maximum concurrent connections for GCS, Azure and B2 backend")
 	cmd.Flags().BoolVar(&opt.Metrics.Enabled, "metrics-enabled", opt.Metrics.Enabled, "Specify whether to export Prometheus metrics")
 	cmd.Flags().StringVar(&opt.Metrics.PushgatewayURL, "pushgateway-url", opt.Metrics.PushgatewayURL, "URL of Prometheus pushgateway used to cache backup metrics")
+	cmd.Flags().StringArrayVar(&workloadAdapters, "workload-adapter", workloadAdapters, "Workload adapter of the target when it is not a built-in workload")
 
 	return cmd
 }
 
+// registerWorkloadAdapters registers the workload adapters passed by the operator to the sidecar or init-container
+func registerWorkloadAdapters(values []string) error {
+	for _, v := range values {
+		a, err := util.ParseWorkloadAdapter(v)
+		if err != nil {
+			return err
+		}
+		if err := util.RegisterWorkloadAdapter(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func targetMatched(tref v1beta1.TargetRef, expectedKind, expectedName, expectedNamespace string) bool {
 	return tref.Kind == expectedKind && tref.Namespace == expectedNamespace && tref.Name == expectedName
 }
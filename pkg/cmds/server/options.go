@@ -26,6 +26,7 @@ import (
 	"stash.appscode.dev/apimachinery/pkg/metrics"
 	"stash.appscode.dev/apimachinery/pkg/restic"
 	"stash.appscode.dev/stash/pkg/controller"
+	"stash.appscode.dev/stash/pkg/util"
 
 	"github.com/spf13/pflag"
 	licenseapi "go.bytebuilders.dev/license-verifier/apis/licenses/v1alpha1"
@@ -33,6 +34,7 @@ import (
 	license "go.bytebuilders.dev/license-verifier/kubernetes"
 	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"kmodules.xyz/client-go/discovery"
 	appcatalog_cs "kmodules.xyz/custom-resources/client/clientset/versioned"
@@ -41,24 +43,30 @@ import (
 )
 
 type ExtraOptions struct {
-	LicenseFile             string
-	LicenseApiService       string
-	StashImage              string
-	StashImageTag           string
-	DockerRegistry          string
-	ImagePullSecrets        []string
-	MaxNumRequeues          int
-	NumThreads              int
-	ScratchDir              string
-	QPS                     float64
-	Burst                   int
-	ResyncPeriod            time.Duration
-	EnableValidatingWebhook bool
-	EnableMutatingWebhook   bool
-	CronJobPSPNames         []string
-	BackupJobPSPNames       []string
-	RestoreJobPSPNames      []string
-	PushgatewayURL          string
+	LicenseFile                 string
+	LicenseApiService           string
+	StashImage                  string
+	StashImageTag               string
+	DockerRegistry              string
+	ImagePullSecrets            []string
+	MaxNumRequeues              int
+	NumThreads                  int
+	ScratchDir                  string
+	QPS                         float64
+	Burst                       int
+	ResyncPeriod                time.Duration
+	EnableValidatingWebhook     bool
+	EnableMutatingWebhook       bool
+	CronJobPSPNames             []string
+	BackupJobPSPNames           []string
+	RestoreJobPSPNames          []string
+	PushgatewayURL              string
+	SchedulerMode               string
+	NodeUploadLimit             int32
+	NodeDownloadLimit           int32
+	NodeBandwidthSlots          int32
+	MaxConcurrentBackupSessions int32
+	WorkloadAdapters            []string
 }
 
 func NewExtraOptions() *ExtraOptions {
@@ -72,6 +80,9 @@ func NewExtraOptions() *ExtraOptions {
 		QPS:            100,
 		Burst:          100,
 		ResyncPeriod:   10 * time.Minute,
+		SchedulerMode:  controller.SchedulerModeCronJob,
+
+		NodeBandwidthSlots: 4,
 	}
 }
 
@@ -96,6 +107,14 @@ func (s *ExtraOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&s.RestoreJobPSPNames, "restore-job-psp", s.RestoreJobPSPNames, "Name of the PSPs for restore job. Use comma to separate multiple PSP names.")
 
 	fs.StringVar(&s.PushgatewayURL, "pushgateway-url", s.PushgatewayURL, "URL of the Prometheus pushgateway where backup metrics will be pushed.")
+
+	fs.StringVar(&s.SchedulerMode, "scheduler-mode", s.SchedulerMode, "How the scheduled backups are triggered. Use 'cronjob' to create a CronJob for each BackupConfiguration or 'in-process' to trigger the backups from the operator.")
+
+	fs.Int32Var(&s.NodeUploadLimit, "node-upload-limit", s.NodeUploadLimit, "Upload bandwidth in KiB/s shared by all the backup and restore processes running on a node. Zero means unlimited. Setting a node limit mounts the hostPath directory /var/run/stash/bandwidth into the backup and restore pods, which the baseline and restricted Pod Security Standards do not allow.")
+	fs.Int32Var(&s.NodeDownloadLimit, "node-download-limit", s.NodeDownloadLimit, "Download bandwidth in KiB/s shared by all the backup and restore processes running on a node. Zero means unlimited. Setting a node limit mounts the hostPath directory /var/run/stash/bandwidth into the backup and restore pods, which the baseline and restricted Pod Security Standards do not allow.")
+	fs.Int32Var(&s.NodeBandwidthSlots, "node-bandwidth-slots", s.NodeBandwidthSlots, "Number of backup and restore processes that can use the node bandwidth simultaneously. Each of them gets an equal share of the node limits and the others wait for a free slot.")
+	fs.Int32Var(&s.MaxConcurrentBackupSessions, "max-concurrent-backup-sessions", s.MaxConcurrentBackupSessions, "Maximum number of BackupSessions that can run simultaneously in the cluster. Zero means unlimited.")
+	fs.StringArrayVar(&s.WorkloadAdapters, "workload-adapter", s.WorkloadAdapters, "Register a resource that owns a long running pod template as a backup and restore target. Jobs and CronJobs are not supported. Format: 'kind=<Kind>.<version>.<group>;resource=<plural>;template=<JSONPath>[;replicas=<JSONPath>][;hosts=Single|Ordinal]'. Repeat the flag to register multiple resources.")
 }
 
 func (s *ExtraOptions) ApplyTo(cfg *controller.Config) error {
@@ -118,6 +137,8 @@ func (s *ExtraOptions) ApplyTo(cfg *controller.Config) error {
 	cfg.CronJobPSPNames = s.CronJobPSPNames
 	cfg.BackupJobPSPNames = s.BackupJobPSPNames
 	cfg.RestoreJobPSPNames = s.RestoreJobPSPNames
+	cfg.SchedulerMode = s.SchedulerMode
+	cfg.MaxConcurrentBackupSessions = s.MaxConcurrentBackupSessions
 
 	if cfg.KubeClient, err = kubernetes.NewForConfig(cfg.ClientConfig); err != nil {
 		return err
@@ -131,6 +152,9 @@ func (s *ExtraOptions) ApplyTo(cfg *controller.Config) error {
 	if cfg.AppCatalogClient, err = appcatalog_cs.NewForConfig(cfg.ClientConfig); err != nil {
 		return err
 	}
+	if cfg.DynamicClient, err = dynamic.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
 
 	// if cluster has OpenShift DeploymentConfig then generate OcClient
 	if discovery.IsPreferredAPIResource(cfg.KubeClient.Discovery(), ocapps.GroupVersion.String(), apis.KindDeploymentConfig) {
@@ -151,6 +175,20 @@ func (s *ExtraOptions) ApplyTo(cfg *controller.Config) error {
 	}
 
 	metrics.SetPushgatewayURL(s.PushgatewayURL)
+	util.SetNodeBandwidthLimit(util.NodeBandwidthLimit{
+		Upload:   s.NodeUploadLimit,
+		Download: s.NodeDownloadLimit,
+		Slots:    s.NodeBandwidthSlots,
+	})
+	for _, v := range s.WorkloadAdapters {
+		a, err := util.ParseWorkloadAdapter(v)
+		if err != nil {
+			return err
+		}
+		if err := util.RegisterWorkloadAdapter(a); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -163,5 +201,22 @@ func (s *ExtraOptions) Validate() []error {
 	if s.StashImageTag == "" {
 		errs = append(errs, fmt.Errorf("--image-tag must be specified"))
 	}
+	if s.SchedulerMode != controller.SchedulerModeCronJob && s.SchedulerMode != controller.SchedulerModeInProcess {
+		errs = append(errs, fmt.Errorf("--scheduler-mode must be either %q or %q", controller.SchedulerModeCronJob, controller.SchedulerModeInProcess))
+	}
+	if s.MaxConcurrentBackupSessions < 0 {
+		errs = append(errs, fmt.Errorf("--max-concurrent-backup-sessions must not be negative"))
+	}
+	if s.NodeUploadLimit < 0 || s.NodeDownloadLimit < 0 {
+		errs = append(errs, fmt.Errorf("--node-upload-limit and --node-download-limit must not be negative"))
+	}
+	if s.NodeBandwidthSlots < 1 {
+		errs = append(errs, fmt.Errorf("--node-bandwidth-slots must be at least 1"))
+	}
+	for _, v := range s.WorkloadAdapters {
+		if _, err := util.ParseWorkloadAdapter(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --workload-adapter. Reason: %v", err))
+		}
+	}
 	return errs
 }
@@ -30,8 +30,10 @@ import (
 	licenseEnforcer "go.bytebuilders.dev/license-verifier/kubernetes"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	openapinamer "k8s.io/apiserver/pkg/endpoints/openapi"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	genericfilters "k8s.io/apiserver/pkg/server/filters"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
 	basecompatibility "k8s.io/component-base/compatibility"
 	"kmodules.xyz/client-go/tools/clientcmd"
@@ -120,6 +122,9 @@ func (o StashOptions) Config() (*server.StashConfig, error) {
 	serverConfig.OpenAPIV3Config.Info.Version = v1alpha1.SchemeGroupVersion.Version
 	serverConfig.OpenAPIV3Config.IgnorePrefixes = ignorePrefixes
 
+	// downloading content of a snapshot may take longer than the default request timeout
+	serverConfig.LongRunningFunc = genericfilters.BasicLongRunningRequestCheck(sets.NewString("watch"), sets.NewString("download"))
+
 	extraConfig := controller.NewConfig(serverConfig.ClientConfig)
 	if err := o.ExtraOptions.ApplyTo(extraConfig); err != nil {
 		return nil, err
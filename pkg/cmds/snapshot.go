@@ -43,50 +43,78 @@ func NewCmdSnapshots() *cobra.Command {
 		Short:             "Get snapshots of restic repo",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			config, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfigPath)
+			r, opt, err := newSnapshotOptions(masterURL, kubeconfigPath, repo, args)
 			if err != nil {
 				return err
 			}
-
-			stashClient := cs.NewForConfigOrDie(config)
-			kubeClient := kubernetes.NewForConfigOrDie(config)
-
-			if repo.Name == "" {
-				return fmt.Errorf("repository name not found")
-			}
-			repo, err := stashClient.Repositories(repo.Namespace).Get(context.TODO(), repo.Name, metav1.GetOptions{})
-			if err != nil {
-				return err
-			}
-
-			secret, err := kubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+			snapshots, err := r.GetSnapshotsFromBackned(*opt)
 			if err != nil {
 				return err
 			}
+			return printJSON(snapshots)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&masterURL, "master", masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
+	cmd.PersistentFlags().StringVar(&kubeconfigPath, "kubeconfig", kubeconfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
+	cmd.PersistentFlags().StringVar(&repo.Name, "repo-name", repo.Name, "Name of the Repository CRD.")
+	cmd.PersistentFlags().StringVar(&repo.Namespace, "repo-namespace", repo.Namespace, "Namespace of the Repository CRD.")
 
-			opt := snapshot.Options{
-				Repository:  repo,
-				Secret:      secret,
-				SnapshotIDs: args,
-				InCluster:   true,
-			}
-			r := snapshot.NewREST(config)
-			snapshots, err := r.GetSnapshotsFromBackned(opt)
+	cmd.AddCommand(&cobra.Command{
+		Use:               "diff <snapshotID> <snapshotID>",
+		Short:             "Show the changes between two snapshots of restic repo",
+		Args:              cobra.ExactArgs(2),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, opt, err := newSnapshotOptions(masterURL, kubeconfigPath, repo, args)
 			if err != nil {
 				return err
 			}
-			jsonSnaps, err := json.MarshalIndent(snapshots, "", "    ")
+			diff, err := r.DiffSnapshotsFromBackend(*opt)
 			if err != nil {
 				return err
 			}
-			fmt.Println(string(jsonSnaps))
-			return nil
+			return printJSON(diff.Status)
 		},
-	}
-	cmd.Flags().StringVar(&masterURL, "master", masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
-	cmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", kubeconfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
-	cmd.Flags().StringVar(&repo.Name, "repo-name", repo.Name, "Name of the Repository CRD.")
-	cmd.Flags().StringVar(&repo.Namespace, "repo-namespace", repo.Namespace, "Namespace of the Repository CRD.")
+	})
 
 	return cmd
 }
+
+func newSnapshotOptions(masterURL, kubeconfigPath string, ref kmapi.ObjectReference, snapshotIDs []string) (*snapshot.REST, *snapshot.Options, error) {
+	config, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stashClient := cs.NewForConfigOrDie(config)
+	kubeClient := kubernetes.NewForConfigOrDie(config)
+
+	if ref.Name == "" {
+		return nil, nil, fmt.Errorf("repository name not found")
+	}
+	repo, err := stashClient.Repositories(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return snapshot.NewREST(config), &snapshot.Options{
+		Repository:  repo,
+		Secret:      secret,
+		SnapshotIDs: snapshotIDs,
+		InCluster:   true,
+	}, nil
+}
+
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
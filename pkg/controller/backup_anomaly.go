@@ -0,0 +1,199 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/conditions"
+	"stash.appscode.dev/apimachinery/pkg/metrics"
+	"stash.appscode.dev/stash/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	condutil "kmodules.xyz/client-go/conditions"
+)
+
+const (
+	defaultBaselineSessions       = 5
+	defaultUploadedSizeThreshold  = 200
+	defaultModifiedFilesThreshold = 90
+)
+
+func (r *backupSessionReconciler) shouldDetectBackupAnomaly() bool {
+	if r.invoker.GetAnomalyDetection() == nil || r.invoker.GetDriver() != api_v1beta1.ResticSnapshotter {
+		return false
+	}
+	if r.session.GetStatus().Phase != api_v1beta1.BackupSessionSucceeded {
+		return false
+	}
+	return !condutil.HasCondition(r.session.GetConditions(), api_v1beta1.BackupAnomalyDetected)
+}
+
+// detectBackupAnomaly compares the statistics of each target with the rolling baseline of the target
+// that is stored in the invoker status. Then, it records the current statistics in the baseline.
+func (r *backupSessionReconciler) detectBackupAnomaly() error {
+	var reasons []string
+	for _, target := range r.session.GetTargetStatus() {
+		if target.Phase != api_v1beta1.TargetBackupSucceeded {
+			continue
+		}
+		reason, err := r.detectTargetBackupAnomaly(target)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			reasons = append(reasons, fmt.Sprintf("%s %s/%s: %s", target.Ref.Kind, target.Ref.Namespace, target.Ref.Name, reason))
+		}
+	}
+
+	if len(reasons) == 0 {
+		return conditions.SetBackupAnomalyDetectedConditionToFalse(r.session)
+	}
+
+	reason := strings.Join(reasons, "; ")
+	r.logger.Info("Backup anomaly detected", apis.KeyReason, reason)
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceBackupSessionController,
+		r.session.GetBackupSession(),
+		core.EventTypeWarning,
+		eventer.EventReasonBackupAnomalyDetected,
+		fmt.Sprintf("Backup statistics deviated from the baseline. Reason: %s", reason),
+	)
+	return conditions.SetBackupAnomalyDetectedConditionToTrue(r.session, reason)
+}
+
+func (r *backupSessionReconciler) detectTargetBackupAnomaly(target api_v1beta1.BackupTargetStatus) (string, error) {
+	anomalyDetection := r.invoker.GetAnomalyDetection()
+
+	uploaded, err := metrics.UploadedBytes(target)
+	if err != nil {
+		return "", err
+	}
+	baseline := r.invoker.GetBackupBaseline(target.Ref)
+
+	var reasons []string
+	stats := metrics.BackupAnomalyStats{}
+	if baseline != nil {
+		if deviation, ok := uploadedSizeDeviation(uploaded, baseline.UploadedBytes); ok {
+			stats.UploadedSizeDeviation = deviation
+			threshold := int32(defaultUploadedSizeThreshold)
+			if anomalyDetection.UploadedSizeThreshold != nil {
+				threshold = *anomalyDetection.UploadedSizeThreshold
+			}
+			if stats.UploadedSizeDeviation > float64(threshold) {
+				reasons = append(reasons, fmt.Sprintf("uploaded size deviated %.0f%% from the baseline", stats.UploadedSizeDeviation))
+			}
+		}
+	}
+
+	totalFiles, modifiedFiles := fileCounts(target)
+	if totalFiles > 0 {
+		stats.ModifiedFilesPercentage = float64(modifiedFiles) / float64(totalFiles) * 100
+		threshold := int32(defaultModifiedFilesThreshold)
+		if anomalyDetection.ModifiedFilesThreshold != nil {
+			threshold = *anomalyDetection.ModifiedFilesThreshold
+		}
+		if stats.ModifiedFilesPercentage > float64(threshold) {
+			reasons = append(reasons, fmt.Sprintf("%.0f%% of the files were modified", stats.ModifiedFilesPercentage))
+		}
+	}
+	stats.Detected = len(reasons) > 0
+
+	metricsOpt := &metrics.MetricsOptions{
+		Enabled:        true,
+		PushgatewayURL: metrics.GetPushgatewayURL(),
+		JobName:        fmt.Sprintf("%s-%s-%s", strings.ToLower(r.invoker.GetTypeMeta().Kind), r.invoker.GetObjectMeta().Namespace, r.invoker.GetObjectMeta().Name),
+	}
+	if err := metricsOpt.SendBackupAnomalyMetrics(r.ctrl.clientConfig, r.invoker, target.Ref, stats); err != nil {
+		r.logger.Error(err, "Failed to send backup anomaly metrics")
+	}
+
+	if err := r.recordBackupBaseline(baseline, target.Ref, int64(uploaded)); err != nil {
+		return "", err
+	}
+	return strings.Join(reasons, ", "), nil
+}
+
+// recordBackupBaseline appends the uploaded size of the current session to the baseline of the target.
+// Only the most recent baselineSessions entries are kept.
+func (r *backupSessionReconciler) recordBackupBaseline(cur *api_v1beta1.TargetBackupBaseline, targetRef api_v1beta1.TargetRef, uploaded int64) error {
+	baseline := api_v1beta1.TargetBackupBaseline{Ref: targetRef}
+	if cur != nil {
+		baseline = *cur.DeepCopy()
+	}
+	if baseline.LastSession == r.session.GetObjectMeta().Name {
+		return nil
+	}
+
+	limit := int32(defaultBaselineSessions)
+	if r.invoker.GetAnomalyDetection().BaselineSessions != nil {
+		limit = *r.invoker.GetAnomalyDetection().BaselineSessions
+	}
+	baseline.UploadedBytes = appendToBaseline(baseline.UploadedBytes, uploaded, limit)
+	baseline.LastSession = r.session.GetObjectMeta().Name
+	return r.invoker.UpdateBackupBaseline(baseline)
+}
+
+// uploadedSizeDeviation returns the deviation (in percentage) of the uploaded size from the baseline average.
+// It returns false if the baseline has no usable average yet.
+func uploadedSizeDeviation(uploaded float64, baseline []int64) (float64, bool) {
+	avg := average(baseline)
+	if avg <= 0 {
+		return 0, false
+	}
+	return math.Abs(uploaded-avg) / avg * 100, true
+}
+
+// appendToBaseline appends the uploaded size to the baseline and keeps only the most recent limit entries.
+func appendToBaseline(baseline []int64, uploaded int64, limit int32) []int64 {
+	baseline = append(baseline, uploaded)
+	if extra := len(baseline) - int(limit); extra > 0 {
+		baseline = baseline[extra:]
+	}
+	return baseline
+}
+
+func fileCounts(target api_v1beta1.BackupTargetStatus) (int64, int64) {
+	var total, modified int64
+	for _, host := range target.Stats {
+		for _, snap := range host.Snapshots {
+			if snap.FileStats.TotalFiles != nil {
+				total += *snap.FileStats.TotalFiles
+			}
+			if snap.FileStats.ModifiedFiles != nil {
+				modified += *snap.FileStats.ModifiedFiles
+			}
+		}
+	}
+	return total, modified
+}
+
+func average(values []int64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,100 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+
+	"k8s.io/utils/ptr"
+)
+
+func TestUploadedSizeDeviation(t *testing.T) {
+	testCases := []struct {
+		description string
+		uploaded    float64
+		baseline    []int64
+		expected    float64
+		ok          bool
+	}{
+		{description: "no baseline", uploaded: 100, baseline: nil, ok: false},
+		{description: "zero baseline", uploaded: 100, baseline: []int64{0, 0}, ok: false},
+		{description: "same as baseline", uploaded: 100, baseline: []int64{100, 100}, expected: 0, ok: true},
+		{description: "three times the baseline", uploaded: 300, baseline: []int64{50, 150}, expected: 200, ok: true},
+		{description: "half of the baseline", uploaded: 50, baseline: []int64{100}, expected: 50, ok: true},
+		{description: "nothing uploaded", uploaded: 0, baseline: []int64{100}, expected: 100, ok: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			deviation, ok := uploadedSizeDeviation(tc.uploaded, tc.baseline)
+			if ok != tc.ok {
+				t.Fatalf("expected ok to be %v, found %v", tc.ok, ok)
+			}
+			if deviation != tc.expected {
+				t.Errorf("expected deviation %v, found %v", tc.expected, deviation)
+			}
+		})
+	}
+}
+
+func TestAppendToBaseline(t *testing.T) {
+	testCases := []struct {
+		description string
+		baseline    []int64
+		uploaded    int64
+		limit       int32
+		expected    []int64
+	}{
+		{description: "empty baseline", baseline: nil, uploaded: 10, limit: 3, expected: []int64{10}},
+		{description: "below limit", baseline: []int64{1, 2}, uploaded: 3, limit: 3, expected: []int64{1, 2, 3}},
+		{description: "drop oldest entry", baseline: []int64{1, 2, 3}, uploaded: 4, limit: 3, expected: []int64{2, 3, 4}},
+		{description: "limit lowered", baseline: []int64{1, 2, 3, 4, 5}, uploaded: 6, limit: 2, expected: []int64{5, 6}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if baseline := appendToBaseline(tc.baseline, tc.uploaded, tc.limit); !reflect.DeepEqual(baseline, tc.expected) {
+				t.Errorf("expected baseline %v, found %v", tc.expected, baseline)
+			}
+		})
+	}
+}
+
+func TestFileCounts(t *testing.T) {
+	target := api_v1beta1.BackupTargetStatus{
+		Stats: []api_v1beta1.HostBackupStats{
+			{
+				Snapshots: []api_v1beta1.SnapshotStats{
+					{FileStats: api_v1beta1.FileStats{TotalFiles: ptr.To[int64](10), ModifiedFiles: ptr.To[int64](2)}},
+					{FileStats: api_v1beta1.FileStats{TotalFiles: ptr.To[int64](5)}},
+				},
+			},
+			{
+				Snapshots: []api_v1beta1.SnapshotStats{
+					{FileStats: api_v1beta1.FileStats{TotalFiles: ptr.To[int64](5), ModifiedFiles: ptr.To[int64](5)}},
+				},
+			},
+		},
+	}
+	total, modified := fileCounts(target)
+	if total != 20 || modified != 7 {
+		t.Errorf("expected 20 total and 7 modified files, found %d total and %d modified files", total, modified)
+	}
+}
@@ -106,10 +106,43 @@ func (c *StashController) validateBackupConfiguration(bc *api_v1beta1.BackupConf
 		if err != nil {
 			return err
 		}
+		if err := api_v1alpha1.ValidateCompression(bc.Spec.Target.Compression, bc.Spec.Target.PackSize); err != nil {
+			return err
+		}
+	}
+	if err := validateSchedule(bc.Spec); err != nil {
+		return err
+	}
+	if err := validateBackupWindows(bc.Spec); err != nil {
+		return err
 	}
 	return c.validateAgainstUsagePolicy(bc.Spec.Repository, bc.Namespace)
 }
 
+func validateSchedule(spec api_v1beta1.BackupConfigurationSpec) error {
+	if spec.Schedule == "" {
+		if spec.TimeZone != "" {
+			if _, err := time.LoadLocation(spec.TimeZone); err != nil {
+				return fmt.Errorf("unknown time zone %q", spec.TimeZone)
+			}
+		}
+		return nil
+	}
+	_, err := scheduler.ParseScheduleInTimeZone(spec.Schedule, spec.TimeZone)
+	return err
+}
+
+func validateBackupWindows(spec api_v1beta1.BackupConfigurationSpec) error {
+	for _, windows := range [][]api_v1beta1.BackupWindow{spec.AllowedWindows, spec.BlackoutWindows} {
+		for _, w := range windows {
+			if _, err := scheduler.ParseBackupWindow(w, spec.TimeZone); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *StashController) initBackupConfigurationWatcher() {
 	c.bcInformer = c.stashInformerFactory.Stash().V1beta1().BackupConfigurations().Informer()
 	c.bcQueue = queue.New[any](api_v1beta1.ResourceKindBackupConfiguration, c.MaxNumRequeues, c.NumThreads, c.runBackupConfigurationProcessor)
@@ -233,8 +266,9 @@ func (r *backupInvokerReconciler) reconcile() error {
 			}
 
 			// For sidecar model, send event to the respective workload queue. The workload controller will ensure the stash sidecar.
-			if r.invoker.GetDriver() == api_v1beta1.ResticSnapshotter && util.BackupModel(tref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
+			if r.invoker.GetDriver() == api_v1beta1.ResticSnapshotter && util.BackupModel(tref.APIVersion, tref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
 				err := r.ctrl.sendEventToWorkloadQueue(
+					tref.APIVersion,
 					tref.Kind,
 					tref.Namespace,
 					tref.Name,
@@ -265,6 +299,19 @@ func (r *backupInvokerReconciler) ensurePeriodicScheduler(invokerRef *core.Objec
 		return err
 	}
 
+	if r.ctrl.SchedulerMode == SchedulerModeInProcess {
+		s := &scheduler.PeriodicScheduler{
+			KubeClient:  r.ctrl.kubeClient,
+			Invoker:     r.invoker,
+			RBACOptions: rbacOptions,
+		}
+		// remove the CronJob that might have been created before switching to the in-process scheduler
+		if err := s.Remove(); err != nil {
+			return err
+		}
+		return conditions.SetCronJobCreatedConditionForInProcessScheduler(r.invoker)
+	}
+
 	s := &scheduler.PeriodicScheduler{
 		KubeClient: r.ctrl.kubeClient,
 		Image: docker.Docker{
@@ -389,6 +436,7 @@ func (r *backupInvokerReconciler) cleanupBackupInvokerOffshoots(invokerRef *core
 	for _, targetInfo := range r.invoker.GetTargetInfo() {
 		if targetInfo.Target != nil && backupExecutorType(r.invoker, targetInfo) == executor.TypeSidecar {
 			err := r.ctrl.sendEventToWorkloadQueue(
+				targetInfo.Target.Ref.APIVersion,
 				targetInfo.Target.Ref.Kind,
 				targetInfo.Target.Ref.Namespace,
 				targetInfo.Target.Ref.Name,
@@ -508,7 +556,7 @@ func verifyCrossNamespacePermission(inv metav1.ObjectMeta, target api_v1beta1.Ta
 		return nil
 	}
 	if target.Kind == apis.KindPersistentVolumeClaim ||
-		util.BackupModel(target.Kind, taskName) == apis.ModelSidecar {
+		util.BackupModel(target.APIVersion, target.Kind, taskName) == apis.ModelSidecar {
 		return fmt.Errorf("cross-namespace target reference is not allowed for %q", target.Kind)
 	}
 	return nil
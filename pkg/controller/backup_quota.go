@@ -0,0 +1,238 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/conditions"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	condutil "kmodules.xyz/client-go/conditions"
+)
+
+// backupSlotTracker serializes the admission of the BackupSessions into the concurrency quotas.
+// It remembers the sessions that have been given a slot until the informer cache has caught up with them,
+// so that the workers do not hand out the same slot twice.
+type backupSlotTracker struct {
+	lock     sync.Mutex
+	admitted sets.Set[string]
+}
+
+// backupConcurrencyQuota limits the number of the simultaneously running BackupSessions that it matches.
+type backupConcurrencyQuota struct {
+	description string
+	limit       int32
+	matches     func(bs *api_v1beta1.BackupSession) bool
+}
+
+// shouldWaitForBackupSlot returns true if the BackupSession has not been given a backup slot yet.
+func (r *backupSessionReconciler) shouldWaitForBackupSlot() bool {
+	return r.isBackupPending() && !condutil.IsConditionTrue(r.session.GetConditions(), api_v1beta1.BackupSlotAvailable)
+}
+
+// waitForBackupSlot keeps the BackupSession Pending while a restore with a higher priority is using its Repository
+// and until all of its concurrency quotas have a free slot. The waiting sessions get the slots in the order of their
+// priority and then in the order they were created. It returns true once the backup is allowed to start.
+func (r *backupSessionReconciler) waitForBackupSlot() (bool, error) {
+	rs, err := r.getHigherPriorityRestoreSession()
+	if err != nil {
+		return false, err
+	}
+	if rs != nil {
+		message := fmt.Sprintf("Backup has been paused by RestoreSession %s/%s with a higher priority.", rs.Namespace, rs.Name)
+		r.logger.Info("Keeping backup pending", apis.KeyReason, message)
+		if !r.backupSlotUnavailableFor(api_v1beta1.PausedByHigherPriorityRestore) {
+			if err := conditions.SetBackupSlotAvailableConditionToFalse(r.session, api_v1beta1.PausedByHigherPriorityRestore, message, nil); err != nil {
+				return false, err
+			}
+		}
+		r.requeue(requeueTimeInterval)
+		return false, nil
+	}
+
+	quotas, err := r.getConcurrencyQuotas()
+	if err != nil {
+		return false, err
+	}
+	if len(quotas) == 0 {
+		return true, nil
+	}
+
+	tracker := &r.ctrl.backupSlots
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	// the informer cache may not have the slot of this session yet
+	if tracker.admitted.Has(r.key) {
+		return true, nil
+	}
+
+	sessions, err := r.ctrl.backupSessionLister.List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	tracker.forgetObserved(sessions)
+
+	cur := r.session.GetBackupSession()
+	var position int32
+	var message string
+	for _, quota := range quotas {
+		var holders, queued int32
+		for _, bs := range sessions {
+			if bs.UID == cur.UID || !quota.matches(bs) {
+				continue
+			}
+			if tracker.holdsBackupSlot(bs) {
+				holders++
+			} else if waitingForBackupSlot(bs) && r.aheadInBackupQueue(bs) {
+				queued++
+			}
+		}
+		if holders+queued >= quota.limit && queued+1 > position {
+			position = queued + 1
+			message = fmt.Sprintf("Waiting for a backup slot. %d session(s) of the %s are running and %d session(s) are ahead in the queue.",
+				holders,
+				quota.description,
+				queued,
+			)
+		}
+	}
+
+	if position > 0 {
+		r.logger.Info("Keeping backup pending", apis.KeyReason, message)
+		if cur.Status.QueuePosition == nil || *cur.Status.QueuePosition != position ||
+			!r.backupSlotUnavailableFor(api_v1beta1.ConcurrencyQuotaExceeded) {
+			if err := conditions.SetBackupSlotAvailableConditionToFalse(r.session, api_v1beta1.ConcurrencyQuotaExceeded, message, &position); err != nil {
+				return false, err
+			}
+		}
+		r.requeue(requeueTimeInterval)
+		return false, nil
+	}
+
+	if err := conditions.SetBackupSlotAvailableConditionToTrue(r.session); err != nil {
+		return false, err
+	}
+	tracker.admit(r.key)
+	return true, nil
+}
+
+// getConcurrencyQuotas returns the cluster-wide and the Repository quotas that apply to the BackupSession.
+func (r *backupSessionReconciler) getConcurrencyQuotas() ([]backupConcurrencyQuota, error) {
+	var quotas []backupConcurrencyQuota
+	if r.ctrl.MaxConcurrentBackupSessions > 0 {
+		quotas = append(quotas, backupConcurrencyQuota{
+			description: "cluster",
+			limit:       r.ctrl.MaxConcurrentBackupSessions,
+			matches: func(bs *api_v1beta1.BackupSession) bool {
+				return true
+			},
+		})
+	}
+
+	repoRef := r.invoker.GetRepoRef()
+	repository, err := r.ctrl.repoLister.Repositories(repoRef.Namespace).Get(repoRef.Name)
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return quotas, nil
+		}
+		return nil, err
+	}
+	if repository.Spec.MaxConcurrentSessions != nil {
+		references := repository.Status.References
+		quotas = append(quotas, backupConcurrencyQuota{
+			description: fmt.Sprintf("Repository %s/%s", repository.Namespace, repository.Name),
+			limit:       *repository.Spec.MaxConcurrentSessions,
+			matches: func(bs *api_v1beta1.BackupSession) bool {
+				return invokedByReference(bs, references)
+			},
+		})
+	}
+	return quotas, nil
+}
+
+func invokedByReference(bs *api_v1beta1.BackupSession, references []kmapi.TypedObjectReference) bool {
+	for _, ref := range references {
+		if ref.Kind == bs.Spec.Invoker.Kind && ref.Name == bs.Spec.Invoker.Name && ref.Namespace == bs.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// backupSlotUnavailableFor returns true if the BackupSession is already waiting for a backup slot for the given reason.
+func (r *backupSessionReconciler) backupSlotUnavailableFor(reason string) bool {
+	_, cond := condutil.GetCondition(r.session.GetConditions(), api_v1beta1.BackupSlotAvailable)
+	return cond != nil && cond.Status == metav1.ConditionFalse && cond.Reason == reason
+}
+
+// waitingForBackupSlot returns true if the BackupSession has been queued by the concurrency quotas.
+func waitingForBackupSlot(bs *api_v1beta1.BackupSession) bool {
+	return bs.Status.Phase == api_v1beta1.BackupSessionPending &&
+		condutil.IsConditionFalse(bs.Status.Conditions, api_v1beta1.BackupSlotAvailable)
+}
+
+// holdsBackupSlot returns true if the BackupSession is running or has been given a backup slot and is about to run.
+func (t *backupSlotTracker) holdsBackupSlot(bs *api_v1beta1.BackupSession) bool {
+	switch bs.Status.Phase {
+	case api_v1beta1.BackupSessionRunning:
+		return true
+	case "", api_v1beta1.BackupSessionPending:
+		if condutil.IsConditionTrue(bs.Status.Conditions, api_v1beta1.BackupSlotAvailable) {
+			return true
+		}
+		key, err := cache.MetaNamespaceKeyFunc(bs)
+		return err == nil && t.admitted.Has(key)
+	}
+	return false
+}
+
+func (t *backupSlotTracker) admit(key string) {
+	if t.admitted == nil {
+		t.admitted = sets.New[string]()
+	}
+	t.admitted.Insert(key)
+}
+
+// forgetObserved removes the admitted sessions that the informer cache already shows with their backup slot.
+func (t *backupSlotTracker) forgetObserved(sessions []*api_v1beta1.BackupSession) {
+	if t.admitted.Len() == 0 {
+		return
+	}
+	present := sets.New[string]()
+	for _, bs := range sessions {
+		key, err := cache.MetaNamespaceKeyFunc(bs)
+		if err != nil {
+			continue
+		}
+		present.Insert(key)
+		if bs.Status.Phase != "" && bs.Status.Phase != api_v1beta1.BackupSessionPending ||
+			condutil.IsConditionTrue(bs.Status.Conditions, api_v1beta1.BackupSlotAvailable) {
+			t.admitted.Delete(key)
+		}
+	}
+	// the deleted sessions do not hold any slot
+	t.admitted = t.admitted.Intersection(present)
+}
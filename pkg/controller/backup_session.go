@@ -52,7 +52,6 @@ import (
 	hooks "kmodules.xyz/webhook-runtime/admission/v1beta1"
 	webhook "kmodules.xyz/webhook-runtime/admission/v1beta1/generic"
 	wapi "kmodules.xyz/webhook-runtime/apis/workload/v1"
-	wcs "kmodules.xyz/webhook-runtime/client/workload/v1"
 )
 
 type backupSessionReconciler struct {
@@ -153,6 +152,14 @@ func (r *backupSessionReconciler) reconcile() error {
 			return r.requeueAfterRetryDelay()
 		}
 
+		if r.shouldDetectBackupAnomaly() {
+			return r.detectBackupAnomaly()
+		}
+
+		if r.shouldVerifyBackup() {
+			return r.verifyBackup()
+		}
+
 		r.logger.V(4).Info("Skipping processing event",
 			apis.KeyReason, fmt.Sprintf("Backup has been completed already with phase %q", r.session.GetStatus().Phase),
 		)
@@ -225,6 +232,20 @@ func (r *backupSessionReconciler) reconcile() error {
 		return nil
 	}
 
+	if r.shouldCheckBackupWindows() {
+		open, err := r.waitForBackupWindow()
+		if err != nil || !open {
+			return err
+		}
+	}
+
+	if r.shouldWaitForBackupSlot() {
+		allowed, err := r.waitForBackupSlot()
+		if err != nil || !allowed {
+			return err
+		}
+	}
+
 	if r.shouldExecuteGlobalPreBackupHook() {
 		if err := r.executeGlobalPreBackupHook(); err != nil {
 			return conditions.SetGlobalPreBackupHookSucceededConditionToFalse(r.session, err)
@@ -294,7 +315,7 @@ func (r *backupSessionReconciler) isDeadlineSet() bool {
 
 func (r *backupSessionReconciler) setDeadline(timeOut time.Duration) error {
 	r.logger.Info("Deadline has been set")
-	deadline := metav1.NewTime(r.session.GetObjectMeta().CreationTimestamp.Add(timeOut))
+	deadline := metav1.NewTime(r.backupStartTime().Add(timeOut))
 	return r.session.UpdateStatus(&api_v1beta1.BackupSessionStatus{
 		SessionDeadline: &deadline,
 	})
@@ -332,7 +353,7 @@ func (r *backupSessionReconciler) ensureBackupExecutor(targetInfo invoker.Backup
 		if err != nil {
 			return err
 		}
-		w, err := wcs.ConvertToWorkload(obj.DeepCopyObject())
+		w, err := util.ConvertToWorkload(obj.DeepCopyObject())
 		if err != nil {
 			return err
 		}
@@ -403,6 +424,7 @@ func (c *StashController) newSidecarExecutor(inv invoker.BackupInvoker, w *wapi.
 	e := &executor.Sidecar{
 		KubeClient:        c.kubeClient,
 		OpenshiftClient:   c.ocClient,
+		DynamicClient:     c.dynamicClient,
 		StashClient:       c.stashClient,
 		RBACOptions:       rbacOptions,
 		Invoker:           inv,
@@ -598,7 +620,7 @@ func (r *backupSessionReconciler) cleanupBackupHistory() error {
 
 func backupExecutorType(inv invoker.BackupInvoker, targetInfo invoker.BackupTargetInfo) executor.Type {
 	if inv.GetDriver() == api_v1beta1.ResticSnapshotter &&
-		util.BackupModel(targetInfo.Target.Ref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
+		util.BackupModel(targetInfo.Target.Ref.APIVersion, targetInfo.Target.Ref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
 		return executor.TypeSidecar
 	}
 	if inv.GetDriver() == api_v1beta1.VolumeSnapshotter {
@@ -742,6 +764,46 @@ func (r *backupSessionReconciler) checkIfBackupShouldBeSkipped() (string, error)
 			runningBS.Status.Phase,
 		), nil
 	}
+
+	// Skip taking backup if an older BackupSession is already waiting for a backup slot
+	queuedBS, err := r.getOlderWaitingBackupSession(waitingForBackupSlot)
+	if err != nil {
+		return "", err
+	}
+	if queuedBS != nil {
+		return fmt.Sprintf("Skipped taking new backup. Reason: Previous BackupSession: %s is waiting for a backup slot.",
+			queuedBS.Name,
+		), nil
+	}
+
+	if !r.shouldCheckBackupWindows() {
+		return "", nil
+	}
+
+	// Skip taking backup if an older BackupSession is already waiting for the backup window
+	waitingBS, err := r.getOlderWaitingBackupSession(waitingForBackupWindow)
+	if err != nil {
+		return "", err
+	}
+	if waitingBS != nil {
+		return fmt.Sprintf("Skipped taking new backup. Reason: Previous BackupSession: %s is waiting for the backup window.",
+			waitingBS.Name,
+		), nil
+	}
+
+	// Skip taking backup if the backup windows do not allow it and the policy is to skip
+	if r.invoker.GetOutOfWindowPolicy() == api_v1beta1.OutOfWindowPolicySkip {
+		decision, err := r.checkBackupWindows()
+		if err != nil {
+			return "", err
+		}
+		if !decision.Open {
+			if err := conditions.SetBackupWindowOpenConditionToFalse(r.session, decision.Reason, decision.Message); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Skipped taking backup. Reason: %s", decision.Message), nil
+		}
+	}
 	return "", nil
 }
 
@@ -1020,6 +1082,18 @@ func (c *StashController) getTotalHostForRestic(targetRef api_v1beta1.TargetRef)
 		return &dmn.Status.DesiredNumberScheduled, nil
 	// for all other workloads, only one replica will take backup/restore. so number of total host will be 1
 	default:
+		// for the workloads registered through an adapter with "Ordinal" host model, all replicas will take backup/restore
+		if a, ok := util.GetWorkloadAdapter(targetRef.APIVersion, targetRef.Kind); ok && a.HostModel == util.WorkloadHostModelOrdinal {
+			u, _, err := c.getAdaptedWorkload(targetRef.APIVersion, targetRef.Kind, targetRef.Namespace, targetRef.Name)
+			if err != nil {
+				return nil, err
+			}
+			replicas, err := a.Replicas(u)
+			if err != nil {
+				return nil, err
+			}
+			return &replicas, nil
+		}
 		return pointer.Int32P(1), nil
 	}
 }
@@ -1040,6 +1114,10 @@ func (r *backupSessionReconciler) isBackupFailed() bool {
 
 func (r *backupSessionReconciler) shouldRetry() bool {
 	bs := r.session.GetBackupSession()
+	// a preempted backup is always retried, no matter how many retries are left
+	if isBackupPreempted(bs) && !alreadyRetried(bs) {
+		return true
+	}
 	if bs.Spec.RetryLeft > 0 && !alreadyRetried(bs) {
 		return true
 	}
@@ -1054,6 +1132,10 @@ func alreadyRetried(bs *api_v1beta1.BackupSession) bool {
 }
 
 func (r *backupSessionReconciler) retryDelayPassed() bool {
+	// the retry of a preempted backup waits for the restore through the backup slot instead
+	if isBackupPreempted(r.session.GetBackupSession()) {
+		return true
+	}
 	status := r.session.GetStatus()
 	if status.NextRetry != nil && time.Now().After(status.NextRetry.Time) {
 		return true
@@ -1063,10 +1145,15 @@ func (r *backupSessionReconciler) retryDelayPassed() bool {
 
 func (r *backupSessionReconciler) retryNow() error {
 	r.logger.Info("Retrying the failed backup")
+	bs := r.session.GetBackupSession()
+	retryLeft := bs.Spec.RetryLeft - 1
+	if isBackupPreempted(bs) {
+		retryLeft = bs.Spec.RetryLeft
+	}
 	s := scheduler.InstantScheduler{
 		StashClient: r.ctrl.stashClient,
 		Invoker:     r.invoker,
-		RetryLeft:   r.session.GetBackupSession().Spec.RetryLeft - 1,
+		RetryLeft:   retryLeft,
 	}
 	err := s.Ensure()
 	if err != nil {
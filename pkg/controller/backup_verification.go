@@ -0,0 +1,445 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	v1beta1_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1beta1/util"
+	"stash.appscode.dev/apimachinery/pkg/conditions"
+	stashHooks "stash.appscode.dev/apimachinery/pkg/hooks"
+	"stash.appscode.dev/apimachinery/pkg/invoker"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/resolver"
+	"stash.appscode.dev/stash/pkg/util"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	condutil "kmodules.xyz/client-go/conditions"
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/meta"
+	ofst_util "kmodules.xyz/offshoot-api/util"
+)
+
+const (
+	// defaultVerificationTimeOut is used when the BackupConfiguration does not specify a timeout for the verification.
+	defaultVerificationTimeOut = 30 * time.Minute
+	// verifierContainer is the name of the container of the verifier pods that mount the restored volumes
+	verifierContainer = "verifier"
+)
+
+func (r *backupSessionReconciler) shouldVerifyBackup() bool {
+	if r.invoker.GetVerification() == nil || r.invoker.GetDriver() != api_v1beta1.ResticSnapshotter {
+		return false
+	}
+	if r.session.GetStatus().Phase != api_v1beta1.BackupSessionSucceeded {
+		return false
+	}
+	return !condutil.HasCondition(r.session.GetConditions(), api_v1beta1.BackupVerified)
+}
+
+// verifyBackup restores the snapshots taken by the BackupSession into a scratch namespace, runs the
+// verification probe against the restored data and records the result in the BackupSession conditions.
+func (r *backupSessionReconciler) verifyBackup() error {
+	verification := r.invoker.GetVerification()
+
+	namespace, err := r.ensureVerificationNamespace(verification)
+	if err != nil {
+		return r.completeBackupVerification(verification, err)
+	}
+
+	rs, err := r.ensureVerificationRestoreSession(namespace, verification)
+	if err != nil {
+		return r.completeBackupVerification(verification, err)
+	}
+
+	if !invoker.IsRestoreCompleted(rs.Status.Phase) {
+		timeOut := r.verificationTimeOut(verification)
+		if metav1.Now().After(rs.CreationTimestamp.Add(timeOut)) {
+			return r.completeBackupVerification(verification, fmt.Errorf("restore did not complete within %s", timeOut))
+		}
+		r.logger.V(4).Info("Waiting for verification restore to complete",
+			apis.ObjectKind, api_v1beta1.ResourceKindRestoreSession,
+			apis.ObjectName, rs.Name,
+			apis.ObjectNamespace, rs.Namespace,
+		)
+		r.requeue(requeueTimeInterval)
+		return nil
+	}
+
+	if rs.Status.Phase != api_v1beta1.RestoreSucceeded {
+		return r.completeBackupVerification(verification, fmt.Errorf("RestoreSession %s/%s completed with phase %q", rs.Namespace, rs.Name, rs.Status.Phase))
+	}
+
+	if verification.Probe != nil {
+		// the probe has to run where the restored data is, not in the operator pod
+		pods, err := r.ensureVerificationProbePods(rs, verification)
+		if err != nil {
+			return r.completeBackupVerification(verification, err)
+		}
+		if len(pods) == 0 {
+			if metav1.Now().After(rs.CreationTimestamp.Add(r.verificationTimeOut(verification))) {
+				return r.completeBackupVerification(verification, fmt.Errorf("no pod holding the restored data became ready within %s", r.verificationTimeOut(verification)))
+			}
+			r.logger.V(4).Info("Waiting for the pods holding the restored data to be ready")
+			r.requeue(requeueTimeInterval)
+			return nil
+		}
+		for _, pod := range pods {
+			hookExecutor := stashHooks.HookExecutor{
+				Config:      r.ctrl.clientConfig,
+				Hook:        verification.Probe.DeepCopy(),
+				ExecutorPod: pod,
+				Summary: r.invoker.GetSummary(api_v1beta1.TargetRef{}, kmapi.ObjectReference{
+					Namespace: r.session.GetObjectMeta().Namespace,
+					Name:      r.session.GetObjectMeta().Name,
+				}),
+			}
+			if err := hookExecutor.Execute(); err != nil {
+				return r.completeBackupVerification(verification, fmt.Errorf("verification probe failed in pod %s/%s. Reason: %v", pod.Namespace, pod.Name, err))
+			}
+		}
+	}
+	return r.completeBackupVerification(verification, nil)
+}
+
+// completeBackupVerification removes the resources created for the verification, then writes an event and
+// sets the BackupVerified condition according to the verification error.
+func (r *backupSessionReconciler) completeBackupVerification(verification *api_v1beta1.BackupVerification, verifyErr error) error {
+	if err := r.cleanupBackupVerification(verification); err != nil {
+		r.logger.Error(err, "Failed to cleanup backup verification resources")
+	}
+
+	if verifyErr != nil {
+		r.logger.Error(verifyErr, "Backup verification failed")
+		eventer.CreateEventWithLog(
+			r.ctrl.kubeClient,
+			eventer.EventSourceBackupSessionController,
+			r.session.GetBackupSession(),
+			core.EventTypeWarning,
+			eventer.EventReasonBackupVerificationFailed,
+			fmt.Sprintf("Failed to verify backup. Reason: %v", verifyErr),
+		)
+		return conditions.SetBackupVerifiedConditionToFalse(r.session, verifyErr)
+	}
+
+	r.logger.Info("Backup has been verified successfully")
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceBackupSessionController,
+		r.session.GetBackupSession(),
+		core.EventTypeNormal,
+		eventer.EventReasonBackupVerificationSucceeded,
+		"Backed up data has been restored and verified successfully.",
+	)
+	return conditions.SetBackupVerifiedConditionToTrue(r.session)
+}
+
+func (r *backupSessionReconciler) verificationTimeOut(verification *api_v1beta1.BackupVerification) time.Duration {
+	if verification.TimeOut != nil {
+		return verification.TimeOut.Duration
+	}
+	return defaultVerificationTimeOut
+}
+
+func (r *backupSessionReconciler) verificationNamespace(verification *api_v1beta1.BackupVerification) string {
+	if verification.Namespace != "" {
+		return verification.Namespace
+	}
+	return meta.ValidNameWithPrefixNSuffix(apis.PrefixStashVerification, r.session.GetObjectMeta().Namespace, r.session.GetObjectMeta().Name)
+}
+
+func (r *backupSessionReconciler) verificationRestoreSessionName() string {
+	return meta.ValidNameWithPrefix(apis.PrefixStashVerification, r.session.GetObjectMeta().Name)
+}
+
+// ensureVerificationNamespace creates a temporary namespace for the verification if the user hasn't specified one.
+// The namespace is labeled with the invoker information so that the Repository usagePolicy can select it.
+func (r *backupSessionReconciler) ensureVerificationNamespace(verification *api_v1beta1.BackupVerification) (string, error) {
+	name := r.verificationNamespace(verification)
+	if verification.Namespace != "" {
+		return name, nil
+	}
+
+	_, err := r.ctrl.kubeClient.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+	if err == nil || !kerr.IsNotFound(err) {
+		return name, err
+	}
+
+	r.logger.Info("Creating namespace for backup verification", apis.ObjectNamespace, name)
+	_, err = r.ctrl.kubeClient.CoreV1().Namespaces().Create(context.TODO(), &core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				apis.LabelApp:         apis.AppLabelStash,
+				apis.LabelInvokerType: r.invoker.GetTypeMeta().Kind,
+				apis.LabelInvokerName: r.invoker.GetObjectMeta().Name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil && !kerr.IsAlreadyExists(err) {
+		return name, err
+	}
+	return name, nil
+}
+
+func (r *backupSessionReconciler) ensureVerificationRestoreSession(namespace string, verification *api_v1beta1.BackupVerification) (*api_v1beta1.RestoreSession, error) {
+	rules := r.verificationRestoreRules()
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no snapshot was found in the BackupSession status")
+	}
+
+	target := &api_v1beta1.RestoreTarget{}
+	if verification.Target != nil {
+		target = verification.Target.DeepCopy()
+	}
+	if len(target.Rules) == 0 {
+		target.Rules = rules
+	}
+
+	repo := r.invoker.GetRepoRef()
+	rs, _, err := v1beta1_util.CreateOrPatchRestoreSession(
+		context.TODO(),
+		r.ctrl.stashClient.StashV1beta1(),
+		metav1.ObjectMeta{
+			Name:      r.verificationRestoreSessionName(),
+			Namespace: namespace,
+		},
+		func(in *api_v1beta1.RestoreSession) *api_v1beta1.RestoreSession {
+			in.Labels = meta.OverwriteKeys(in.Labels, map[string]string{
+				apis.LabelApp:         apis.AppLabelStash,
+				apis.LabelInvokerType: r.invoker.GetTypeMeta().Kind,
+				apis.LabelInvokerName: r.invoker.GetObjectMeta().Name,
+			})
+			in.Spec.Driver = api_v1beta1.ResticSnapshotter
+			in.Spec.Repository = kmapi.ObjectReference{
+				Name:      repo.Name,
+				Namespace: repo.Namespace,
+			}
+			in.Spec.Task = *verification.Task.DeepCopy()
+			in.Spec.Target = target
+			in.Spec.RuntimeSettings = *verification.RuntimeSettings.DeepCopy()
+			in.Spec.InterimVolumeTemplate = verification.InterimVolumeTemplate.DeepCopy()
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return rs, err
+}
+
+// verificationRestoreRules generates restore rules that restore exactly the snapshots taken by this BackupSession.
+func (r *backupSessionReconciler) verificationRestoreRules() []api_v1beta1.Rule {
+	var stats []api_v1beta1.HostBackupStats
+	for _, t := range r.session.GetTargetStatus() {
+		stats = append(stats, t.Stats...)
+	}
+
+	var rules []api_v1beta1.Rule
+	for _, host := range stats {
+		rule := api_v1beta1.Rule{
+			SourceHost: host.Hostname,
+		}
+		if len(stats) > 1 {
+			rule.TargetHosts = []string{host.Hostname}
+		}
+		for _, snap := range host.Snapshots {
+			if snap.Name != "" {
+				rule.Snapshots = append(rule.Snapshots, snap.Name)
+			}
+		}
+		if len(rule.Snapshots) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (r *backupSessionReconciler) cleanupBackupVerification(verification *api_v1beta1.BackupVerification) error {
+	// deleting the temporary namespace removes the RestoreSession and the restored data as well
+	if verification.Namespace == "" {
+		err := r.ctrl.kubeClient.CoreV1().Namespaces().Delete(context.TODO(), r.verificationNamespace(verification), meta.DeleteInBackground())
+		if err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	err := r.ctrl.kubeClient.CoreV1().Pods(verification.Namespace).DeleteCollection(
+		context.TODO(),
+		meta.DeleteInBackground(),
+		metav1.ListOptions{LabelSelector: labels.SelectorFromSet(r.verifierPodLabels()).String()},
+	)
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	err = r.ctrl.stashClient.StashV1beta1().RestoreSessions(verification.Namespace).Delete(context.TODO(), r.verificationRestoreSessionName(), meta.DeleteInBackground())
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ensureVerificationProbePods returns the pods that hold the restored data. The verification probe is executed in them.
+// If the data has been restored into a workload, the running pods of the workload are used. Otherwise, Stash creates
+// verifier pods that mount the restored volumes. It returns no pod until they are ready.
+func (r *backupSessionReconciler) ensureVerificationProbePods(rs *api_v1beta1.RestoreSession, verification *api_v1beta1.BackupVerification) ([]kmapi.ObjectReference, error) {
+	target := rs.Spec.Target
+	switch {
+	case target != nil && target.Ref.Name != "" && util.RestoreModel(target.Ref.APIVersion, target.Ref.Kind, rs.Spec.Task.Name) == apis.ModelSidecar:
+		// the data has been restored by the init-container of the workload
+		ref := target.Ref
+		if ref.Namespace == "" {
+			ref.Namespace = rs.Namespace
+		}
+		return r.readyWorkloadPods(ref)
+	case target != nil && len(target.VolumeClaimTemplates) != 0:
+		// the data has been restored into the volumes created from the templates. create a verifier pod for each replica.
+		replicas := int32(1)
+		if target.Replicas != nil {
+			replicas = *target.Replicas
+		}
+		var pods []kmapi.ObjectReference
+		for ordinal := int32(0); ordinal < replicas; ordinal++ {
+			vt := resolver.VolumeTemplateOptions{
+				Ordinal:         int(ordinal),
+				VolumeTemplates: target.VolumeClaimTemplates,
+			}
+			pvcList, err := vt.Resolve()
+			if err != nil {
+				return nil, err
+			}
+			podSpec := util.AttachPVC(r.verifierPodSpec(verification), util.PVCListToVolumes(pvcList, ordinal), target.VolumeMounts)
+			pod, err := r.ensureVerifierPod(rs.Namespace, fmt.Sprintf("%s-%d", r.verificationRestoreSessionName(), ordinal), podSpec)
+			if err != nil || pod == nil {
+				return nil, err
+			}
+			pods = append(pods, *pod)
+		}
+		return pods, nil
+	case rs.Spec.InterimVolumeTemplate != nil:
+		// the data has been restored into the interim volume of the restore job
+		podSpec := r.verifierPodSpec(verification)
+		podSpec.Volumes = core_util.UpsertVolume(podSpec.Volumes, core.Volume{
+			Name: apis.StashInterimVolume,
+			VolumeSource: core.VolumeSource{
+				PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+					ClaimName: meta.ValidNameWithPrefix(rs.Name, rs.Spec.InterimVolumeTemplate.Name),
+				},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = core_util.UpsertVolumeMount(podSpec.Containers[0].VolumeMounts, core.VolumeMount{
+			Name:      apis.StashInterimVolume,
+			MountPath: apis.StashInterimVolumeMountPath,
+		})
+		pod, err := r.ensureVerifierPod(rs.Namespace, r.verificationRestoreSessionName(), podSpec)
+		if err != nil || pod == nil {
+			return nil, err
+		}
+		return []kmapi.ObjectReference{*pod}, nil
+	default:
+		return nil, fmt.Errorf("verification probe can't be executed. Reason: the restored data is not held by any workload or volume")
+	}
+}
+
+func (r *backupSessionReconciler) readyWorkloadPods(ref api_v1beta1.TargetRef) ([]kmapi.ObjectReference, error) {
+	obj, err := r.ctrl.getTargetWorkload(ref)
+	if err != nil {
+		return nil, err
+	}
+	w, err := util.ConvertToWorkload(obj.DeepCopyObject())
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(w.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := r.ctrl.kubeClient.CoreV1().Pods(ref.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	var pods []kmapi.ObjectReference
+	for _, pod := range podList.Items {
+		if ready, _ := core_util.PodRunningAndReady(pod); ready {
+			pods = append(pods, kmapi.ObjectReference{Namespace: pod.Namespace, Name: pod.Name})
+		}
+	}
+	return pods, nil
+}
+
+// verifierPodSpec returns the spec of a pod that only keeps the restored volumes mounted until the probe has been executed.
+// The probe can refer to its container by the name "verifier".
+func (r *backupSessionReconciler) verifierPodSpec(verification *api_v1beta1.BackupVerification) core.PodSpec {
+	container := core.Container{
+		Name:    verifierContainer,
+		Image:   r.ctrl.getDockerImage().ToContainerImage(),
+		Command: []string{"sleep", strconv.Itoa(int(r.verificationTimeOut(verification).Seconds()))},
+	}
+	if verification.RuntimeSettings.Container != nil {
+		container = ofst_util.ApplyContainerRuntimeSettings(container, *verification.RuntimeSettings.Container)
+	}
+	podSpec := core.PodSpec{
+		Containers:    []core.Container{container},
+		RestartPolicy: core.RestartPolicyNever,
+	}
+	if verification.RuntimeSettings.Pod != nil {
+		podSpec = ofst_util.ApplyPodRuntimeSettings(podSpec, *verification.RuntimeSettings.Pod)
+	}
+	return podSpec
+}
+
+func (r *backupSessionReconciler) verifierPodLabels() map[string]string {
+	return map[string]string{
+		apis.LabelApp:         apis.AppLabelStash,
+		apis.LabelInvokerType: r.invoker.GetTypeMeta().Kind,
+		apis.LabelInvokerName: r.invoker.GetObjectMeta().Name,
+	}
+}
+
+// ensureVerifierPod creates the verifier pod if it does not exist. It returns nil until the pod is ready.
+func (r *backupSessionReconciler) ensureVerifierPod(namespace, name string, podSpec core.PodSpec) (*kmapi.ObjectReference, error) {
+	pod, err := r.ctrl.kubeClient.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		r.logger.Info("Creating verifier pod for the restored data", apis.ObjectName, name, apis.ObjectNamespace, namespace)
+		pod, err = r.ctrl.kubeClient.CoreV1().Pods(namespace).Create(context.TODO(), &core.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    r.verifierPodLabels(),
+			},
+			Spec: podSpec,
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pod.Status.Phase == core.PodFailed || pod.Status.Phase == core.PodSucceeded {
+		return nil, fmt.Errorf("verifier pod %s/%s has terminated with phase %q", namespace, name, pod.Status.Phase)
+	}
+	if ready, _ := core_util.PodRunningAndReady(*pod); !ready {
+		return nil, nil
+	}
+	return &kmapi.ObjectReference{Namespace: namespace, Name: name}, nil
+}
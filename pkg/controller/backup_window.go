@@ -0,0 +1,121 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/conditions"
+	"stash.appscode.dev/stash/pkg/scheduler"
+
+	"k8s.io/apimachinery/pkg/labels"
+	condutil "kmodules.xyz/client-go/conditions"
+)
+
+// maxBackupWindowRequeueInterval limits how long a waiting BackupSession is left alone
+// so that the changes in the backup windows are picked up.
+const maxBackupWindowRequeueInterval = 10 * time.Minute
+
+// shouldCheckBackupWindows returns true if the backup windows have not allowed the backup to start yet.
+// A running backup is not interrupted when the window closes.
+func (r *backupSessionReconciler) shouldCheckBackupWindows() bool {
+	if len(r.invoker.GetAllowedWindows()) == 0 && len(r.invoker.GetBlackoutWindows()) == 0 {
+		return false
+	}
+	return r.isBackupPending() && !condutil.IsConditionTrue(r.session.GetConditions(), api_v1beta1.BackupWindowOpen)
+}
+
+func (r *backupSessionReconciler) checkBackupWindows() (*scheduler.WindowDecision, error) {
+	return scheduler.CheckBackupWindows(r.invoker.GetAllowedWindows(), r.invoker.GetBlackoutWindows(), r.invoker.GetTimeZone(), time.Now())
+}
+
+// waitForBackupWindow keeps the BackupSession Pending until the backup windows allow the backup to run.
+// It returns true once the backup is allowed to start.
+func (r *backupSessionReconciler) waitForBackupWindow() (bool, error) {
+	decision, err := r.checkBackupWindows()
+	if err != nil {
+		return false, err
+	}
+	if decision.Open {
+		return true, conditions.SetBackupWindowOpenConditionToTrue(r.session)
+	}
+
+	r.logger.Info("Keeping backup pending", apis.KeyReason, decision.Message)
+	_, cond := condutil.GetCondition(r.session.GetConditions(), api_v1beta1.BackupWindowOpen)
+	if cond == nil || cond.Reason != decision.Reason || cond.Message != decision.Message {
+		if err := conditions.SetBackupWindowOpenConditionToFalse(r.session, decision.Reason, decision.Message); err != nil {
+			return false, err
+		}
+	}
+
+	delay := maxBackupWindowRequeueInterval
+	if !decision.OpensAt.IsZero() {
+		delay = time.Until(decision.OpensAt)
+	}
+	if delay > maxBackupWindowRequeueInterval {
+		delay = maxBackupWindowRequeueInterval
+	}
+	if delay < requeueTimeInterval {
+		delay = requeueTimeInterval
+	}
+	r.requeue(delay)
+	return false, nil
+}
+
+// getOlderWaitingBackupSession returns a Pending BackupSession of the same invoker that was created
+// before the current one and is still waiting according to the waiting function.
+func (r *backupSessionReconciler) getOlderWaitingBackupSession(waiting func(bs *api_v1beta1.BackupSession) bool) (*api_v1beta1.BackupSession, error) {
+	backupSessions, err := r.ctrl.backupSessionLister.BackupSessions(r.invoker.GetObjectMeta().Namespace).List(labels.SelectorFromSet(map[string]string{
+		apis.LabelInvokerName: r.invoker.GetObjectMeta().Name,
+		apis.LabelInvokerType: r.invoker.GetTypeMeta().Kind,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	cur := r.session.GetBackupSession()
+	for i := range backupSessions {
+		bs := backupSessions[i]
+		if bs.Name == cur.Name || bs.Status.Phase != api_v1beta1.BackupSessionPending {
+			continue
+		}
+		if waiting(bs) && shouldKeepCurrentSessionPending(cur, bs) {
+			return bs, nil
+		}
+	}
+	return nil, nil
+}
+
+func waitingForBackupWindow(bs *api_v1beta1.BackupSession) bool {
+	return condutil.IsConditionFalse(bs.Status.Conditions, api_v1beta1.BackupWindowOpen)
+}
+
+// backupStartTime returns the time from which the session deadline is counted.
+// A session that waited for a backup window or a backup slot gets its full time limit after the wait.
+func (r *backupSessionReconciler) backupStartTime() time.Time {
+	start := r.session.GetObjectMeta().CreationTimestamp.Time
+	for _, condType := range []string{api_v1beta1.BackupWindowOpen, api_v1beta1.BackupSlotAvailable} {
+		if condutil.IsConditionTrue(r.session.GetConditions(), condType) {
+			_, cond := condutil.GetCondition(r.session.GetConditions(), condType)
+			if cond.LastTransitionTime.After(start) {
+				start = cond.LastTransitionTime.Time
+			}
+		}
+	}
+	return start
+}
@@ -30,6 +30,8 @@ import (
 	proxyserver "go.bytebuilders.dev/license-proxyserver/apis/proxyserver/v1alpha1"
 	licenseapi "go.bytebuilders.dev/license-verifier/apis/licenses/v1alpha1"
 	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -46,6 +48,13 @@ const (
 	validatingWebhook = "admission.stash.appscode.com"
 )
 
+const (
+	// SchedulerModeCronJob creates a CronJob for each BackupConfiguration to trigger the backups
+	SchedulerModeCronJob = "cronjob"
+	// SchedulerModeInProcess triggers the backups from inside the operator
+	SchedulerModeInProcess = "in-process"
+)
+
 type config struct {
 	LicenseFile             string
 	License                 licenseapi.License
@@ -62,6 +71,10 @@ type config struct {
 	CronJobPSPNames         []string
 	BackupJobPSPNames       []string
 	RestoreJobPSPNames      []string
+	SchedulerMode           string
+	// MaxConcurrentBackupSessions is the maximum number of BackupSessions that can run simultaneously in the cluster.
+	// Zero means unlimited.
+	MaxConcurrentBackupSessions int32
 }
 
 type Config struct {
@@ -73,6 +86,7 @@ type Config struct {
 	StashClient      cs.Interface
 	CRDClient        crd_cs.Interface
 	AppCatalogClient appcatalog_cs.Interface
+	DynamicClient    dynamic.Interface
 }
 
 func NewConfig(clientConfig *rest.Config) *Config {
@@ -126,19 +140,21 @@ func (c *Config) New() (*StashController, error) {
 	}
 
 	ctrl := &StashController{
-		config:               c.config,
-		clientConfig:         c.ClientConfig,
-		kubeClient:           c.KubeClient,
-		ocClient:             c.OcClient,
-		stashClient:          c.StashClient,
-		crdClient:            c.CRDClient,
-		appCatalogClient:     c.AppCatalogClient,
-		kubeInformerFactory:  informerFactory,
-		stashInformerFactory: stashinformers.NewSharedInformerFactory(c.StashClient, c.ResyncPeriod),
-		ocInformerFactory:    oc_informers.NewSharedInformerFactory(c.OcClient, c.ResyncPeriod),
-		recorder:             eventer.NewEventRecorder(c.KubeClient, "stash-operator"),
-		mapper:               mapper,
-		auditor:              auditor,
+		config:                 c.config,
+		clientConfig:           c.ClientConfig,
+		kubeClient:             c.KubeClient,
+		ocClient:               c.OcClient,
+		stashClient:            c.StashClient,
+		crdClient:              c.CRDClient,
+		appCatalogClient:       c.AppCatalogClient,
+		dynamicClient:          c.DynamicClient,
+		kubeInformerFactory:    informerFactory,
+		stashInformerFactory:   stashinformers.NewSharedInformerFactory(c.StashClient, c.ResyncPeriod),
+		ocInformerFactory:      oc_informers.NewSharedInformerFactory(c.OcClient, c.ResyncPeriod),
+		dynamicInformerFactory: dynamicinformer.NewDynamicSharedInformerFactory(c.DynamicClient, c.ResyncPeriod),
+		recorder:               eventer.NewEventRecorder(c.KubeClient, "stash-operator"),
+		mapper:                 mapper,
+		auditor:                auditor,
 	}
 
 	// ensure default functions
@@ -174,6 +190,7 @@ func (c *Config) New() (*StashController, error) {
 	ctrl.initDaemonSetWatcher()
 	ctrl.initStatefulSetWatcher()
 	ctrl.initDeploymentConfigWatcher()
+	ctrl.initWorkloadAdapterWatchers()
 
 	ctrl.initJobWatcher()
 
@@ -184,6 +201,7 @@ func (c *Config) New() (*StashController, error) {
 	ctrl.initBackupConfigurationWatcher()
 	ctrl.initBackupSessionWatcher()
 	ctrl.initRestoreSessionWatcher()
+	ctrl.initRestoreBatchWatcher()
 
 	return ctrl, nil
 }
@@ -24,10 +24,14 @@ import (
 	stash_listers "stash.appscode.dev/apimachinery/client/listers/stash/v1alpha1"
 	stash_listers_v1beta1 "stash.appscode.dev/apimachinery/client/listers/stash/v1beta1"
 	"stash.appscode.dev/apimachinery/pkg/docker"
+	"stash.appscode.dev/stash/pkg/scheduler"
 
 	auditlib "go.bytebuilders.dev/audit/lib"
 	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	apps_listers "k8s.io/client-go/listers/apps/v1"
@@ -54,13 +58,15 @@ type StashController struct {
 	stashClient      cs.Interface
 	crdClient        crd_cs.Interface
 	appCatalogClient appcatalog_cs.Interface
+	dynamicClient    dynamic.Interface
 	recorder         record.EventRecorder
 	mapper           discovery.ResourceMapper
 	auditor          *auditlib.EventPublisher
 
-	kubeInformerFactory  informers.SharedInformerFactory
-	ocInformerFactory    oc_informers.SharedInformerFactory
-	stashInformerFactory stashinformers.SharedInformerFactory
+	kubeInformerFactory    informers.SharedInformerFactory
+	ocInformerFactory      oc_informers.SharedInformerFactory
+	stashInformerFactory   stashinformers.SharedInformerFactory
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
 
 	// Repository
 	repoQueue    *queue.Worker[any]
@@ -96,16 +102,24 @@ type StashController struct {
 	backupSessionQueue    *queue.Worker[any]
 	backupSessionInformer cache.SharedIndexInformer
 	backupSessionLister   stash_listers_v1beta1.BackupSessionLister
+	backupSlots           backupSlotTracker
 
 	// RestoreSession
 	restoreSessionQueue    *queue.Worker[any]
 	restoreSessionInformer cache.SharedIndexInformer
 	restoreSessionLister   stash_listers_v1beta1.RestoreSessionLister
 
+	// RestoreBatch
+	restoreBatchQueue    *queue.Worker[any]
+	restoreBatchInformer cache.SharedIndexInformer
+
 	// Openshift DeploymentConfiguration
 	dcQueue    *queue.Worker[any]
 	dcInformer cache.SharedIndexInformer
 	dcLister   oc_listers.DeploymentConfigLister
+
+	// resources registered through workload adapters, keyed by their kind
+	adapterWatchers map[schema.GroupKind]*workloadAdapterWatcher
 }
 
 func (c *StashController) Run(stopCh <-chan struct{}) {
@@ -130,6 +144,7 @@ func (c *StashController) RunInformers(stopCh <-chan struct{}) {
 
 	c.kubeInformerFactory.Start(stopCh)
 	c.stashInformerFactory.Start(stopCh)
+	c.dynamicInformerFactory.Start(stopCh)
 
 	// start ocInformerFactory only if the cluster has DeploymentConfig (for openshift)
 	if c.dcInformer != nil {
@@ -160,6 +175,13 @@ func (c *StashController) RunInformers(stopCh <-chan struct{}) {
 		}
 	}
 
+	for _, v := range c.dynamicInformerFactory.WaitForCacheSync(stopCh) {
+		if !v {
+			runtime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
+			return
+		}
+	}
+
 	// start workload queue
 	c.dpQueue.Run(stopCh)
 	c.dsQueue.Run(stopCh)
@@ -170,6 +192,11 @@ func (c *StashController) RunInformers(stopCh <-chan struct{}) {
 		c.dcQueue.Run(stopCh)
 	}
 
+	// start the queues of the resources registered through workload adapters
+	for _, w := range c.adapterWatchers {
+		w.queue.Run(stopCh)
+	}
+
 	c.jobQueue.Run(stopCh)
 
 	// start v1alpha1 resources queue
@@ -179,6 +206,16 @@ func (c *StashController) RunInformers(stopCh <-chan struct{}) {
 	c.bcQueue.Run(stopCh)
 	c.backupSessionQueue.Run(stopCh)
 	c.restoreSessionQueue.Run(stopCh)
+	c.restoreBatchQueue.Run(stopCh)
+
+	if c.SchedulerMode == SchedulerModeInProcess {
+		s := &scheduler.InProcessScheduler{
+			KubeClient:  c.kubeClient,
+			StashClient: c.stashClient,
+			Lister:      c.bcLister,
+		}
+		go s.Run(stopCh)
+	}
 
 	<-stopCh
 	klog.Infoln("Stopping Stash controller")
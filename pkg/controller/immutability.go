@@ -0,0 +1,312 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	stash_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1alpha1/util"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	stow_s3 "gomodules.xyz/stow/s3"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	condutil "kmodules.xyz/client-go/conditions"
+	"kmodules.xyz/objectstore-api/pkg/osm"
+)
+
+// bucketRegionLookupHint is the region where the request to find the region of a bucket is sent when
+// neither the Repository nor the default AWS configuration specifies any region.
+const bucketRegionLookupHint = "us-east-1"
+
+// validateImmutabilityUpdate ensures that an immutability policy in Compliance mode is never weakened.
+func validateImmutabilityUpdate(oldRepo, newRepo *api_v1alpha1.Repository) error {
+	oldPolicy := oldRepo.Spec.Immutability
+	if oldPolicy == nil || oldPolicy.Mode != api_v1alpha1.ImmutabilityModeCompliance {
+		return nil
+	}
+	newPolicy := newRepo.Spec.Immutability
+	switch {
+	case newPolicy == nil:
+		return fmt.Errorf("immutability policy in %s mode can not be removed", api_v1alpha1.ImmutabilityModeCompliance)
+	case newPolicy.Mode != oldPolicy.Mode:
+		return fmt.Errorf("immutability mode can not be changed from %s", api_v1alpha1.ImmutabilityModeCompliance)
+	case newPolicy.RetentionPeriod.Duration < oldPolicy.RetentionPeriod.Duration:
+		return fmt.Errorf("immutability retentionPeriod can not be shortened in %s mode", api_v1alpha1.ImmutabilityModeCompliance)
+	}
+	return nil
+}
+
+// ensureObjectLock configures the default Object Lock retention of the bucket of an immutable S3 Repository.
+// The bucket must have been created with Object Lock enabled. Other backends must be configured by the user.
+// A failure does not block the reconciliation of the Repository. Instead, it is reported through an event
+// and the ObjectLockConfigured condition of the Repository.
+func (r *repositoryReconciler) ensureObjectLock() error {
+	policy := r.repository.Spec.Immutability
+	if policy == nil || r.repository.Spec.Backend.S3 == nil {
+		if condutil.HasCondition(r.repository.Status.Conditions, api_v1alpha1.ObjectLockConfigured) {
+			return r.updateObjectLockStatus(func(in *api_v1alpha1.RepositoryStatus) {
+				in.Conditions = condutil.RemoveCondition(in.Conditions, api_v1alpha1.ObjectLockConfigured)
+			})
+		}
+		return nil
+	}
+
+	err := r.configureObjectLock(policy)
+	if err != nil {
+		r.reportObjectLockFailure(err)
+	}
+	if err == nil && condutil.IsConditionTrue(r.repository.Status.Conditions, api_v1alpha1.ObjectLockConfigured) {
+		return nil
+	}
+	return r.setObjectLockCondition(err)
+}
+
+func (r *repositoryReconciler) configureObjectLock(policy *api_v1alpha1.ImmutabilityPolicy) error {
+	cfg, err := osm.NewOSMContext(r.ctrl.kubeClient, r.repository.Spec.Backend, r.repository.Namespace)
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+	bucket := r.repository.Spec.Backend.S3.Bucket
+	client, err := newS3Client(ctx, cfg, bucket)
+	if err != nil {
+		return err
+	}
+
+	mode := s3types.ObjectLockRetentionModeGovernance
+	if policy.Mode == api_v1alpha1.ImmutabilityModeCompliance {
+		mode = s3types.ObjectLockRetentionModeCompliance
+	}
+	// S3 Object Lock retention is specified in days. Round up so that the backend never unlocks a snapshot before Stash does.
+	days := int32(math.Ceil(policy.RetentionPeriod.Hours() / 24))
+
+	cur, err := client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return fmt.Errorf("failed to read the Object Lock configuration of bucket %q. Make sure the bucket has been created with Object Lock enabled. Reason: %v", bucket, err)
+	}
+	if lock := cur.ObjectLockConfiguration; lock != nil && lock.Rule != nil && lock.Rule.DefaultRetention != nil {
+		retention := lock.Rule.DefaultRetention
+		if retention.Mode == mode && aws.ToInt32(retention.Days) == days {
+			return nil
+		}
+	}
+
+	r.logger.Info("Configuring Object Lock retention of the bucket", "bucket", bucket, "mode", mode, "days", days)
+	_, err = client.PutObjectLockConfiguration(ctx, &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+		ObjectLockConfiguration: &s3types.ObjectLockConfiguration{
+			ObjectLockEnabled: s3types.ObjectLockEnabledEnabled,
+			Rule: &s3types.ObjectLockRule{
+				DefaultRetention: &s3types.DefaultRetention{
+					Mode: mode,
+					Days: aws.Int32(days),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure the Object Lock retention of bucket %q. Reason: %v", bucket, err)
+	}
+	return nil
+}
+
+func (r *repositoryReconciler) reportObjectLockFailure(err error) {
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeWarning,
+		eventer.EventReasonObjectLockConfigurationFailed,
+		fmt.Sprintf("Failed to configure Object Lock for the immutability policy. Reason: %v", err),
+	)
+}
+
+func (r *repositoryReconciler) setObjectLockCondition(lockErr error) error {
+	cond := kmapi.Condition{
+		Type:               api_v1alpha1.ObjectLockConfigured,
+		Status:             metav1.ConditionTrue,
+		Reason:             api_v1alpha1.ObjectLockConfigurationSucceeded,
+		Message:            "Object Lock retention of the bucket has been configured according to the immutability policy.",
+		LastTransitionTime: metav1.Now(),
+	}
+	if lockErr != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = api_v1alpha1.ObjectLockConfigurationFailed
+		cond.Message = lockErr.Error()
+	}
+	return r.updateObjectLockStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		in.Conditions = condutil.SetCondition(in.Conditions, cond)
+	})
+}
+
+func (r *repositoryReconciler) updateObjectLockStatus(transform func(in *api_v1alpha1.RepositoryStatus)) error {
+	var err error
+	r.repository, err = stash_util.UpdateRepositoryStatus(
+		context.TODO(),
+		r.ctrl.stashClient.StashV1alpha1(),
+		r.repository.ObjectMeta,
+		func(in *api_v1alpha1.RepositoryStatus) (types.UID, *api_v1alpha1.RepositoryStatus) {
+			transform(in)
+			return r.repository.UID, in
+		},
+		metav1.UpdateOptions{},
+	)
+	return err
+}
+
+// snapshotsLockedUntil returns the time until which the snapshots of the Repository are locked by its immutability policy.
+// It returns nil if none of the snapshots is locked anymore.
+func (r *repositoryReconciler) snapshotsLockedUntil() (*metav1.Time, error) {
+	if r.repository.Spec.Immutability == nil {
+		return nil, nil
+	}
+
+	secret, err := r.ctrl.kubeClient.CoreV1().Secrets(r.repository.Namespace).Get(context.TODO(), r.repository.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	tempDir, err := os.MkdirTemp("", "stash")
+	if err != nil {
+		return nil, err
+	}
+	defer util.RemoveDirWithLogErr(tempDir)
+
+	setupOpt, err := util.SetupOptionsForRepository(*r.repository, util.ExtraOptions{
+		StorageSecret: secret,
+		ScratchDir:    tempDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w, err := restic.NewResticWrapper(setupOpt)
+	if err != nil {
+		return nil, err
+	}
+	if !w.RepositoryAlreadyExist() {
+		return nil, nil
+	}
+	snapshots, err := w.ListSnapshots(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lockedUntil *metav1.Time
+	now := time.Now()
+	for _, snapshot := range snapshots {
+		if !r.repository.IsSnapshotLocked(snapshot.Time, now) {
+			continue
+		}
+		if until := r.repository.SnapshotLockedUntil(snapshot.Time); lockedUntil == nil || until.After(lockedUntil.Time) {
+			lockedUntil = until
+		}
+	}
+	return lockedUntil, nil
+}
+
+func (r *repositoryReconciler) skipWipeOut(lockedUntil *metav1.Time) {
+	r.logger.Info("Skipping wipe out of the backend data. Reason: snapshots are still locked",
+		apis.KeyReason, fmt.Sprintf("locked until %s", lockedUntil.UTC().Format(time.RFC3339)),
+	)
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeWarning,
+		eventer.EventReasonRepositoryWipeOutSkipped,
+		fmt.Sprintf("Backend data has been kept as some snapshots are locked by the immutability policy until %s", lockedUntil.UTC().Format(time.RFC3339)),
+	)
+}
+
+// newS3Client returns a client for the S3 bucket of the backend. If the backend does not specify any region,
+// the region is taken from the default AWS configuration of the operator, or looked up from the bucket itself.
+func newS3Client(ctx context.Context, cfg *osm.Context, bucket string) (*s3.Client, error) {
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if region, ok := cfg.Config.Config(stow_s3.ConfigRegion); ok && region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(region))
+	}
+	if authType, _ := cfg.Config.Config(stow_s3.ConfigAuthType); authType != "iam" {
+		keyID, _ := cfg.Config.Config(stow_s3.ConfigAccessKeyID)
+		key, _ := cfg.Config.Config(stow_s3.ConfigSecretKey)
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(keyID, key, "")))
+	}
+	if caCert, ok := cfg.Config.Config(stow_s3.ConfigCACertData); ok {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("failed to parse the CA certificate of the S3 endpoint")
+		}
+		loadOpts = append(loadOpts, awsconfig.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}))
+	}
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load S3 client configuration. Reason: %v", err)
+	}
+
+	var clientOpts []func(*s3.Options)
+	if endpoint, ok := cfg.Config.Config(stow_s3.ConfigEndpoint); ok && endpoint != "" {
+		if !strings.Contains(endpoint, "://") {
+			scheme := "https://"
+			if disableSSL, _ := cfg.Config.Config(stow_s3.ConfigDisableSSL); disableSSL == "true" {
+				scheme = "http://"
+			}
+			endpoint = scheme + endpoint
+		}
+		clientOpts = append(clientOpts, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		})
+	}
+	client := s3.NewFromConfig(awsConfig, clientOpts...)
+	if awsConfig.Region != "" {
+		return client, nil
+	}
+
+	// S3 reports the actual region of the bucket even if the lookup request is sent to a different region
+	region, err := manager.GetBucketRegion(ctx, client, bucket, func(o *s3.Options) {
+		o.Region = bucketRegionLookupHint
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the region of bucket %q. Set the region in the backend of the Repository. Reason: %v", bucket, err)
+	}
+	return s3.NewFromConfig(awsConfig, append(clientOpts, func(o *s3.Options) {
+		o.Region = region
+	})...), nil
+}
@@ -0,0 +1,477 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	stash_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1alpha1/util"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	condutil "kmodules.xyz/client-go/conditions"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// stagedResticPasswordKey is the key of the storage Secret that holds the new restic password
+// until the rotation moves it to RESTIC_PASSWORD.
+const stagedResticPasswordKey = "NEW_RESTIC_PASSWORD"
+
+type keyRotationStep struct {
+	condition string
+	message   string
+	// waitFor returns true if the step must not run yet
+	waitFor func() (bool, error)
+	run     func(scratchDir string) error
+}
+
+// rotateKey rotates the restic password of the Repository when `spec.rotateKey` has been changed.
+// Each step is recorded as a condition, so an interrupted rotation resumes from the step that has not succeeded yet.
+// A new rotation is not started until the ongoing one has been completed.
+func (r *repositoryReconciler) rotateKey() error {
+	switch keyRotationActionFor(r.repository.Spec.RotateKey, r.repository.Status.KeyRotation) {
+	case keyRotationNone:
+		return nil
+	case keyRotationStart:
+		if err := r.startKeyRotation(); err != nil {
+			return err
+		}
+	}
+
+	scratchDir, err := os.MkdirTemp("", "stash")
+	if err != nil {
+		return err
+	}
+	defer util.RemoveDirWithLogErr(scratchDir)
+
+	steps := []keyRotationStep{
+		{
+			condition: api_v1alpha1.KeyRotationNewKeyAdded,
+			message:   "New key has been added to the restic repository.",
+			run:       r.addNewKey,
+		},
+		{
+			condition: api_v1alpha1.KeyRotationSecretUpdated,
+			message:   "New password has been stored in the storage Secret.",
+			run:       r.storeNewPassword,
+		},
+		{
+			condition: api_v1alpha1.KeyRotationAccessVerified,
+			message:   "Restic repository is accessible using the new password.",
+			run:       r.verifyNewPassword,
+		},
+		{
+			condition: api_v1alpha1.KeyRotationOldKeyRemoved,
+			message:   "Old key has been removed from the restic repository.",
+			// the running sessions might still be using the old password
+			waitFor: r.hasRunningSession,
+			run:     r.removeOldKey,
+		},
+	}
+	for _, step := range pendingKeyRotationSteps(r.repository.Status.Conditions, steps) {
+		if step.waitFor != nil {
+			wait, err := step.waitFor()
+			if err != nil {
+				return err
+			}
+			if wait {
+				r.logger.Info("Waiting for the running sessions to complete before the key rotation step", "step", step.condition)
+				key, err := cache.MetaNamespaceKeyFunc(r.repository)
+				if err != nil {
+					return err
+				}
+				r.ctrl.repoQueue.GetQueue().AddAfter(key, requeueTimeInterval)
+				return nil
+			}
+		}
+		r.logger.Info("Running key rotation step", "step", step.condition)
+		if err := step.run(scratchDir); err != nil {
+			return r.handleKeyRotationFailure(step, err)
+		}
+		if err := r.setKeyRotationCondition(step, nil); err != nil {
+			return err
+		}
+	}
+	return r.completeKeyRotation()
+}
+
+type keyRotationAction int
+
+const (
+	keyRotationNone keyRotationAction = iota
+	keyRotationStart
+	keyRotationResume
+)
+
+// keyRotationActionFor decides whether a key rotation has to be started or resumed.
+// A new rotation is requested by setting `spec.rotateKey` to a value that has not been rotated for yet.
+func keyRotationActionFor(rotateKey string, rotation *api_v1alpha1.KeyRotationStatus) keyRotationAction {
+	if rotation != nil && rotation.CompletionTime == nil {
+		return keyRotationResume
+	}
+	if rotateKey == "" || (rotation != nil && rotation.RotateKey == rotateKey) {
+		return keyRotationNone
+	}
+	return keyRotationStart
+}
+
+// pendingKeyRotationSteps returns the steps whose condition is not true yet, in order.
+func pendingKeyRotationSteps(conditions []kmapi.Condition, steps []keyRotationStep) []keyRotationStep {
+	var pending []keyRotationStep
+	for _, step := range steps {
+		if !condutil.IsConditionTrue(conditions, step.condition) {
+			pending = append(pending, step)
+		}
+	}
+	return pending
+}
+
+func (r *repositoryReconciler) startKeyRotation() error {
+	return r.updateKeyRotationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		in.KeyRotation = &api_v1alpha1.KeyRotationStatus{
+			RotateKey: r.repository.Spec.RotateKey,
+		}
+		for _, condType := range []string{
+			api_v1alpha1.KeyRotationNewKeyAdded,
+			api_v1alpha1.KeyRotationSecretUpdated,
+			api_v1alpha1.KeyRotationAccessVerified,
+			api_v1alpha1.KeyRotationOldKeyRemoved,
+		} {
+			in.Conditions = condutil.RemoveCondition(in.Conditions, condType)
+		}
+	})
+}
+
+// addNewKey stages a new password in the storage Secret and adds a key for it to the restic repository.
+// The password is staged first so that it is never lost if the rotation gets interrupted.
+func (r *repositoryReconciler) addNewKey(scratchDir string) error {
+	if err := r.ensureStorageSecretNotShared(); err != nil {
+		return err
+	}
+	secret, err := r.getStorageSecret()
+	if err != nil {
+		return err
+	}
+	password := secret.Data[stagedResticPasswordKey]
+	if len(password) == 0 {
+		password = []byte(rand.Text())
+		secret, _, err = core_util.PatchSecret(
+			context.TODO(),
+			r.ctrl.kubeClient,
+			secret,
+			func(in *core.Secret) *core.Secret {
+				if in.Data == nil {
+					in.Data = map[string][]byte{}
+				}
+				in.Data[stagedResticPasswordKey] = password
+				return in
+			},
+			metav1.PatchOptions{},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	oldWrapper, err := r.newKeyRotationWrapper(scratchDir, secret, nil)
+	if err != nil {
+		return err
+	}
+	if !oldWrapper.RepositoryAlreadyExist() {
+		return fmt.Errorf("restic repository has not been initialized yet")
+	}
+	keys, err := oldWrapper.ListKeys()
+	if err != nil {
+		return err
+	}
+	previousKeyID := currentKeyID(keys)
+	if previousKeyID == "" {
+		return fmt.Errorf("failed to identify the key of the current password")
+	}
+
+	// the key might have already been added before the rotation got interrupted
+	newWrapper, err := r.newKeyRotationWrapper(scratchDir, secret, password)
+	if err != nil {
+		return err
+	}
+	if _, err := newWrapper.ListKeys(); err != nil {
+		passwordFile := filepath.Join(scratchDir, "new-password")
+		if err := os.WriteFile(passwordFile, password, 0o600); err != nil {
+			return err
+		}
+		if err := oldWrapper.AddKey(restic.KeyOptions{File: passwordFile}); err != nil {
+			return err
+		}
+	}
+
+	return r.updateKeyRotationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		in.KeyRotation.PreviousKeyID = previousKeyID
+	})
+}
+
+// storeNewPassword replaces RESTIC_PASSWORD of the storage Secret with the staged password.
+func (r *repositoryReconciler) storeNewPassword(_ string) error {
+	if err := r.ensureStorageSecretNotShared(); err != nil {
+		return err
+	}
+	secret, err := r.getStorageSecret()
+	if err != nil {
+		return err
+	}
+	password, staged := secret.Data[stagedResticPasswordKey]
+	if !staged {
+		// the password has already been moved
+		return nil
+	}
+	_, _, err = core_util.PatchSecret(
+		context.TODO(),
+		r.ctrl.kubeClient,
+		secret,
+		func(in *core.Secret) *core.Secret {
+			in.Data[restic.RESTIC_PASSWORD] = password
+			delete(in.Data, stagedResticPasswordKey)
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return err
+}
+
+func (r *repositoryReconciler) verifyNewPassword(scratchDir string) error {
+	secret, err := r.getStorageSecret()
+	if err != nil {
+		return err
+	}
+	w, err := r.newKeyRotationWrapper(scratchDir, secret, nil)
+	if err != nil {
+		return err
+	}
+	keys, err := w.ListKeys()
+	if err != nil {
+		return err
+	}
+	if id := currentKeyID(keys); id == "" || id == r.repository.Status.KeyRotation.PreviousKeyID {
+		return fmt.Errorf("restic repository is not being accessed using the new key")
+	}
+	return nil
+}
+
+func (r *repositoryReconciler) removeOldKey(scratchDir string) error {
+	secret, err := r.getStorageSecret()
+	if err != nil {
+		return err
+	}
+	w, err := r.newKeyRotationWrapper(scratchDir, secret, nil)
+	if err != nil {
+		return err
+	}
+	keys, err := w.ListKeys()
+	if err != nil {
+		return err
+	}
+	previousKeyID := r.repository.Status.KeyRotation.PreviousKeyID
+	for _, key := range keys {
+		if key.ID == previousKeyID {
+			return w.RemoveKey(restic.KeyOptions{ID: previousKeyID})
+		}
+	}
+	return nil
+}
+
+// ensureStorageSecretNotShared refuses the rotation if the storage Secret is used by other Repositories,
+// as they would lose access to their restic repositories once the password of the Secret gets replaced.
+func (r *repositoryReconciler) ensureStorageSecretNotShared() error {
+	repositories, err := r.ctrl.repoLister.Repositories(r.repository.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	if names := repositoriesSharingSecret(r.repository, repositories); len(names) > 0 {
+		return fmt.Errorf("storage Secret %s is also used by the Repositories %s. Use a separate Secret for each Repository to rotate the key",
+			r.repository.Spec.Backend.StorageSecretName,
+			strings.Join(names, ", "),
+		)
+	}
+	return nil
+}
+
+func repositoriesSharingSecret(repository *api_v1alpha1.Repository, repositories []*api_v1alpha1.Repository) []string {
+	var names []string
+	for _, repo := range repositories {
+		if repo.Name == repository.Name || repo.Namespace != repository.Namespace {
+			continue
+		}
+		if repo.Spec.Backend.StorageSecretName == repository.Spec.Backend.StorageSecretName {
+			names = append(names, repo.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hasRunningSession checks whether any BackupSession or restore invoker using the Repository is running.
+func (r *repositoryReconciler) hasRunningSession() (bool, error) {
+	backupSessions, err := r.ctrl.backupSessionLister.BackupSessions(r.repository.Namespace).List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	for _, bs := range backupSessions {
+		if bs.Status.Phase == api_v1beta1.BackupSessionRunning && invokedByReference(bs, r.repository.Status.References) {
+			return true, nil
+		}
+	}
+	for _, ref := range r.repository.Status.References {
+		var phase api_v1beta1.RestorePhase
+		switch ref.Kind {
+		case api_v1beta1.ResourceKindRestoreSession:
+			rs, err := r.ctrl.restoreSessionLister.RestoreSessions(ref.Namespace).Get(ref.Name)
+			if err != nil {
+				if kerr.IsNotFound(err) {
+					continue
+				}
+				return false, err
+			}
+			phase = rs.Status.Phase
+		case api_v1beta1.ResourceKindRestoreBatch:
+			rb, err := r.ctrl.stashClient.StashV1beta1().RestoreBatches(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+			if err != nil {
+				if kerr.IsNotFound(err) {
+					continue
+				}
+				return false, err
+			}
+			phase = rb.Status.Phase
+		default:
+			continue
+		}
+		if phase == api_v1beta1.RestoreRunning {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *repositoryReconciler) completeKeyRotation() error {
+	if err := r.updateKeyRotationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		now := metav1.Now()
+		in.KeyRotation.CompletionTime = &now
+	}); err != nil {
+		return err
+	}
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeNormal,
+		eventer.EventReasonKeyRotationSucceeded,
+		"Restic password of the Repository has been rotated successfully.",
+	)
+	return nil
+}
+
+func (r *repositoryReconciler) handleKeyRotationFailure(step keyRotationStep, stepErr error) error {
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeWarning,
+		eventer.EventReasonKeyRotationFailed,
+		fmt.Sprintf("Key rotation step %s has failed. Reason: %v", step.condition, stepErr),
+	)
+	if err := r.setKeyRotationCondition(step, stepErr); err != nil {
+		return err
+	}
+	return stepErr
+}
+
+func (r *repositoryReconciler) setKeyRotationCondition(step keyRotationStep, stepErr error) error {
+	cond := kmapi.Condition{
+		Type:               kmapi.ConditionType(step.condition),
+		Status:             metav1.ConditionTrue,
+		Reason:             api_v1alpha1.KeyRotationStepSucceeded,
+		Message:            step.message,
+		LastTransitionTime: metav1.Now(),
+	}
+	if stepErr != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = api_v1alpha1.KeyRotationStepFailed
+		cond.Message = stepErr.Error()
+	}
+	return r.updateKeyRotationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		in.Conditions = condutil.SetCondition(in.Conditions, cond)
+	})
+}
+
+func (r *repositoryReconciler) updateKeyRotationStatus(transform func(in *api_v1alpha1.RepositoryStatus)) error {
+	var err error
+	r.repository, err = stash_util.UpdateRepositoryStatus(
+		context.TODO(),
+		r.ctrl.stashClient.StashV1alpha1(),
+		r.repository.ObjectMeta,
+		func(in *api_v1alpha1.RepositoryStatus) (types.UID, *api_v1alpha1.RepositoryStatus) {
+			transform(in)
+			return r.repository.UID, in
+		},
+		metav1.UpdateOptions{},
+	)
+	return err
+}
+
+func (r *repositoryReconciler) getStorageSecret() (*core.Secret, error) {
+	return r.ctrl.kubeClient.CoreV1().Secrets(r.repository.Namespace).Get(context.TODO(), r.repository.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+}
+
+// newKeyRotationWrapper returns a restic wrapper for the Repository. If password is not nil,
+// it is used instead of RESTIC_PASSWORD of the storage Secret.
+func (r *repositoryReconciler) newKeyRotationWrapper(scratchDir string, secret *core.Secret, password []byte) (*restic.ResticWrapper, error) {
+	if password != nil {
+		secret = secret.DeepCopy()
+		secret.Data[restic.RESTIC_PASSWORD] = password
+	}
+	setupOpt, err := util.SetupOptionsForRepository(*r.repository, util.ExtraOptions{
+		StorageSecret: secret,
+		ScratchDir:    scratchDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restic.NewResticWrapper(setupOpt)
+}
+
+func currentKeyID(keys []restic.Key) string {
+	for _, key := range keys {
+		if key.Current {
+			return key.ID
+		}
+	}
+	return ""
+}
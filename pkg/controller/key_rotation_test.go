@@ -0,0 +1,207 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	store "kmodules.xyz/objectstore-api/api/v1"
+)
+
+func TestKeyRotationActionFor(t *testing.T) {
+	now := metav1.Now()
+	testCases := []struct {
+		description string
+		rotateKey   string
+		rotation    *api_v1alpha1.KeyRotationStatus
+		expected    keyRotationAction
+	}{
+		{description: "not requested", rotateKey: "", rotation: nil, expected: keyRotationNone},
+		{description: "first rotation", rotateKey: "1", rotation: nil, expected: keyRotationStart},
+		{description: "already rotated", rotateKey: "1", rotation: &api_v1alpha1.KeyRotationStatus{RotateKey: "1", CompletionTime: &now}, expected: keyRotationNone},
+		{description: "new rotation requested", rotateKey: "2", rotation: &api_v1alpha1.KeyRotationStatus{RotateKey: "1", CompletionTime: &now}, expected: keyRotationStart},
+		{description: "rotation interrupted", rotateKey: "1", rotation: &api_v1alpha1.KeyRotationStatus{RotateKey: "1"}, expected: keyRotationResume},
+		{description: "new rotation requested during an ongoing one", rotateKey: "2", rotation: &api_v1alpha1.KeyRotationStatus{RotateKey: "1"}, expected: keyRotationResume},
+		{description: "request removed during an ongoing rotation", rotateKey: "", rotation: &api_v1alpha1.KeyRotationStatus{RotateKey: "1"}, expected: keyRotationResume},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if action := keyRotationActionFor(tc.rotateKey, tc.rotation); action != tc.expected {
+				t.Errorf("expected action %v, found %v", tc.expected, action)
+			}
+		})
+	}
+}
+
+func TestPendingKeyRotationSteps(t *testing.T) {
+	steps := []keyRotationStep{
+		{condition: api_v1alpha1.KeyRotationNewKeyAdded},
+		{condition: api_v1alpha1.KeyRotationSecretUpdated},
+		{condition: api_v1alpha1.KeyRotationAccessVerified},
+		{condition: api_v1alpha1.KeyRotationOldKeyRemoved},
+	}
+	condition := func(condType string, status metav1.ConditionStatus) kmapi.Condition {
+		return kmapi.Condition{Type: kmapi.ConditionType(condType), Status: status}
+	}
+
+	testCases := []struct {
+		description string
+		conditions  []kmapi.Condition
+		expected    []string
+	}{
+		{
+			description: "new rotation",
+			conditions:  nil,
+			expected: []string{
+				api_v1alpha1.KeyRotationNewKeyAdded,
+				api_v1alpha1.KeyRotationSecretUpdated,
+				api_v1alpha1.KeyRotationAccessVerified,
+				api_v1alpha1.KeyRotationOldKeyRemoved,
+			},
+		},
+		{
+			description: "interrupted after adding the key",
+			conditions: []kmapi.Condition{
+				condition(api_v1alpha1.KeyRotationNewKeyAdded, metav1.ConditionTrue),
+			},
+			expected: []string{
+				api_v1alpha1.KeyRotationSecretUpdated,
+				api_v1alpha1.KeyRotationAccessVerified,
+				api_v1alpha1.KeyRotationOldKeyRemoved,
+			},
+		},
+		{
+			description: "failed step is retried",
+			conditions: []kmapi.Condition{
+				condition(api_v1alpha1.KeyRotationNewKeyAdded, metav1.ConditionTrue),
+				condition(api_v1alpha1.KeyRotationSecretUpdated, metav1.ConditionTrue),
+				condition(api_v1alpha1.KeyRotationAccessVerified, metav1.ConditionFalse),
+			},
+			expected: []string{
+				api_v1alpha1.KeyRotationAccessVerified,
+				api_v1alpha1.KeyRotationOldKeyRemoved,
+			},
+		},
+		{
+			description: "all steps succeeded",
+			conditions: []kmapi.Condition{
+				condition(api_v1alpha1.KeyRotationNewKeyAdded, metav1.ConditionTrue),
+				condition(api_v1alpha1.KeyRotationSecretUpdated, metav1.ConditionTrue),
+				condition(api_v1alpha1.KeyRotationAccessVerified, metav1.ConditionTrue),
+				condition(api_v1alpha1.KeyRotationOldKeyRemoved, metav1.ConditionTrue),
+			},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var pending []string
+			for _, step := range pendingKeyRotationSteps(tc.conditions, steps) {
+				pending = append(pending, step.condition)
+			}
+			if !reflect.DeepEqual(pending, tc.expected) {
+				t.Errorf("expected pending steps %v, found %v", tc.expected, pending)
+			}
+		})
+	}
+}
+
+func TestRepositoriesSharingSecret(t *testing.T) {
+	newRepository := func(namespace, name, secret string) *api_v1alpha1.Repository {
+		return &api_v1alpha1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: api_v1alpha1.RepositorySpec{
+				Backend: store.Backend{StorageSecretName: secret},
+			},
+		}
+	}
+	repository := newRepository("demo", "repo", "secret")
+
+	testCases := []struct {
+		description  string
+		repositories []*api_v1alpha1.Repository
+		expected     []string
+	}{
+		{
+			description:  "only the repository itself",
+			repositories: []*api_v1alpha1.Repository{repository},
+			expected:     nil,
+		},
+		{
+			description: "different secrets",
+			repositories: []*api_v1alpha1.Repository{
+				repository,
+				newRepository("demo", "other", "other-secret"),
+			},
+			expected: nil,
+		},
+		{
+			description: "same secret name in another namespace",
+			repositories: []*api_v1alpha1.Repository{
+				repository,
+				newRepository("prod", "other", "secret"),
+			},
+			expected: nil,
+		},
+		{
+			description: "shared secret",
+			repositories: []*api_v1alpha1.Repository{
+				newRepository("demo", "repo-b", "secret"),
+				repository,
+				newRepository("demo", "repo-a", "secret"),
+			},
+			expected: []string{"repo-a", "repo-b"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			names := repositoriesSharingSecret(repository, tc.repositories)
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %v, found %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestCurrentKeyID(t *testing.T) {
+	testCases := []struct {
+		description string
+		keys        []restic.Key
+		expected    string
+	}{
+		{description: "no keys", keys: nil, expected: ""},
+		{description: "no current key", keys: []restic.Key{{ID: "a"}, {ID: "b"}}, expected: ""},
+		{description: "current key", keys: []restic.Key{{ID: "a"}, {ID: "b", Current: true}}, expected: "b"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if id := currentKeyID(tc.keys); id != tc.expected {
+				t.Errorf("expected key %q, found %q", tc.expected, id)
+			}
+		})
+	}
+}
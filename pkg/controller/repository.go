@@ -62,10 +62,21 @@ func (c *StashController) NewRepositoryWebhook() hooks.AdmissionHook {
 		nil,
 		&admission.ResourceHandlerFuncs{
 			CreateFunc: func(obj runtime.Object) (runtime.Object, error) {
-				return nil, obj.(*api_v1alpha1.Repository).IsValid()
+				repo := obj.(*api_v1alpha1.Repository)
+				if err := repo.IsValid(); err != nil {
+					return nil, err
+				}
+				return nil, util.ValidateReplicaCredentials(c.kubeClient, repo)
 			},
 			UpdateFunc: func(oldObj, newObj runtime.Object) (runtime.Object, error) {
-				return nil, newObj.(*api_v1alpha1.Repository).IsValid()
+				newRepo := newObj.(*api_v1alpha1.Repository)
+				if err := newRepo.IsValid(); err != nil {
+					return nil, err
+				}
+				if err := util.ValidateReplicaCredentials(c.kubeClient, newRepo); err != nil {
+					return nil, err
+				}
+				return nil, validateImmutabilityUpdate(oldObj.(*api_v1alpha1.Repository), newRepo)
 			},
 		},
 	)
@@ -121,6 +132,19 @@ func (c *StashController) runRepositoryReconciler(v any) error {
 			if err := r.ensureFinalizer(); err != nil {
 				return err
 			}
+			if err := r.ensureObjectLock(); err != nil {
+				return err
+			}
+			if err := r.rotateKey(); err != nil {
+				return err
+			}
+			if err := r.migrateRepository(); err != nil {
+				return err
+			}
+			if err := r.ensureMaintenanceCronJobs(); err != nil {
+				r.reportMaintenanceFailure(err)
+				return err
+			}
 		}
 		if err := r.requeueReferences(); err != nil {
 			return err
@@ -154,10 +178,19 @@ func (r *repositoryReconciler) cleanupOffshoots() error {
 	if core_util.HasFinalizer(r.repository.ObjectMeta, apis.RepositoryFinalizer) {
 		// ignore invalid repository objects (eg: created by xray).
 		if r.repository.IsValid() == nil && r.repository.Spec.WipeOut {
-			err := r.deleteResticRepository()
+			// snapshots under the lock of the immutability policy must not be deleted
+			lockedUntil, err := r.snapshotsLockedUntil()
 			if err != nil {
 				return err
 			}
+			if lockedUntil != nil {
+				r.skipWipeOut(lockedUntil)
+			} else if err := r.deleteResticRepository(); err != nil {
+				return err
+			}
+		}
+		if err := r.cleanupMaintenanceRBAC(); err != nil {
+			return err
 		}
 
 		var err error
@@ -0,0 +1,211 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/rbac"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	batchutil "kmodules.xyz/client-go/batch"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+	ofst "kmodules.xyz/offshoot-api/api/v1"
+	ofst_util "kmodules.xyz/offshoot-api/util"
+)
+
+var maintenanceTasks = []api_v1alpha1.MaintenanceTask{
+	api_v1alpha1.MaintenanceTaskCheck,
+	api_v1alpha1.MaintenanceTaskPrune,
+	api_v1alpha1.MaintenanceTaskUnlock,
+}
+
+// ensureMaintenanceCronJobs ensures a CronJob for each maintenance task enabled in the Repository
+// and removes the CronJobs of the disabled tasks.
+func (r *repositoryReconciler) ensureMaintenanceCronJobs() error {
+	schedules := r.repository.MaintenanceSchedules()
+
+	var serviceAccountName string
+	for _, task := range maintenanceTasks {
+		schedule, enabled := schedules[task]
+		if !enabled {
+			err := batchutil.DeleteCronJob(context.TODO(), r.ctrl.kubeClient, types.NamespacedName{
+				Name:      r.maintenanceCronJobName(task),
+				Namespace: r.repository.Namespace,
+			})
+			if err != nil && !kerr.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+
+		if serviceAccountName == "" {
+			var err error
+			if serviceAccountName, err = r.ensureMaintenanceRBAC(); err != nil {
+				return err
+			}
+		}
+		if err := r.ensureMaintenanceCronJob(task, schedule, serviceAccountName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repositoryReconciler) ensureMaintenanceCronJob(task api_v1alpha1.MaintenanceTask, schedule, serviceAccountName string) error {
+	owner := metav1.NewControllerRef(r.repository, api_v1alpha1.SchemeGroupVersion.WithKind(api_v1alpha1.ResourceKindRepository))
+	cronMeta := metav1.ObjectMeta{
+		Name:      r.maintenanceCronJobName(task),
+		Namespace: r.repository.Namespace,
+		Labels:    r.maintenanceLabels(),
+	}
+
+	imagePullSecrets, err := r.maintenanceImagePullSecrets()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = batchutil.CreateOrPatchCronJob(
+		context.TODO(),
+		r.ctrl.kubeClient,
+		cronMeta,
+		func(in *batch.CronJob) *batch.CronJob {
+			core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+
+			in.Spec.Schedule = schedule
+			// a maintenance task must not run in parallel with itself
+			in.Spec.ConcurrencyPolicy = batch.ForbidConcurrent
+			in.Spec.JobTemplate.Labels = meta_util.OverwriteKeys(in.Spec.JobTemplate.Labels, r.maintenanceLabels())
+			in.Spec.JobTemplate.Spec.Template.Labels = meta_util.OverwriteKeys(in.Spec.JobTemplate.Spec.Template.Labels, r.maintenanceLabels())
+
+			r.setMaintenancePodSpec(
+				&in.Spec.JobTemplate.Spec.Template.Spec,
+				[]string{fmt.Sprintf("--task=%s", task)},
+				serviceAccountName,
+				imagePullSecrets,
+			)
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return err
+}
+
+// setMaintenancePodSpec configures the pod of a Job that runs the `maintain-repository` command with the given extra arguments.
+func (r *repositoryReconciler) setMaintenancePodSpec(podSpec *core.PodSpec, args []string, serviceAccountName string, imagePullSecrets []core.LocalObjectReference) {
+	var runtimeSettings ofst.RuntimeSettings
+	if r.repository.Spec.Maintenance != nil {
+		runtimeSettings = r.repository.Spec.Maintenance.RuntimeSettings
+	}
+
+	container := core.Container{
+		Name:            apis.StashContainer,
+		ImagePullPolicy: core.PullIfNotPresent,
+		Image:           r.ctrl.getDockerImage().ToContainerImage(),
+		Args: append([]string{
+			"maintain-repository",
+			fmt.Sprintf("--repo-name=%s", r.repository.Name),
+			fmt.Sprintf("--repo-namespace=%s", r.repository.Namespace),
+		}, args...),
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      apis.ScratchDirVolumeName,
+				MountPath: apis.ScratchDirMountPath,
+			},
+		},
+	}
+	if runtimeSettings.Container != nil {
+		container.Resources = runtimeSettings.Container.Resources
+		container.Env = runtimeSettings.Container.Env
+		container.EnvFrom = runtimeSettings.Container.EnvFrom
+		container.SecurityContext = runtimeSettings.Container.SecurityContext
+	}
+
+	podSpec.Containers = core_util.UpsertContainer(podSpec.Containers, container)
+	podSpec.Volumes = core_util.UpsertVolume(podSpec.Volumes, core.Volume{
+		Name: apis.ScratchDirVolumeName,
+		VolumeSource: core.VolumeSource{
+			EmptyDir: &core.EmptyDirVolumeSource{},
+		},
+	})
+	podSpec.RestartPolicy = core.RestartPolicyNever
+	podSpec.ServiceAccountName = serviceAccountName
+	podSpec.ImagePullSecrets = imagePullSecrets
+	if runtimeSettings.Pod != nil {
+		*podSpec = ofst_util.ApplyPodRuntimeSettings(*podSpec, *runtimeSettings.Pod)
+	}
+}
+
+// ensureMaintenanceRBAC ensures the RBAC resources of the maintenance Jobs and returns the name of their ServiceAccount.
+func (r *repositoryReconciler) ensureMaintenanceRBAC() (string, error) {
+	rbacOptions := rbac.NewRepositoryRBACOptions(r.ctrl.kubeClient, r.repository, r.maintenanceLabels())
+	if r.repository.Spec.Maintenance != nil {
+		rbacOptions.SetOptionsFromRuntimeSettings(r.repository.Spec.Maintenance.RuntimeSettings)
+	}
+	if err := rbacOptions.EnsureMaintenanceJobRBAC(); err != nil {
+		return "", err
+	}
+	return rbacOptions.GetServiceAccountName(), nil
+}
+
+// maintenanceImagePullSecrets returns the image pull Secrets of the maintenance Jobs.
+func (r *repositoryReconciler) maintenanceImagePullSecrets() ([]core.LocalObjectReference, error) {
+	if r.ctrl.ImagePullSecrets == nil {
+		return nil, nil
+	}
+	owner := metav1.NewControllerRef(r.repository, api_v1alpha1.SchemeGroupVersion.WithKind(api_v1alpha1.ResourceKindRepository))
+	return r.ctrl.ensureImagePullSecrets(r.repository.ObjectMeta, owner)
+}
+
+// cleanupMaintenanceRBAC removes the cluster scoped RBAC resources of the maintenance Jobs.
+// The namespaced resources are garbage collected along with the Repository. The cleanup does not depend on
+// `spec.maintenance`, as the maintenance might have been disabled after the resources have been created.
+func (r *repositoryReconciler) cleanupMaintenanceRBAC() error {
+	return rbac.NewRepositoryRBACOptions(r.ctrl.kubeClient, r.repository, r.maintenanceLabels()).EnsureRBACResourcesDeleted()
+}
+
+func (r *repositoryReconciler) reportMaintenanceFailure(err error) {
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeWarning,
+		eventer.EventReasonMaintenanceCronJobCreationFailed,
+		fmt.Sprintf("Failed to ensure the maintenance CronJobs. Reason: %v", err),
+	)
+}
+
+func (r *repositoryReconciler) maintenanceCronJobName(task api_v1alpha1.MaintenanceTask) string {
+	return meta_util.ValidCronJobNameWithPrefixNSuffix(apis.PrefixStashMaintenance, r.repository.Name, string(task))
+}
+
+func (r *repositoryReconciler) maintenanceLabels() map[string]string {
+	return map[string]string{
+		meta_util.ComponentLabelKey: api_v1beta1.StashMaintenanceComponent,
+		meta_util.ManagedByLabelKey: api_v1beta1.StashKey,
+	}
+}
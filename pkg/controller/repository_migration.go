@@ -0,0 +1,288 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	stash_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1alpha1/util"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	batch_util "kmodules.xyz/client-go/batch/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+)
+
+// migrateRepository migrates the restic repository to the format version requested by the
+// `stash.appscode.com/migrate-repository` annotation. The BackupConfigurations and BackupBatches using the Repository
+// are paused during the migration and resumed afterwards. The migration runs in a Job once the running and pending
+// BackupSessions have been completed. The annotation is removed once the migration has been completed.
+func (r *repositoryReconciler) migrateRepository() error {
+	version, requested := r.repository.Annotations[apis.KeyMigrateRepository]
+	if !requested {
+		return nil
+	}
+	if version != apis.MigrateRepositoryToV2 {
+		return r.failMigration(version, fmt.Errorf("unsupported repository format version %q", version))
+	}
+
+	migration := r.repository.Status.Migration
+	if migration == nil || migration.Phase != api_v1alpha1.RepositoryMigrationRunning {
+		if err := r.startMigration(version); err != nil {
+			return err
+		}
+	}
+
+	job, err := r.ctrl.kubeClient.BatchV1().Jobs(r.repository.Namespace).Get(context.TODO(), r.migrationJobName(), metav1.GetOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	if kerr.IsNotFound(err) {
+		// the migration needs an exclusive lock on the restic repository
+		active, err := util.HasActiveBackupSession(r.ctrl.stashClient, r.repository.Status.References)
+		if err != nil {
+			return err
+		}
+		if active {
+			r.logger.Info("Waiting for the running and pending backups to complete before migrating the repository")
+			return r.requeueMigration()
+		}
+		if err := r.ensureMigrationJob(); err != nil {
+			return r.failMigration(version, err)
+		}
+		return r.requeueMigration()
+	}
+
+	switch {
+	case jobConditionTrue(job, batch.JobComplete):
+		if err := r.deleteMigrationJob(); err != nil {
+			return err
+		}
+		return r.completeMigration()
+	case jobConditionTrue(job, batch.JobFailed):
+		if err := r.deleteMigrationJob(); err != nil {
+			return err
+		}
+		migrationErr := fmt.Errorf("migration Job %s/%s has failed", job.Namespace, job.Name)
+		if msg := r.repository.Status.Migration.Message; msg != "" {
+			migrationErr = fmt.Errorf("%s", msg)
+		}
+		return r.failMigration(version, migrationErr)
+	default:
+		return r.requeueMigration()
+	}
+}
+
+func (r *repositoryReconciler) startMigration(version string) error {
+	paused, pauseErr := util.PauseBackupInvokers(r.ctrl.stashClient, r.repository.Status.References)
+	// record the paused invokers even if some of them failed to pause, so that they get resumed
+	err := r.updateMigrationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		now := metav1.Now()
+		in.Migration = &api_v1alpha1.RepositoryMigrationStatus{
+			Version:        version,
+			Phase:          api_v1alpha1.RepositoryMigrationRunning,
+			PausedInvokers: paused,
+			StartTime:      &now,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if pauseErr != nil {
+		return r.failMigration(version, pauseErr)
+	}
+	return nil
+}
+
+// ensureMigrationJob creates the Job that runs the migration using the maintenance ServiceAccount and runtime settings.
+func (r *repositoryReconciler) ensureMigrationJob() error {
+	serviceAccountName, err := r.ensureMaintenanceRBAC()
+	if err != nil {
+		return err
+	}
+	imagePullSecrets, err := r.maintenanceImagePullSecrets()
+	if err != nil {
+		return err
+	}
+
+	owner := metav1.NewControllerRef(r.repository, api_v1alpha1.SchemeGroupVersion.WithKind(api_v1alpha1.ResourceKindRepository))
+	jobMeta := metav1.ObjectMeta{
+		Name:      r.migrationJobName(),
+		Namespace: r.repository.Namespace,
+		Labels:    r.maintenanceLabels(),
+	}
+	_, _, err = batch_util.CreateOrPatchJob(
+		context.TODO(),
+		r.ctrl.kubeClient,
+		jobMeta,
+		func(in *batch.Job) *batch.Job {
+			core_util.EnsureOwnerReference(&in.ObjectMeta, owner)
+
+			// a failed migration is reported instead of being retried
+			in.Spec.BackoffLimit = ptr.To(int32(0))
+			in.Spec.Template.Labels = meta_util.OverwriteKeys(in.Spec.Template.Labels, r.maintenanceLabels())
+			r.setMaintenancePodSpec(
+				&in.Spec.Template.Spec,
+				[]string{
+					fmt.Sprintf("--task=%s", util.MaintenanceTaskMigrate),
+					fmt.Sprintf("--repack-uncompressed=%v", r.repository.Annotations[apis.KeyRepackUncompressed] == "true"),
+				},
+				serviceAccountName,
+				imagePullSecrets,
+			)
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return err
+}
+
+func (r *repositoryReconciler) deleteMigrationJob() error {
+	deletePolicy := metav1.DeletePropagationBackground
+	err := r.ctrl.kubeClient.BatchV1().Jobs(r.repository.Namespace).Delete(context.TODO(), r.migrationJobName(), metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	})
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *repositoryReconciler) requeueMigration() error {
+	key, err := cache.MetaNamespaceKeyFunc(r.repository)
+	if err != nil {
+		return err
+	}
+	r.ctrl.repoQueue.GetQueue().AddAfter(key, requeueTimeInterval)
+	return nil
+}
+
+func (r *repositoryReconciler) completeMigration() error {
+	if err := util.ResumeBackupInvokers(r.ctrl.stashClient, r.repository.Status.Migration.PausedInvokers); err != nil {
+		return err
+	}
+	if err := r.updateMigrationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		now := metav1.Now()
+		in.Migration.Phase = api_v1alpha1.RepositoryMigrationSucceeded
+		in.Migration.PausedInvokers = nil
+		in.Migration.CompletionTime = &now
+		in.Migration.Message = ""
+	}); err != nil {
+		return err
+	}
+	if err := r.removeMigrationAnnotation(); err != nil {
+		return err
+	}
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeNormal,
+		eventer.EventReasonRepositoryMigrationSucceeded,
+		fmt.Sprintf("Restic repository has been migrated to %s.", r.repository.Status.Migration.Version),
+	)
+	return nil
+}
+
+// failMigration resumes the paused invokers and removes the annotation,
+// so that the migration is not retried until the Repository is annotated again.
+func (r *repositoryReconciler) failMigration(version string, migrationErr error) error {
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRepositoryController,
+		r.repository,
+		core.EventTypeWarning,
+		eventer.EventReasonRepositoryMigrationFailed,
+		fmt.Sprintf("Failed to migrate the restic repository. Reason: %v", migrationErr),
+	)
+	if migration := r.repository.Status.Migration; migration != nil && migration.Phase == api_v1alpha1.RepositoryMigrationRunning {
+		if err := util.ResumeBackupInvokers(r.ctrl.stashClient, migration.PausedInvokers); err != nil {
+			return err
+		}
+	}
+	if err := r.updateMigrationStatus(func(in *api_v1alpha1.RepositoryStatus) {
+		now := metav1.Now()
+		if in.Migration == nil || in.Migration.Phase != api_v1alpha1.RepositoryMigrationRunning {
+			in.Migration = &api_v1alpha1.RepositoryMigrationStatus{
+				Version:   version,
+				StartTime: &now,
+			}
+		}
+		in.Migration.Phase = api_v1alpha1.RepositoryMigrationFailed
+		in.Migration.PausedInvokers = nil
+		in.Migration.CompletionTime = &now
+		in.Migration.Message = migrationErr.Error()
+	}); err != nil {
+		return err
+	}
+	return r.removeMigrationAnnotation()
+}
+
+func (r *repositoryReconciler) removeMigrationAnnotation() error {
+	var err error
+	r.repository, _, err = stash_util.PatchRepository(
+		context.TODO(),
+		r.ctrl.stashClient.StashV1alpha1(),
+		r.repository,
+		func(in *api_v1alpha1.Repository) *api_v1alpha1.Repository {
+			delete(in.Annotations, apis.KeyMigrateRepository)
+			delete(in.Annotations, apis.KeyRepackUncompressed)
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return err
+}
+
+func (r *repositoryReconciler) updateMigrationStatus(transform func(in *api_v1alpha1.RepositoryStatus)) error {
+	var err error
+	r.repository, err = stash_util.UpdateRepositoryStatus(
+		context.TODO(),
+		r.ctrl.stashClient.StashV1alpha1(),
+		r.repository.ObjectMeta,
+		func(in *api_v1alpha1.RepositoryStatus) (types.UID, *api_v1alpha1.RepositoryStatus) {
+			transform(in)
+			return r.repository.UID, in
+		},
+		metav1.UpdateOptions{},
+	)
+	return err
+}
+
+func (r *repositoryReconciler) migrationJobName() string {
+	return meta_util.ValidNameWithPrefixNSuffix(apis.PrefixStashMaintenance, r.repository.Name, util.MaintenanceTaskMigrate)
+}
+
+func jobConditionTrue(job *batch.Job, condType batch.JobConditionType) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == condType && cond.Status == core.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
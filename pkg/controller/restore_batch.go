@@ -0,0 +1,90 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// The RestoreBatches are reconciled by the enterprise operator. This watcher only derives the members of the
+// RestoreBatches that refer to a BackupSession, so that they are processed like the ones whose members are listed by hand.
+func (c *StashController) initRestoreBatchWatcher() {
+	c.restoreBatchInformer = c.stashInformerFactory.Stash().V1beta1().RestoreBatches().Informer()
+	c.restoreBatchQueue = queue.New[any](api_v1beta1.ResourceKindRestoreBatch, c.MaxNumRequeues, c.NumThreads, c.processRestoreBatchEvent)
+	_, _ = c.restoreBatchInformer.AddEventHandler(queue.DefaultEventHandler(c.restoreBatchQueue.GetQueue(), core.NamespaceAll))
+}
+
+func (c *StashController) processRestoreBatchEvent(v any) error {
+	key := v.(string)
+	obj, exists, err := c.restoreBatchInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		klog.ErrorS(err, "Failed to fetch object from indexer",
+			apis.ObjectKind, api_v1beta1.ResourceKindRestoreBatch,
+			apis.ObjectKey, key,
+		)
+		return err
+	}
+	if !exists {
+		klog.V(4).InfoS("Object does not exit anymore",
+			apis.ObjectKind, api_v1beta1.ResourceKindRestoreBatch,
+			apis.ObjectKey, key,
+		)
+		return nil
+	}
+
+	restoreBatch := obj.(*api_v1beta1.RestoreBatch)
+	if restoreBatch.DeletionTimestamp != nil || restoreBatch.Spec.BackupSession == nil || len(restoreBatch.Spec.Members) != 0 {
+		return nil
+	}
+	klog.V(4).InfoS("Resolving members from BackupSession",
+		apis.ObjectKind, api_v1beta1.ResourceKindRestoreBatch,
+		apis.ObjectName, restoreBatch.Name,
+		apis.ObjectNamespace, restoreBatch.Namespace,
+	)
+
+	updated, err := util.EnsureRestoreBatchMembers(c.clientConfig, c.stashClient, restoreBatch.DeepCopy())
+	if err != nil {
+		eventer.CreateEventWithLog(
+			c.kubeClient,
+			eventer.EventSourceRestoreBatchController,
+			restoreBatch,
+			core.EventTypeWarning,
+			eventer.EventReasonRestoreBatchMembersResolveFailed,
+			fmt.Sprintf("Failed to resolve the members from BackupSession %q. Reason: %v", restoreBatch.Spec.BackupSession.Name, err),
+		)
+		// requeue so that a BackupSession that has not completed yet is retried
+		return err
+	}
+	eventer.CreateEventWithLog(
+		c.kubeClient,
+		eventer.EventSourceRestoreBatchController,
+		restoreBatch,
+		core.EventTypeNormal,
+		eventer.EventReasonRestoreBatchMembersResolved,
+		fmt.Sprintf("Resolved %d members from BackupSession %q.", len(updated.Spec.Members), restoreBatch.Spec.BackupSession.Name),
+	)
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/conditions"
+	"stash.appscode.dev/apimachinery/pkg/invoker"
+	"stash.appscode.dev/stash/pkg/util"
+)
+
+// planRestore resolves what the dry run RestoreSession would restore and records it in the status.
+// Only the Repository is read. No executor is created, so the target workloads and volumes are left untouched.
+func (r *restoreInvokerReconciler) planRestore() error {
+	repository, err := r.invoker.GetRepository()
+	if err != nil {
+		return err
+	}
+
+	var target *api_v1beta1.RestoreTarget
+	if targets := r.invoker.GetTargetInfo(); len(targets) > 0 {
+		target = targets[0].Target
+	}
+	plan, err := util.PlanRestore(r.ctrl.kubeClient, r.invoker.GetObjectMeta().Namespace, repository, r.invoker.GetDriver(), target)
+	if err != nil {
+		r.logger.Error(err, "Failed to create restore plan")
+		return conditions.SetRestorePlanCreatedConditionToFalse(r.invoker, err)
+	}
+
+	if err := r.invoker.UpdateStatus(invoker.RestoreInvokerStatus{Plan: plan}); err != nil {
+		return err
+	}
+	r.logger.Info("Created restore plan", apis.KeyReason, fmt.Sprintf("Restore of %d host(s) has been planned", len(plan)))
+	return conditions.SetRestorePlanCreatedConditionToTrue(r.invoker)
+}
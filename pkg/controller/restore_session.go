@@ -47,7 +47,6 @@ import (
 	hooks "kmodules.xyz/webhook-runtime/admission/v1beta1"
 	webhook "kmodules.xyz/webhook-runtime/admission/v1beta1/generic"
 	wapi "kmodules.xyz/webhook-runtime/apis/workload/v1"
-	wcs "kmodules.xyz/webhook-runtime/client/workload/v1"
 )
 
 type restoreInvokerReconciler struct {
@@ -257,6 +256,21 @@ func (r *restoreInvokerReconciler) reconcile() error {
 		}
 	}
 
+	// a dry run only reports what would be restored
+	if r.invoker.IsDryRun() {
+		return r.planRestore()
+	}
+
+	// the backups with a lower priority should not compete with the restore for the repository
+	holdRestore, err := r.preemptLowerPriorityBackups()
+	if err != nil {
+		return err
+	}
+	if holdRestore && !r.anyTargetRestoreInitiated() {
+		r.logger.Info("Waiting for the running backups with a lower priority to complete")
+		return r.requeue(requeueTimeInterval)
+	}
+
 	if r.shouldExecuteGlobalPreRestoreHook() {
 		if err := r.executeGlobalPreRestoreHook(); err != nil {
 			return conditions.SetGlobalPreRestoreHookSucceededConditionToFalse(r.invoker, err)
@@ -324,7 +338,8 @@ func (r *restoreInvokerReconciler) isAlreadyInFinalPhase() bool {
 	phase := r.invoker.GetStatus().Phase
 	return phase == api_v1beta1.RestoreSucceeded ||
 		phase == api_v1beta1.RestoreFailed ||
-		phase == api_v1beta1.RestorePhaseUnknown
+		phase == api_v1beta1.RestorePhaseUnknown ||
+		phase == api_v1beta1.RestorePlanned
 }
 
 func (r *restoreInvokerReconciler) isDeadlineExceeded() bool {
@@ -364,7 +379,7 @@ func (r *restoreInvokerReconciler) setDeadline(timeOut time.Duration) error {
 }
 
 func restorerExecutorType(targetInfo invoker.RestoreTargetInfo, driver api_v1beta1.Snapshotter) executor.Type {
-	if util.RestoreModel(targetInfo.Target.Ref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
+	if util.RestoreModel(targetInfo.Target.Ref.APIVersion, targetInfo.Target.Ref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
 		return executor.TypeInitContainer
 	} else if driver == api_v1beta1.VolumeSnapshotter {
 		return executor.TypeCSISnapshotRestorer
@@ -519,6 +534,15 @@ func (r *restoreInvokerReconciler) executeGlobalPreRestoreHook() error {
 	return conditions.SetGlobalPreRestoreHookSucceededConditionToTrue(r.invoker)
 }
 
+func (r *restoreInvokerReconciler) anyTargetRestoreInitiated() bool {
+	for _, targetInfo := range r.invoker.GetTargetInfo() {
+		if targetInfo.Target != nil && r.targetRestoreInitiated(targetInfo.Target.Ref) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *restoreInvokerReconciler) targetRestoreInitiated(targetRef api_v1beta1.TargetRef) bool {
 	status := r.invoker.GetStatus()
 	if invoker.TargetRestoreCompleted(targetRef, status.TargetStatus) {
@@ -629,7 +653,7 @@ func (r *restoreInvokerReconciler) ensureRestoreExecutor(targetInfo invoker.Rest
 		if err != nil {
 			return err
 		}
-		w, err := wcs.ConvertToWorkload(obj.DeepCopyObject())
+		w, err := util.ConvertToWorkload(obj.DeepCopyObject())
 		if err != nil {
 			return err
 		}
@@ -679,6 +703,7 @@ func (c *StashController) newInitContainerExecutor(inv invoker.RestoreInvoker, w
 	e := &executor.InitContainer{
 		KubeClient:        c.kubeClient,
 		OpenshiftClient:   c.ocClient,
+		DynamicClient:     c.dynamicClient,
 		StashClient:       c.stashClient,
 		RBACOptions:       rbacOptions,
 		Invoker:           inv,
@@ -772,9 +797,10 @@ func (c *StashController) newRestoreJobExecutor(inv invoker.RestoreInvoker, inde
 func (r *restoreInvokerReconciler) cleanupRestoreInvokerOffshoots(invokerRef *core.ObjectReference) error {
 	for _, targetInfo := range r.invoker.GetTargetInfo() {
 		target := targetInfo.Target
-		if target != nil && util.RestoreModel(target.Ref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
+		if target != nil && util.RestoreModel(target.Ref.APIVersion, target.Ref.Kind, targetInfo.Task.Name) == apis.ModelSidecar {
 			// send event to workload controller. workload controller will take care of removing restore init-container
 			err := r.ctrl.sendEventToWorkloadQueue(
+				target.Ref.APIVersion,
 				target.Ref.Kind,
 				target.Ref.Namespace,
 				target.Ref.Name,
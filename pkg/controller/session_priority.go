@@ -0,0 +1,191 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/conditions"
+	"stash.appscode.dev/apimachinery/pkg/invoker"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/executor"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	condutil "kmodules.xyz/client-go/conditions"
+)
+
+// getBackupSessionPriority returns the priority of the invoker of the BackupSession.
+// The sessions of a deleted invoker are treated with the default priority.
+func (c *StashController) getBackupSessionPriority(bs *api_v1beta1.BackupSession) int32 {
+	if bs.Spec.Invoker.Kind == api_v1beta1.ResourceKindBackupConfiguration {
+		bc, err := c.bcLister.BackupConfigurations(bs.Namespace).Get(bs.Spec.Invoker.Name)
+		if err != nil {
+			return 0
+		}
+		return bc.Spec.Priority
+	}
+	// there is no lister for the other invokers
+	inv, err := invoker.NewBackupInvoker(c.stashClient, bs.Spec.Invoker.Kind, bs.Spec.Invoker.Name, bs.Namespace)
+	if err != nil {
+		return 0
+	}
+	return inv.GetPriority()
+}
+
+// aheadInBackupQueue returns true if the other waiting BackupSession gets a backup slot before the current one.
+// The sessions with a higher priority go first and the sessions with the same priority go in the order they were created.
+func (r *backupSessionReconciler) aheadInBackupQueue(other *api_v1beta1.BackupSession) bool {
+	priority := r.invoker.GetPriority()
+	otherPriority := r.ctrl.getBackupSessionPriority(other)
+	if otherPriority != priority {
+		return otherPriority > priority
+	}
+	return shouldKeepCurrentSessionPending(r.session.GetBackupSession(), other)
+}
+
+// getHigherPriorityRestoreSession returns an incomplete RestoreSession that uses the same Repository
+// as the BackupSession and has a higher priority than it.
+func (r *backupSessionReconciler) getHigherPriorityRestoreSession() (*api_v1beta1.RestoreSession, error) {
+	restoreSessions, err := r.ctrl.restoreSessionLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	priority := r.invoker.GetPriority()
+	repoRef := r.invoker.GetRepoRef()
+	for _, rs := range restoreSessions {
+		if rs.Spec.DryRun || rs.Spec.Priority <= priority || invoker.IsRestoreCompleted(rs.Status.Phase) {
+			continue
+		}
+		repoNamespace := rs.Spec.Repository.Namespace
+		if repoNamespace == "" {
+			repoNamespace = rs.Namespace
+		}
+		if rs.Spec.Repository.Name == repoRef.Name && repoNamespace == repoRef.Namespace {
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
+
+func isBackupPreempted(bs *api_v1beta1.BackupSession) bool {
+	return condutil.IsConditionTrue(bs.Status.Conditions, api_v1beta1.BackupPreempted)
+}
+
+// preemptLowerPriorityBackups preempts the running BackupSessions that use the same Repository as the restore
+// and have a lower priority than it. The preempted sessions are retried once the restore has completed.
+// A backup running in a sidecar can not be interrupted, so it is left running and true is returned
+// to hold the restore until it completes.
+func (r *restoreInvokerReconciler) preemptLowerPriorityBackups() (bool, error) {
+	repoRef := r.invoker.GetRepoRef()
+	repository, err := r.ctrl.repoLister.Repositories(repoRef.Namespace).Get(repoRef.Name)
+	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	backupSessions, err := r.ctrl.backupSessionLister.List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	priority := r.invoker.GetPriority()
+	hold := false
+	for _, bs := range backupSessions {
+		if bs.Status.Phase != api_v1beta1.BackupSessionRunning ||
+			isBackupPreempted(bs) ||
+			!invokedByReference(bs, repository.Status.References) ||
+			r.ctrl.getBackupSessionPriority(bs) >= priority {
+			continue
+		}
+		inv, err := invoker.NewBackupInvoker(r.ctrl.stashClient, bs.Spec.Invoker.Kind, bs.Spec.Invoker.Name, bs.Namespace)
+		if err != nil {
+			if kerr.IsNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		if runsInSidecar(inv) {
+			hold = true
+			continue
+		}
+		if err := r.preemptBackupSession(bs); err != nil {
+			return false, err
+		}
+	}
+	return hold, nil
+}
+
+// runsInSidecar returns true if any target of the invoker is backed up by a sidecar.
+func runsInSidecar(inv invoker.BackupInvoker) bool {
+	for _, targetInfo := range inv.GetTargetInfo() {
+		if targetInfo.Target != nil && backupExecutorType(inv, targetInfo) == executor.TypeSidecar {
+			return true
+		}
+	}
+	return false
+}
+
+// preemptBackupSession marks the BackupSession as preempted and stops its backup Jobs.
+func (r *restoreInvokerReconciler) preemptBackupSession(bs *api_v1beta1.BackupSession) error {
+	msg := fmt.Sprintf("Backup has been preempted by %s %s/%s with a higher priority.",
+		r.invoker.GetTypeMeta().Kind,
+		r.invoker.GetObjectMeta().Namespace,
+		r.invoker.GetObjectMeta().Name,
+	)
+	r.logger.Info("Preempting backup",
+		apis.KeyInvokerKind, bs.Spec.Invoker.Kind,
+		apis.KeyInvokerName, bs.Spec.Invoker.Name,
+		apis.KeyInvokerNamespace, bs.Namespace,
+	)
+	session := invoker.NewBackupSessionHandler(r.ctrl.stashClient, bs.DeepCopy())
+	if err := conditions.SetBackupPreemptedConditionToTrue(session, msg); err != nil {
+		return err
+	}
+
+	jobs, err := r.ctrl.jobLister.Jobs(bs.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	deletePolicy := metav1.DeletePropagationBackground
+	for _, job := range jobs {
+		if !metav1.IsControlledBy(job, bs) {
+			continue
+		}
+		err := r.ctrl.kubeClient.BatchV1().Jobs(job.Namespace).Delete(context.TODO(), job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+		})
+		if err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+	}
+
+	eventer.CreateEventWithLog(
+		r.ctrl.kubeClient,
+		eventer.EventSourceRestoreSessionController,
+		bs,
+		core.EventTypeWarning,
+		eventer.EventReasonBackupPreempted,
+		msg,
+	)
+	return nil
+}
@@ -43,7 +43,6 @@ import (
 	meta_util "kmodules.xyz/client-go/meta"
 	ocapps "kmodules.xyz/openshift/apis/apps/v1"
 	wapi "kmodules.xyz/webhook-runtime/apis/workload/v1"
-	wcs "kmodules.xyz/webhook-runtime/client/workload/v1"
 )
 
 type workloadReconciler struct {
@@ -177,7 +176,7 @@ func (opt *invokerOptions) injectBackupSidecar() error {
 				return opt.handleSidecarInjectionFailure(inv, err)
 			}
 			if verb != kutil.VerbUnchanged {
-				opt.workload, err = wcs.ConvertToWorkload(obj)
+				opt.workload, err = util.ConvertToWorkload(obj)
 				if err != nil {
 					return err
 				}
@@ -214,7 +213,7 @@ func (opt *invokerOptions) removeBackupSidecar() error {
 				return opt.handleSidecarDeletionFailure(err)
 			}
 			if verb != kutil.VerbUnchanged {
-				opt.workload, err = wcs.ConvertToWorkload(obj)
+				opt.workload, err = util.ConvertToWorkload(obj)
 				if err != nil {
 					return err
 				}
@@ -292,7 +291,7 @@ func (opt *invokerOptions) injectRestoreInitContainer() error {
 				return opt.handleInitContainerInjectionFailure(inv, err)
 			}
 			if verb != kutil.VerbUnchanged {
-				opt.workload, err = wcs.ConvertToWorkload(obj)
+				opt.workload, err = util.ConvertToWorkload(obj)
 				if err != nil {
 					return err
 				}
@@ -330,7 +329,7 @@ func (opt *invokerOptions) removeRestoreInitContainer() error {
 				return opt.handleInitContainerDeletionFailure(err)
 			}
 			if verb != kutil.VerbUnchanged {
-				opt.workload, err = wcs.ConvertToWorkload(obj)
+				opt.workload, err = util.ConvertToWorkload(obj)
 				if err != nil {
 					return err
 				}
@@ -342,7 +341,7 @@ func (opt *invokerOptions) removeRestoreInitContainer() error {
 	return nil
 }
 
-func (c *StashController) sendEventToWorkloadQueue(kind, namespace, resourceName string) error {
+func (c *StashController) sendEventToWorkloadQueue(apiVersion, kind, namespace, resourceName string) error {
 	switch kind {
 	case wapi.KindDeployment:
 		if resource, err := c.dpLister.Deployments(namespace).Get(resourceName); err == nil {
@@ -377,6 +376,14 @@ func (c *StashController) sendEventToWorkloadQueue(kind, namespace, resourceName
 				return err
 			}
 		}
+	default:
+		if resource, w, err := c.getAdaptedWorkload(apiVersion, kind, namespace, resourceName); err == nil {
+			key, err := cache.MetaNamespaceKeyFunc(resource)
+			if err == nil {
+				w.queue.GetQueue().Add(key)
+			}
+			return err
+		}
 	}
 	return nil
 }
@@ -481,6 +488,10 @@ func (c *StashController) getTargetWorkload(targetRef api_v1beta1.TargetRef) (ru
 		dc.GetObjectKind().SetGroupVersionKind(ocapps.GroupVersion.WithKind(apis.KindDeploymentConfig))
 		return dc, nil
 	default:
+		if _, ok := util.GetWorkloadAdapter(targetRef.APIVersion, targetRef.Kind); ok {
+			u, _, err := c.getAdaptedWorkload(targetRef.APIVersion, targetRef.Kind, targetRef.Namespace, targetRef.Name)
+			return u, err
+		}
 		return nil, fmt.Errorf("failed to get target workload. Reason: unknown kind %s", targetRef.Kind)
 	}
 }
@@ -0,0 +1,140 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	stash_rbac "stash.appscode.dev/stash/pkg/rbac"
+	"stash.appscode.dev/stash/pkg/util"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// workloadAdapterWatcher watches the resources of a kind registered through a workload adapter
+type workloadAdapterWatcher struct {
+	adapter  util.WorkloadAdapter
+	queue    *queue.Worker[any]
+	informer cache.SharedIndexInformer
+	lister   cache.GenericLister
+}
+
+func (c *StashController) initWorkloadAdapterWatchers() {
+	c.adapterWatchers = map[schema.GroupKind]*workloadAdapterWatcher{}
+	for _, a := range util.WorkloadAdapters() {
+		kind := a.GroupVersionKind.Kind
+		informer := c.dynamicInformerFactory.ForResource(a.GroupVersionResource())
+
+		w := &workloadAdapterWatcher{
+			adapter:  a,
+			informer: informer.Informer(),
+			lister:   informer.Lister(),
+		}
+		w.queue = queue.New[any](kind, c.MaxNumRequeues, c.NumThreads, func(v any) error {
+			return c.processWorkloadAdapterEvent(w, v)
+		})
+		_, _ = w.informer.AddEventHandler(queue.DefaultEventHandler(w.queue.GetQueue(), core.NamespaceAll))
+		c.adapterWatchers[a.GroupVersionKind.GroupKind()] = w
+	}
+}
+
+func (c *StashController) processWorkloadAdapterEvent(w *workloadAdapterWatcher, v any) error {
+	kind := w.adapter.GroupVersionKind.Kind
+	key := v.(string)
+	obj, exists, err := w.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		klog.ErrorS(err, "Failed to fetch object from indexer",
+			apis.ObjectKind, kind,
+			apis.ObjectKey, key,
+		)
+		return err
+	}
+
+	if !exists {
+		klog.V(4).InfoS("Object doesn't exist anymore",
+			apis.ObjectKind, kind,
+			apis.ObjectKey, key,
+		)
+
+		ns, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return err
+		}
+		// workload does not exist anymore. so delete respective ConfigMapLocks if exist
+		err = util.DeleteAllConfigMapLocks(c.kubeClient, ns, name, kind)
+		if err != nil && !kerr.IsNotFound(err) {
+			return err
+		}
+	} else {
+		u := obj.(*unstructured.Unstructured).DeepCopy()
+		u.SetGroupVersionKind(w.adapter.GroupVersionKind)
+
+		logger := klog.NewKlogr().WithValues(
+			apis.ObjectKind, kind,
+			apis.ObjectName, u.GetName(),
+			apis.ObjectNamespace, u.GetNamespace(),
+		)
+		logger.V(4).Info("Received Sync/Add/Update event")
+
+		// convert the resource into a generic Workload type using its adapter
+		wl, err := w.adapter.NewWorkload(u)
+		if err != nil {
+			logger.Error(err, "Failed to convert into generic workload type")
+			return err
+		}
+
+		r := workloadReconciler{
+			ctrl:     c,
+			logger:   logger,
+			workload: wl,
+		}
+		if err := r.reconcile(apis.CallerController); err != nil {
+			r.logger.Error(err, "Failed to reconcile workload")
+			return err
+		}
+
+		// if the workload does not have any stash sidecar/init-container then
+		// delete respective ConfigMapLock and RBAC stuffs if exist
+		if err := c.ensureUnnecessaryConfigMapLockDeleted(wl); err != nil {
+			return err
+		}
+		return stash_rbac.EnsureUnnecessaryWorkloadRBACDeleted(c.kubeClient, logger, wl)
+	}
+	return nil
+}
+
+// getAdaptedWorkload returns the resource registered through a workload adapter from the cache
+func (c *StashController) getAdaptedWorkload(apiVersion, kind, namespace, name string) (*unstructured.Unstructured, *workloadAdapterWatcher, error) {
+	w, ok := c.adapterWatchers[schema.FromAPIVersionAndKind(apiVersion, kind).GroupKind()]
+	if !ok {
+		return nil, nil, fmt.Errorf("no workload adapter is registered for %s", kind)
+	}
+	obj, err := w.lister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+	u.SetGroupVersionKind(w.adapter.GroupVersionKind)
+	return u, w, nil
+}
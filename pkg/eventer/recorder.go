@@ -38,11 +38,14 @@ const (
 	EventSourceBackupConfigurationController = "BackupConfiguration Controller"
 	EventSourceBackupSessionController       = "BackupSession Controller"
 	EventSourceRestoreSessionController      = "RestoreSession Controller"
+	EventSourceRestoreBatchController        = "RestoreBatch Controller"
 	EventSourceWorkloadController            = "Workload Controller"
 	EventSourceBackupSidecar                 = "Backup Sidecar"
 	EventSourceRestoreInitContainer          = "Restore Init-Container"
 	EventSourceBackupTriggeringCronJob       = "Backup Triggering CronJob"
 	EventSourceStatusUpdater                 = "Status Updater"
+	EventSourceRepositoryController          = "Repository Controller"
+	EventSourceRepositoryMaintenanceJob      = "Repository Maintenance Job"
 
 	// ======================= Event Reasons ========================
 	// BackupConfiguration Events
@@ -67,6 +70,30 @@ const (
 	EventReasonInitContainerDeletionSucceeded  = "Init-Container Deletion Succeeded"
 
 	EventReasonWorkloadControllerTriggeringFailed = "Failed To Trigger Workload Controller"
+
+	EventReasonBackupVerificationSucceeded = "Backup Verification Succeeded"
+	EventReasonBackupVerificationFailed    = "Backup Verification Failed"
+
+	EventReasonBackupAnomalyDetected = "Backup Anomaly Detected"
+
+	EventReasonRepositoryReplicationFailed = "Repository Replication Failed"
+
+	EventReasonObjectLockConfigurationFailed = "Object Lock Configuration Failed"
+	EventReasonRepositoryWipeOutSkipped      = "Repository WipeOut Skipped"
+
+	EventReasonKeyRotationSucceeded = "Key Rotation Succeeded"
+	EventReasonKeyRotationFailed    = "Key Rotation Failed"
+
+	EventReasonMaintenanceCronJobCreationFailed = "Maintenance CronJob Creation Failed"
+	EventReasonRepositoryMaintenanceFailed      = "Repository Maintenance Failed"
+
+	EventReasonRepositoryMigrationSucceeded = "Repository Migration Succeeded"
+	EventReasonRepositoryMigrationFailed    = "Repository Migration Failed"
+
+	EventReasonBackupPreempted = "Backup Preempted"
+
+	EventReasonRestoreBatchMembersResolved      = "RestoreBatch Members Resolved"
+	EventReasonRestoreBatchMembersResolveFailed = "RestoreBatch Members Resolve Failed"
 )
 
 func NewEventRecorder(client kubernetes.Interface, component string) record.EventRecorder {
@@ -76,7 +76,7 @@ func (e *BackupJob) Ensure() (runtime.Object, kutil.VerbType, error) {
 		kubeClient:         e.KubeClient,
 		meta:               jobMeta,
 		owner:              ownerBackupSession,
-		podSpec:            podSpec,
+		podSpec:            util.UpsertNodeBandwidthLimitInPodSpec(podSpec),
 		podLabels:          e.Invoker.GetLabels(),
 		serviceAccountName: e.RBACOptions.GetServiceAccountName(),
 		imagePullSecrets:   e.ImagePullSecrets,
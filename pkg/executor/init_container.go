@@ -34,6 +34,8 @@ import (
 	stringz "gomodules.xyz/x/strings"
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	kutil "kmodules.xyz/client-go"
 	core_util "kmodules.xyz/client-go/core/v1"
@@ -41,12 +43,12 @@ import (
 	ofst_util "kmodules.xyz/offshoot-api/util"
 	oc_cs "kmodules.xyz/openshift/client/clientset/versioned"
 	wapi "kmodules.xyz/webhook-runtime/apis/workload/v1"
-	wcs "kmodules.xyz/webhook-runtime/client/workload/v1"
 )
 
 type InitContainer struct {
 	KubeClient        kubernetes.Interface
 	OpenshiftClient   oc_cs.Interface
+	DynamicClient     dynamic.Interface
 	StashClient       cs.Interface
 	RBACOptions       *rbac.Options
 	ImagePullSecrets  []core.LocalObjectReference
@@ -87,7 +89,9 @@ func (e *InitContainer) Ensure() (runtime.Object, kutil.VerbType, error) {
 	e.Workload.Spec.Template.Annotations[api_v1beta1.AppliedRestoreInvokerSpecHash] = e.Invoker.GetHash()
 
 	// insert restore init container
-	initContainers := []core.Container{e.newRestoreInitContainer()}
+	initContainer, volumes := util.UpsertNodeBandwidthLimit(e.newRestoreInitContainer(), e.Workload.Spec.Template.Spec.Volumes)
+	e.Workload.Spec.Template.Spec.Volumes = volumes
+	initContainers := []core.Container{initContainer}
 	for i := range e.Workload.Spec.Template.Spec.InitContainers {
 		initContainers = core_util.UpsertContainer(initContainers, e.Workload.Spec.Template.Spec.InitContainers[i])
 	}
@@ -119,7 +123,7 @@ func (e *InitContainer) Ensure() (runtime.Object, kutil.VerbType, error) {
 	setRollingUpdate(e.Workload)
 
 	// apply changes of workload to original object
-	if err := wcs.ApplyWorkload(e.Workload.Object, e.Workload); err != nil {
+	if err := util.ApplyWorkload(e.Workload); err != nil {
 		return nil, kutil.VerbUnchanged, err
 	}
 
@@ -128,7 +132,7 @@ func (e *InitContainer) Ensure() (runtime.Object, kutil.VerbType, error) {
 	if e.Caller == apis.CallerWebhook {
 		return nil, kutil.VerbUnchanged, nil
 	}
-	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.Workload, oldObj)
+	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.DynamicClient, e.Workload, oldObj)
 }
 
 func (e *InitContainer) Cleanup() (runtime.Object, kutil.VerbType, error) {
@@ -145,6 +149,7 @@ func (e *InitContainer) Cleanup() (runtime.Object, kutil.VerbType, error) {
 	if !util.HasStashContainer(e.Workload) {
 		// remove the helpers volumes added for init-container
 		e.Workload.Spec.Template.Spec.Volumes = util.EnsureVolumeDeleted(e.Workload.Spec.Template.Spec.Volumes, apis.ScratchDirVolumeName)
+		e.Workload.Spec.Template.Spec.Volumes = util.EnsureVolumeDeleted(e.Workload.Spec.Template.Spec.Volumes, apis.BandwidthVolumeName)
 	}
 
 	// remove respective annotations
@@ -157,7 +162,7 @@ func (e *InitContainer) Cleanup() (runtime.Object, kutil.VerbType, error) {
 	setRollingUpdate(e.Workload)
 
 	// apply changes of workload to original object
-	if err := wcs.ApplyWorkload(e.Workload.Object, e.Workload); err != nil {
+	if err := util.ApplyWorkload(e.Workload); err != nil {
 		return nil, kutil.VerbUnchanged, err
 	}
 
@@ -166,7 +171,7 @@ func (e *InitContainer) Cleanup() (runtime.Object, kutil.VerbType, error) {
 	if e.Caller == apis.CallerWebhook {
 		return nil, kutil.VerbUnchanged, nil
 	}
-	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.Workload, oldObj)
+	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.DynamicClient, e.Workload, oldObj)
 }
 
 func (e *InitContainer) newRestoreInitContainer() core.Container {
@@ -207,6 +212,18 @@ func (e *InitContainer) newRestoreInitContainer() core.Container {
 		},
 	}
 
+	// the container has to know about the workload adapters to identify its host and the source host
+	ref := targetInfo.Target.Ref
+	if a, ok := util.GetWorkloadAdapter(ref.APIVersion, ref.Kind); ok {
+		initContainer.Args = append(initContainer.Args, "--workload-adapter="+a.String())
+	}
+	if src := targetInfo.Target.Source; src != nil {
+		srcGK := schema.FromAPIVersionAndKind(src.APIVersion, src.Kind).GroupKind()
+		if a, ok := util.GetWorkloadAdapter(src.APIVersion, src.Kind); ok && srcGK != schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind).GroupKind() {
+			initContainer.Args = append(initContainer.Args, "--workload-adapter="+a.String())
+		}
+	}
+
 	// mount tmp volume
 	initContainer.VolumeMounts = util.UpsertTmpVolumeMount(initContainer.VolumeMounts)
 
@@ -207,7 +207,7 @@ func (e *RestoreJob) ensureJob(jobMeta metav1.ObjectMeta, podSpec core.PodSpec)
 		kubeClient:         e.KubeClient,
 		meta:               jobMeta,
 		owner:              e.Invoker.GetOwnerRef(),
-		podSpec:            podSpec,
+		podSpec:            util.UpsertNodeBandwidthLimitInPodSpec(podSpec),
 		podLabels:          e.Invoker.GetLabels(),
 		serviceAccountName: e.RBACOptions.GetServiceAccountName(),
 		imagePullSecrets:   e.ImagePullSecrets,
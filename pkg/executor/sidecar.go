@@ -38,24 +38,27 @@ import (
 	core "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	kutil "kmodules.xyz/client-go"
 	apps_util "kmodules.xyz/client-go/apps/v1"
 	core_util "kmodules.xyz/client-go/core/v1"
+	dynamic_util "kmodules.xyz/client-go/dynamic"
 	"kmodules.xyz/client-go/tools/clientcmd"
 	ofst_util "kmodules.xyz/offshoot-api/util"
 	ocapps "kmodules.xyz/openshift/apis/apps/v1"
 	oc_cs "kmodules.xyz/openshift/client/clientset/versioned"
 	ocapps_util "kmodules.xyz/openshift/client/clientset/versioned/typed/apps/v1/util"
 	wapi "kmodules.xyz/webhook-runtime/apis/workload/v1"
-	wcs "kmodules.xyz/webhook-runtime/client/workload/v1"
 )
 
 type Sidecar struct {
 	KubeClient        kubernetes.Interface
 	OpenshiftClient   oc_cs.Interface
+	DynamicClient     dynamic.Interface
 	StashClient       cs.Interface
 	RBACOptions       *rbac.Options
 	ImagePullSecrets  []core.LocalObjectReference
@@ -69,6 +72,12 @@ type Sidecar struct {
 }
 
 func (e *Sidecar) Ensure() (runtime.Object, kutil.VerbType, error) {
+	// the backup sidecar never exits. so, it would keep the pods that run to completion (i.e. the pods of
+	// a custom resource that creates Jobs) from ever completing.
+	if policy := e.Workload.Spec.Template.Spec.RestartPolicy; policy == core.RestartPolicyNever || policy == core.RestartPolicyOnFailure {
+		return nil, kutil.VerbUnchanged, fmt.Errorf("the pods of %s %s/%s run to completion. They can't be backed up by a sidecar. Use a backup Task instead",
+			e.Workload.Kind, e.Workload.Namespace, e.Workload.Name)
+	}
 	oldObj := e.Workload.Object.DeepCopyObject()
 	sa := stringz.Val(e.Workload.Spec.Template.Spec.ServiceAccountName, "default")
 	e.RBACOptions.SetServiceAccountName(sa)
@@ -98,10 +107,12 @@ func (e *Sidecar) Ensure() (runtime.Object, kutil.VerbType, error) {
 		return nil, kutil.VerbUnchanged, fmt.Errorf("target is nil")
 	}
 
+	sidecar, volumes := util.UpsertNodeBandwidthLimit(e.newBackupSidecar(), e.Workload.Spec.Template.Spec.Volumes)
 	e.Workload.Spec.Template.Spec.Containers = core_util.UpsertContainer(
 		e.Workload.Spec.Template.Spec.Containers,
-		e.newBackupSidecar(),
+		sidecar,
 	)
+	e.Workload.Spec.Template.Spec.Volumes = volumes
 
 	e.Workload.Spec.Template.Spec.Volumes = util.UpsertTmpVolume(e.Workload.Spec.Template.Spec.Volumes, targetInfo.TempDir)
 
@@ -119,7 +130,7 @@ func (e *Sidecar) Ensure() (runtime.Object, kutil.VerbType, error) {
 	setRollingUpdate(e.Workload)
 
 	// apply changes of workload to original object
-	if err := wcs.ApplyWorkload(e.Workload.Object, e.Workload); err != nil {
+	if err := util.ApplyWorkload(e.Workload); err != nil {
 		return nil, kutil.VerbUnchanged, err
 	}
 
@@ -128,7 +139,7 @@ func (e *Sidecar) Ensure() (runtime.Object, kutil.VerbType, error) {
 	if e.Caller == apis.CallerWebhook {
 		return nil, kutil.VerbUnchanged, nil
 	}
-	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.Workload, oldObj)
+	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.DynamicClient, e.Workload, oldObj)
 }
 
 func (e *Sidecar) Cleanup() (runtime.Object, kutil.VerbType, error) {
@@ -145,6 +156,7 @@ func (e *Sidecar) Cleanup() (runtime.Object, kutil.VerbType, error) {
 	if !util.HasStashContainer(e.Workload) {
 		// remove the helpers volumes that were added for sidecar
 		e.Workload.Spec.Template.Spec.Volumes = util.EnsureVolumeDeleted(e.Workload.Spec.Template.Spec.Volumes, apis.ScratchDirVolumeName)
+		e.Workload.Spec.Template.Spec.Volumes = util.EnsureVolumeDeleted(e.Workload.Spec.Template.Spec.Volumes, apis.BandwidthVolumeName)
 	}
 
 	// remove respective annotations
@@ -157,7 +169,7 @@ func (e *Sidecar) Cleanup() (runtime.Object, kutil.VerbType, error) {
 	setRollingUpdate(e.Workload)
 
 	// apply changes of workload to original object
-	if err := wcs.ApplyWorkload(e.Workload.Object, e.Workload); err != nil {
+	if err := util.ApplyWorkload(e.Workload); err != nil {
 		return nil, kutil.VerbUnchanged, err
 	}
 	// we don't need to patch the workload when the caller is webhook.
@@ -165,7 +177,7 @@ func (e *Sidecar) Cleanup() (runtime.Object, kutil.VerbType, error) {
 	if e.Caller == apis.CallerWebhook {
 		return nil, kutil.VerbUnchanged, nil
 	}
-	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.Workload, oldObj)
+	return ensureWorkloadLatestState(e.KubeClient, e.OpenshiftClient, e.DynamicClient, e.Workload, oldObj)
 }
 
 func (e *Sidecar) newBackupSidecar() core.Container {
@@ -207,6 +219,11 @@ func (e *Sidecar) newBackupSidecar() core.Container {
 		},
 	}
 
+	// the container has to know about the workload adapter to identify its host
+	if a, ok := util.GetWorkloadAdapter(targetInfo.Target.Ref.APIVersion, targetInfo.Target.Ref.Kind); ok {
+		sidecar.Args = append(sidecar.Args, "--workload-adapter="+a.String())
+	}
+
 	// mount tmp volume
 	sidecar.VolumeMounts = util.UpsertTmpVolumeMount(sidecar.VolumeMounts)
 
@@ -229,6 +246,7 @@ func (e *Sidecar) newBackupSidecar() core.Container {
 func ensureWorkloadLatestState(
 	kubeClient kubernetes.Interface,
 	ocClient oc_cs.Interface,
+	dynamicClient dynamic.Interface,
 	w *wapi.Workload,
 	oldObj runtime.Object,
 ) (runtime.Object, kutil.VerbType, error) {
@@ -267,7 +285,13 @@ func ensureWorkloadLatestState(
 			return updatedObj, verb, util.WaitUntilDeploymentConfigReady(ocClient, oldObj.(*ocapps.DeploymentConfig).ObjectMeta)
 		}
 	default:
-		return nil, kutil.VerbUnchanged, fmt.Errorf("unkown workload kind: %s", w.Kind)
+		a, ok := util.GetWorkloadAdapter(w.APIVersion, w.Kind)
+		if !ok {
+			return nil, kutil.VerbUnchanged, fmt.Errorf("unkown workload kind: %s", w.Kind)
+		}
+		// the workloads registered through an adapter don't have any common readiness condition.
+		// so, we don't wait for them to be ready after patching.
+		return dynamic_util.PatchObject(context.TODO(), dynamicClient, a.GroupVersionResource(), oldObj.(*unstructured.Unstructured), w.Object.(*unstructured.Unstructured), metav1.PatchOptions{})
 	}
 	return nil, kutil.VerbUnchanged, nil
 }
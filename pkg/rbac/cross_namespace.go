@@ -61,7 +61,7 @@ func (opt *Options) ensureCrossNamespaceRole() error {
 				APIGroups:     []string{core.SchemeGroupVersion.Group},
 				Resources:     []string{"secrets", "pods", "endpoints"},
 				Verbs:         []string{"get"},
-				ResourceNames: []string{opt.crossNamespaceResources.Secret},
+				ResourceNames: opt.crossNamespaceResources.Secrets,
 			},
 		}
 		return in
@@ -0,0 +1,68 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewRepositoryRBACOptions returns the RBAC options for the maintenance Jobs of a Repository.
+func NewRepositoryRBACOptions(kubeClient kubernetes.Interface, repo *v1alpha1.Repository, labels map[string]string) *Options {
+	return &Options{
+		kubeClient: kubeClient,
+		invOpts: invokerOptions{
+			ObjectMeta: repo.ObjectMeta,
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       v1alpha1.ResourceKindRepository,
+			},
+		},
+		owner:          metav1.NewControllerRef(repo, v1alpha1.SchemeGroupVersion.WithKind(v1alpha1.ResourceKindRepository)),
+		offshootLabels: labels,
+		serviceAccount: metav1.ObjectMeta{
+			Namespace: repo.Namespace,
+		},
+		suffix: "0",
+	}
+}
+
+// EnsureMaintenanceJobRBAC ensures the RBAC resources for the maintenance Jobs of a Repository.
+// The maintenance Jobs access the same resources as the backup Jobs, so the backup Job ClusterRole is used.
+func (opt *Options) EnsureMaintenanceJobRBAC() error {
+	if opt.serviceAccount.Name == "" {
+		opt.serviceAccount.Name = opt.getRoleBindingName()
+		err := opt.ensureServiceAccount()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := opt.ensureBackupJobClusterRole()
+	if err != nil {
+		return err
+	}
+
+	err = opt.ensureBackupJobRoleBinding()
+	if err != nil {
+		return err
+	}
+
+	return opt.ensureLicenseReaderClusterRoleBinding()
+}
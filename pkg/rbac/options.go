@@ -46,7 +46,7 @@ type invokerOptions struct {
 type crossNamespaceResources struct {
 	Namespace  string
 	Repository string
-	Secret     string
+	Secrets    []string
 }
 
 func NewRBACOptions(
@@ -73,7 +73,11 @@ func NewRBACOptions(
 		rbacOptions.crossNamespaceResources = &crossNamespaceResources{
 			Repository: repo.Name,
 			Namespace:  repo.Namespace,
-			Secret:     repo.Spec.Backend.StorageSecretName,
+			Secrets:    []string{repo.Spec.Backend.StorageSecretName},
+		}
+		// the backup process needs to access the storage Secrets of the replicas as well
+		for _, replica := range repo.Spec.Replicas {
+			rbacOptions.crossNamespaceResources.Secrets = append(rbacOptions.crossNamespaceResources.Secrets, replica.Backend.StorageSecretName)
 		}
 	}
 	rbacOptions.suffix = "0"
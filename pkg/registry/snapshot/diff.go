@@ -0,0 +1,202 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"stash.appscode.dev/apimachinery/apis/repositories"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/util"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+const QueryParamAgainst = "against"
+
+// DiffREST implements the `diff` subresource of a Snapshot.
+// It reports the changes made in the snapshot compared to another snapshot of the same repository.
+type DiffREST struct {
+	snapshots *REST
+}
+
+var (
+	_ rest.Storage   = &DiffREST{}
+	_ rest.Connecter = &DiffREST{}
+)
+
+func NewDiffREST(snapshots *REST) *DiffREST {
+	return &DiffREST{snapshots: snapshots}
+}
+
+func (r *DiffREST) New() runtime.Object {
+	return &repositories.SnapshotDiff{}
+}
+
+func (r *DiffREST) Destroy() {}
+
+func (r *DiffREST) ConnectMethods() []string {
+	return []string{http.MethodGet}
+}
+
+func (r *DiffREST) NewConnectOptions() (runtime.Object, bool, string) {
+	return nil, false, ""
+}
+
+func (r *DiffREST) Connect(ctx context.Context, name string, _ runtime.Object, responder rest.Responder) (http.Handler, error) {
+	opt, err := r.snapshots.getSnapshotOptions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		against := req.URL.Query().Get(QueryParamAgainst)
+		if against == "" {
+			responder.Error(apierrors.NewBadRequest(fmt.Sprintf("missing query parameter %q", QueryParamAgainst)))
+			return
+		}
+		repoName, baseID, err := util.GetRepoNameAndSnapshotID(against)
+		if err != nil {
+			responder.Error(apierrors.NewBadRequest(err.Error()))
+			return
+		}
+		if repoName != opt.Repository.Name {
+			responder.Error(apierrors.NewBadRequest(fmt.Sprintf("snapshot %q does not belong to Repository %q", against, opt.Repository.Name)))
+			return
+		}
+
+		diffOpt := *opt
+		diffOpt.SnapshotIDs = []string{baseID, opt.SnapshotIDs[0]}
+		diff, err := r.snapshots.DiffSnapshotsFromBackend(diffOpt)
+		if err != nil {
+			responder.Error(apierrors.NewInternalError(err))
+			return
+		}
+		diff.Name = name
+		diff.Namespace = opt.Repository.Namespace
+		diff.Status.Against = against
+		responder.Object(http.StatusOK, diff)
+	}), nil
+}
+
+// DiffSnapshotsFromBackend compares the two snapshots of the options. The first snapshot is used as the base,
+// so the added entries are the entries that exist only in the second snapshot.
+func (r *REST) DiffSnapshotsFromBackend(opt Options) (*repositories.SnapshotDiff, error) {
+	if len(opt.SnapshotIDs) != 2 {
+		return nil, fmt.Errorf("exactly two snapshots are required to compute the diff. found: %d", len(opt.SnapshotIDs))
+	}
+	if opt.Repository.Spec.Backend.Local != nil && !opt.InCluster {
+		return nil, fmt.Errorf("local backend isn't supported in Stash community edition")
+	}
+	return r.diffSnapshotsFromBackend(opt)
+}
+
+func (r *REST) diffSnapshotsFromBackend(opt Options) (*repositories.SnapshotDiff, error) {
+	resticWrapper, tempDir, err := newResticWrapper(opt)
+	if err != nil {
+		return nil, err
+	}
+	defer util.RemoveDirWithLogErr(tempDir)
+
+	base, target := opt.SnapshotIDs[0], opt.SnapshotIDs[1]
+	changes, stats, err := resticWrapper.DiffSnapshots(base, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// restic does not report the size of the changed entries, so we look them up from both snapshots.
+	// Only the changed entries are kept while walking the snapshots.
+	changed := make(map[string]struct{}, len(changes))
+	for _, change := range changes {
+		changed[diffChangePath(change)] = struct{}{}
+	}
+	oldNodes, err := findSnapshotNodes(resticWrapper, base, changed)
+	if err != nil {
+		return nil, err
+	}
+	newNodes, err := findSnapshotNodes(resticWrapper, target, changed)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &repositories.SnapshotDiff{}
+	for _, change := range changes {
+		entry := repositories.SnapshotDiffEntry{
+			Path:     diffChangePath(change),
+			Modifier: change.Modifier,
+		}
+		if node, ok := oldNodes[entry.Path]; ok {
+			entry.Type = node.Type
+			entry.OldSize = int64(node.Size)
+		}
+		if node, ok := newNodes[entry.Path]; ok {
+			entry.Type = node.Type
+			entry.NewSize = int64(node.Size)
+		}
+		entry.SizeDelta = entry.NewSize - entry.OldSize
+
+		switch change.Modifier {
+		case "+":
+			diff.Status.Added = append(diff.Status.Added, entry)
+		case "-":
+			diff.Status.Removed = append(diff.Status.Removed, entry)
+		default:
+			diff.Status.Modified = append(diff.Status.Modified, entry)
+		}
+	}
+
+	if stats != nil {
+		diff.Status.Stats = repositories.SnapshotDiffStats{
+			AddedFiles:    stats.Added.Files,
+			RemovedFiles:  stats.Removed.Files,
+			ModifiedFiles: stats.ChangedFiles,
+			AddedBytes:    int64(stats.Added.Bytes),
+			RemovedBytes:  int64(stats.Removed.Bytes),
+		}
+	}
+	return diff, nil
+}
+
+// diffChangePath returns the path of a changed entry in the format used by "restic ls".
+func diffChangePath(change restic.DiffChange) string {
+	// restic appends a "/" to the path of the directories
+	return path.Clean("/" + strings.TrimSuffix(change.Path, "/"))
+}
+
+// findSnapshotNodes returns the nodes of the snapshot whose paths are in the given set.
+func findSnapshotNodes(resticWrapper *restic.ResticWrapper, snapshotID string, paths map[string]struct{}) (map[string]restic.SnapshotFile, error) {
+	nodesByPath := make(map[string]restic.SnapshotFile)
+	if len(paths) == 0 {
+		return nodesByPath, nil
+	}
+	err := resticWrapper.WalkSnapshotFiles(snapshotID, func(node restic.SnapshotFile) error {
+		if _, ok := paths[node.Path]; ok {
+			nodesByPath[node.Path] = node
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodesByPath, nil
+}
@@ -0,0 +1,286 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"stash.appscode.dev/apimachinery/apis/repositories"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/util"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ContentTypeTar         = "application/x-tar"
+	ContentTypeOctetStream = "application/octet-stream"
+)
+
+// DownloadREST implements the `download` subresource of a Snapshot.
+// It streams a single file of the snapshot, or a tar archive if the requested path is a directory.
+// The output of `restic dump` is piped directly into the response. A single byte range of a file can be
+// requested through the Range header. The size of a tar archive is not known in advance, so the whole
+// archive is always sent for a directory.
+type DownloadREST struct {
+	snapshots *REST
+}
+
+var (
+	_ rest.Storage   = &DownloadREST{}
+	_ rest.Connecter = &DownloadREST{}
+)
+
+func NewDownloadREST(snapshots *REST) *DownloadREST {
+	return &DownloadREST{snapshots: snapshots}
+}
+
+func (r *DownloadREST) New() runtime.Object {
+	return &repositories.Snapshot{}
+}
+
+func (r *DownloadREST) Destroy() {}
+
+func (r *DownloadREST) ConnectMethods() []string {
+	return []string{http.MethodGet}
+}
+
+func (r *DownloadREST) NewConnectOptions() (runtime.Object, bool, string) {
+	return nil, false, ""
+}
+
+func (r *DownloadREST) Connect(ctx context.Context, name string, _ runtime.Object, responder rest.Responder) (http.Handler, error) {
+	opt, err := r.snapshots.getSnapshotOptions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		filePath := req.URL.Query().Get(QueryParamPath)
+		if filePath == "" {
+			responder.Error(apierrors.NewBadRequest(fmt.Sprintf("missing query parameter %q", QueryParamPath)))
+			return
+		}
+		filePath = path.Clean("/" + filePath)
+
+		resticWrapper, tempDir, err := newResticWrapper(*opt)
+		if err != nil {
+			responder.Error(apierrors.NewInternalError(err))
+			return
+		}
+		defer util.RemoveDirWithLogErr(tempDir)
+
+		node, err := findSnapshotFile(resticWrapper, opt.SnapshotIDs[0], filePath)
+		if err != nil {
+			responder.Error(apierrors.NewInternalError(err))
+			return
+		}
+		if node == nil {
+			responder.Error(apierrors.NewNotFound(repositories.Resource("files"), filePath))
+			return
+		}
+
+		fileName := node.Name
+		contentType := ContentTypeOctetStream
+		if node.Type == "dir" {
+			fileName = node.Name + ".tar"
+			contentType = ContentTypeTar
+		}
+		if filePath == "/" {
+			fileName = name + ".tar"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+		if !node.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", node.ModTime.UTC().Format(http.TimeFormat))
+		}
+
+		err = serveDump(w, req, node, responder, func(out io.Writer) error {
+			return resticWrapper.DumpSnapshotFile(opt.SnapshotIDs[0], filePath, out)
+		})
+		if err != nil {
+			// the status has already been sent, so the client only sees a truncated body
+			klog.Errorf("failed to stream %s from snapshot %s. Reason: %v", filePath, name, err)
+		}
+	}), nil
+}
+
+// serveDump writes the output of dump into the response. For a file, it serves the byte range requested
+// through the Range header with status 206. It returns the error that occurred after the response had started.
+func serveDump(w http.ResponseWriter, req *http.Request, node *restic.SnapshotFile, responder rest.Responder, dump func(io.Writer) error) error {
+	out := &responseWriter{ResponseWriter: w, status: http.StatusOK, remaining: -1}
+	if node.Type == "file" {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.FormatUint(node.Size, 10))
+
+		if rangeHeader := req.Header.Get("Range"); rangeHeader != "" && ifRangeMatches(req, w.Header()) {
+			start, length, err := parseByteRange(rangeHeader, node.Size)
+			if err != nil {
+				w.Header().Del("Content-Length")
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", node.Size))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return nil
+			}
+			if length >= 0 {
+				w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, node.Size))
+				out.status = http.StatusPartialContent
+				out.skip = start
+				out.remaining = length
+			}
+		}
+	} else {
+		w.Header().Set("Accept-Ranges", "none")
+	}
+
+	if err := dump(out); err != nil {
+		if !out.written {
+			w.Header().Del("Content-Length")
+			w.Header().Del("Content-Range")
+			responder.Error(apierrors.NewInternalError(err))
+			return nil
+		}
+		return err
+	}
+	if !out.written {
+		// empty file or empty range of the output. send the status anyway.
+		w.WriteHeader(out.status)
+	}
+	return nil
+}
+
+// ifRangeMatches checks the If-Range precondition of a range request. A range is served only if the file
+// has not been modified since the given date. An entity tag never matches as no ETag is sent.
+func ifRangeMatches(req *http.Request, header http.Header) bool {
+	ifRange := req.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	return ifRange == header.Get("Last-Modified")
+}
+
+// parseByteRange parses a Range header of a file of the given size. It returns the start and the length
+// of the requested range. A length of -1 means the header has to be ignored and the whole file is sent,
+// i.e. for multiple ranges or a unit other than bytes. An error is returned if the range can't be satisfied.
+func parseByteRange(header string, size uint64) (int64, int64, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, -1, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, -1, nil
+	}
+	total := int64(size)
+
+	var start, end int64
+	if first == "" {
+		// suffix range, i.e. the last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, -1, nil
+		}
+		if n == 0 || total == 0 {
+			return 0, 0, fmt.Errorf("invalid range %q for a file of %d bytes", header, size)
+		}
+		start, end = max(total-n, 0), total-1
+	} else {
+		var err error
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return 0, -1, nil
+		}
+		end = total - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return 0, -1, nil
+			}
+			end = min(end, total-1)
+		}
+		if start >= total {
+			return 0, 0, fmt.Errorf("invalid range %q for a file of %d bytes", header, size)
+		}
+	}
+	return start, end - start + 1, nil
+}
+
+// responseWriter writes the requested range of the content into the response. It records whether
+// any content has been written, so that an error can still be reported before the response has started.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+	// skip is the number of bytes to discard before the range starts
+	skip int64
+	// remaining is the number of bytes of the range still to write. -1 means no limit.
+	remaining int64
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if w.skip > 0 {
+		discard := min(int64(len(p)), w.skip)
+		w.skip -= discard
+		p = p[discard:]
+	}
+	if w.remaining >= 0 {
+		// restic keeps dumping the rest of the file. it is discarded after the end of the range.
+		p = p[:min(int64(len(p)), w.remaining)]
+		w.remaining -= int64(len(p))
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+	if !w.written {
+		w.written = true
+		w.WriteHeader(w.status)
+	}
+	if _, err := w.ResponseWriter.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// findSnapshotFile returns the node of the given path from the snapshot. It returns nil if the path does not exist.
+func findSnapshotFile(resticWrapper *restic.ResticWrapper, snapshotID string, filePath string) (*restic.SnapshotFile, error) {
+	if filePath == "/" {
+		return &restic.SnapshotFile{Name: "/", Type: "dir", Path: filePath}, nil
+	}
+	var node *restic.SnapshotFile
+	err := resticWrapper.WalkSnapshotDir(snapshotID, path.Dir(filePath), func(n restic.SnapshotFile) error {
+		if n.Path == filePath {
+			node = &n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type fakeResponder struct {
+	err error
+}
+
+func (r *fakeResponder) Object(_ int, _ runtime.Object) {}
+
+func (r *fakeResponder) Error(err error) {
+	r.err = err
+}
+
+func TestServeDumpRange(t *testing.T) {
+	content := "0123456789"
+	file := &restic.SnapshotFile{Name: "data.txt", Type: "file", Size: uint64(len(content))}
+	dir := &restic.SnapshotFile{Name: "data", Type: "dir"}
+
+	testCases := []struct {
+		description          string
+		node                 *restic.SnapshotFile
+		rangeHeader          string
+		ifRange              string
+		expectedStatus       int
+		expectedBody         string
+		expectedContentRange string
+		expectedAcceptRanges string
+	}{
+		{description: "whole file", node: file, expectedStatus: http.StatusOK, expectedBody: content, expectedAcceptRanges: "bytes"},
+		{description: "bounded range", node: file, rangeHeader: "bytes=2-5", expectedStatus: http.StatusPartialContent, expectedBody: "2345", expectedContentRange: "bytes 2-5/10", expectedAcceptRanges: "bytes"},
+		{description: "open range", node: file, rangeHeader: "bytes=7-", expectedStatus: http.StatusPartialContent, expectedBody: "789", expectedContentRange: "bytes 7-9/10", expectedAcceptRanges: "bytes"},
+		{description: "suffix range", node: file, rangeHeader: "bytes=-3", expectedStatus: http.StatusPartialContent, expectedBody: "789", expectedContentRange: "bytes 7-9/10", expectedAcceptRanges: "bytes"},
+		{description: "end beyond the file", node: file, rangeHeader: "bytes=8-100", expectedStatus: http.StatusPartialContent, expectedBody: "89", expectedContentRange: "bytes 8-9/10", expectedAcceptRanges: "bytes"},
+		{description: "unsatisfiable range", node: file, rangeHeader: "bytes=10-", expectedStatus: http.StatusRequestedRangeNotSatisfiable, expectedContentRange: "bytes */10", expectedAcceptRanges: "bytes"},
+		{description: "multiple ranges are ignored", node: file, rangeHeader: "bytes=0-1,4-5", expectedStatus: http.StatusOK, expectedBody: content, expectedAcceptRanges: "bytes"},
+		{description: "other unit is ignored", node: file, rangeHeader: "items=0-1", expectedStatus: http.StatusOK, expectedBody: content, expectedAcceptRanges: "bytes"},
+		{description: "stale If-Range", node: file, rangeHeader: "bytes=2-5", ifRange: "Mon, 02 Jan 2006 15:04:05 GMT", expectedStatus: http.StatusOK, expectedBody: content, expectedAcceptRanges: "bytes"},
+		{description: "range of a directory is ignored", node: dir, rangeHeader: "bytes=2-5", expectedStatus: http.StatusOK, expectedBody: content, expectedAcceptRanges: "none"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/download", nil)
+			if tc.rangeHeader != "" {
+				req.Header.Set("Range", tc.rangeHeader)
+			}
+			if tc.ifRange != "" {
+				req.Header.Set("If-Range", tc.ifRange)
+			}
+			rec := httptest.NewRecorder()
+			responder := &fakeResponder{}
+
+			// write the content in small chunks like a stream of restic dump
+			err := serveDump(rec, req, tc.node, responder, func(out io.Writer) error {
+				for i := 0; i < len(content); i += 3 {
+					if _, err := out.Write([]byte(content[i:min(i+3, len(content))])); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil || responder.err != nil {
+				t.Fatalf("expected no error, found %v and %v", err, responder.err)
+			}
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, found %d", tc.expectedStatus, rec.Code)
+			}
+			if tc.expectedStatus != http.StatusRequestedRangeNotSatisfiable && rec.Body.String() != tc.expectedBody {
+				t.Errorf("expected body %q, found %q", tc.expectedBody, rec.Body.String())
+			}
+			if cr := rec.Header().Get("Content-Range"); cr != tc.expectedContentRange {
+				t.Errorf("expected Content-Range %q, found %q", tc.expectedContentRange, cr)
+			}
+			if ar := rec.Header().Get("Accept-Ranges"); ar != tc.expectedAcceptRanges {
+				t.Errorf("expected Accept-Ranges %q, found %q", tc.expectedAcceptRanges, ar)
+			}
+		})
+	}
+}
+
+func TestServeDumpError(t *testing.T) {
+	file := &restic.SnapshotFile{Name: "data.txt", Type: "file", Size: 10}
+	dumpErr := errors.New("dump failed")
+
+	// an error before any content is written is reported through the responder
+	responder := &fakeResponder{}
+	rec := httptest.NewRecorder()
+	err := serveDump(rec, httptest.NewRequest(http.MethodGet, "/download", nil), file, responder, func(io.Writer) error {
+		return dumpErr
+	})
+	if err != nil || responder.err == nil {
+		t.Errorf("expected the error to be reported through the responder, found %v and %v", err, responder.err)
+	}
+
+	// an error after the response has started is returned
+	responder = &fakeResponder{}
+	rec = httptest.NewRecorder()
+	err = serveDump(rec, httptest.NewRequest(http.MethodGet, "/download", nil), file, responder, func(out io.Writer) error {
+		_, _ = out.Write([]byte("01234"))
+		return dumpErr
+	})
+	if !errors.Is(err, dumpErr) || responder.err != nil {
+		t.Errorf("expected the dump error to be returned, found %v and %v", err, responder.err)
+	}
+}
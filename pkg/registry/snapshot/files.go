@@ -0,0 +1,196 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"stash.appscode.dev/apimachinery/apis/repositories"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/util"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+const (
+	QueryParamPath     = "path"
+	QueryParamLimit    = "limit"
+	QueryParamContinue = "continue"
+)
+
+// FilesREST implements the `files` subresource of a Snapshot.
+// It lists the entries of a directory inside the snapshot using `restic ls`.
+type FilesREST struct {
+	snapshots *REST
+}
+
+var (
+	_ rest.Storage   = &FilesREST{}
+	_ rest.Connecter = &FilesREST{}
+)
+
+func NewFilesREST(snapshots *REST) *FilesREST {
+	return &FilesREST{snapshots: snapshots}
+}
+
+func (r *FilesREST) New() runtime.Object {
+	return &repositories.SnapshotFileList{}
+}
+
+func (r *FilesREST) Destroy() {}
+
+func (r *FilesREST) ConnectMethods() []string {
+	return []string{http.MethodGet}
+}
+
+func (r *FilesREST) NewConnectOptions() (runtime.Object, bool, string) {
+	return nil, false, ""
+}
+
+func (r *FilesREST) Connect(ctx context.Context, name string, _ runtime.Object, responder rest.Responder) (http.Handler, error) {
+	opt, err := r.snapshots.getSnapshotOptions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+
+		limit := 0
+		if v := query.Get(QueryParamLimit); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				responder.Error(apierrors.NewBadRequest(fmt.Sprintf("invalid %s %q", QueryParamLimit, v)))
+				return
+			}
+			limit = n
+		}
+		var after string
+		if v := query.Get(QueryParamContinue); v != "" {
+			token, err := base64.RawURLEncoding.DecodeString(v)
+			if err != nil {
+				responder.Error(apierrors.NewBadRequest(fmt.Sprintf("invalid %s token", QueryParamContinue)))
+				return
+			}
+			after = string(token)
+		}
+
+		files, err := r.listFiles(*opt, query.Get(QueryParamPath), after, limit)
+		if err != nil {
+			responder.Error(apierrors.NewInternalError(err))
+			return
+		}
+		responder.Object(http.StatusOK, files)
+	}), nil
+}
+
+// listFiles returns at most limit entries of the directory that come after the given path.
+// The page is built while restic lists the directory, so only the entries of the page are kept in memory.
+func (r *FilesREST) listFiles(opt Options, dir string, after string, limit int) (*repositories.SnapshotFileList, error) {
+	resticWrapper, tempDir, err := newResticWrapper(opt)
+	if err != nil {
+		return nil, err
+	}
+	defer util.RemoveDirWithLogErr(tempDir)
+
+	page := newFilePage(after, limit)
+	err = resticWrapper.WalkSnapshotDir(opt.SnapshotIDs[0], dir, func(node restic.SnapshotFile) error {
+		page.add(repositories.SnapshotFile{
+			Name:    node.Name,
+			Path:    node.Path,
+			Type:    node.Type,
+			Size:    int64(node.Size),
+			Mode:    node.Mode.String(),
+			ModTime: metav1.NewTime(node.ModTime),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page.list(), nil
+}
+
+// filePage keeps the first limit entries, in path order, that come after the given path.
+// The path of the last entry of the page is used as the continue token of the next page.
+type filePage struct {
+	after string
+	limit int
+	total int
+	// items is a max-heap on the path when limit is set, so the largest path of the page can be replaced
+	items filesByPathDesc
+}
+
+func newFilePage(after string, limit int) *filePage {
+	return &filePage{after: after, limit: limit}
+}
+
+func (p *filePage) add(file repositories.SnapshotFile) {
+	if file.Path <= p.after {
+		return
+	}
+	p.total++
+	switch {
+	case p.limit == 0 || len(p.items) < p.limit:
+		heap.Push(&p.items, file)
+	case file.Path < p.items[0].Path:
+		p.items[0] = file
+		heap.Fix(&p.items, 0)
+	}
+}
+
+func (p *filePage) list() *repositories.SnapshotFileList {
+	files := []repositories.SnapshotFile(p.items)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	list := &repositories.SnapshotFileList{Items: files}
+	if p.limit > 0 && p.total > p.limit {
+		remaining := int64(p.total - p.limit)
+		list.Continue = base64.RawURLEncoding.EncodeToString([]byte(files[len(files)-1].Path))
+		list.RemainingItemCount = &remaining
+	}
+	return list
+}
+
+type filesByPathDesc []repositories.SnapshotFile
+
+func (f filesByPathDesc) Len() int           { return len(f) }
+func (f filesByPathDesc) Less(i, j int) bool { return f[i].Path > f[j].Path }
+func (f filesByPathDesc) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+func (f *filesByPathDesc) Push(x any) {
+	*f = append(*f, x.(repositories.SnapshotFile))
+}
+
+func (f *filesByPathDesc) Pop() any {
+	old := *f
+	n := len(old)
+	x := old[n-1]
+	*f = old[:n-1]
+	return x
+}
@@ -18,13 +18,14 @@ package snapshot
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	"stash.appscode.dev/apimachinery/apis/repositories"
 	repov1alpha1 "stash.appscode.dev/apimachinery/apis/repositories/v1alpha1"
 	stash "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
 	"stash.appscode.dev/apimachinery/client/clientset/versioned"
-	"stash.appscode.dev/stash/pkg/util"
 
 	core "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -98,39 +99,12 @@ func (r *REST) GetSingularName() string {
 }
 
 func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
-	ns, ok := apirequest.NamespaceFrom(ctx)
-	if !ok {
-		return nil, apierrors.NewBadRequest("missing namespace")
-	}
-
-	repoName, snapshotId, err := util.GetRepoNameAndSnapshotID(name)
-	if err != nil {
-		return nil, apierrors.NewBadRequest(err.Error())
-	}
-
-	repo, err := r.stashClient.StashV1alpha1().Repositories(ns).Get(ctx, repoName, metav1.GetOptions{})
+	opt, err := r.getSnapshotOptions(ctx, name)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil, apierrors.NewNotFound(stash.Resource(stash.ResourceSingularRepository), repoName)
-		}
-		return nil, apierrors.NewInternalError(err)
-	}
-
-	secret, err := r.kubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil, apierrors.NewNotFound(core.Resource("secret"), repo.Spec.Backend.StorageSecretName)
-		}
-		return nil, apierrors.NewInternalError(err)
-	}
-	opt := Options{
-		Repository:  repo,
-		Secret:      secret,
-		SnapshotIDs: []string{snapshotId},
-		InCluster:   false,
+		return nil, err
 	}
 
-	snapshots, err := r.GetSnapshotsFromBackned(opt)
+	snapshots, err := r.GetSnapshotsFromBackned(*opt)
 	if err != nil {
 		return nil, apierrors.NewInternalError(err)
 	}
@@ -222,46 +196,31 @@ func (r *REST) ConvertToTable(ctx context.Context, object runtime.Object, tableO
 }
 
 func (r *REST) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
-	ns, ok := apirequest.NamespaceFrom(ctx)
-	if !ok {
-		return nil, false, apierrors.NewBadRequest("missing namespace")
-	}
-	repoName, snapshotId, err := util.GetRepoNameAndSnapshotID(name)
+	opt, err := r.getSnapshotOptions(ctx, name)
 	if err != nil {
-		return nil, false, apierrors.NewBadRequest(err.Error())
-	}
-	repo, err := r.stashClient.StashV1alpha1().Repositories(ns).Get(ctx, repoName, metav1.GetOptions{})
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil, false, apierrors.NewNotFound(stash.Resource(stash.ResourceSingularRepository), repoName)
-		}
-		return nil, false, apierrors.NewInternalError(err)
-	}
-
-	secret, err := r.kubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil, false, apierrors.NewNotFound(core.Resource("secret"), repo.Spec.Backend.StorageSecretName)
-		}
-		return nil, false, apierrors.NewInternalError(err)
-	}
-	opt := Options{
-		Repository:  repo,
-		Secret:      secret,
-		SnapshotIDs: []string{snapshotId},
-		InCluster:   false,
+		return nil, false, err
 	}
+	repo := opt.Repository
 
 	// first, check if the snapshot exist
-	snapshots, err := r.GetSnapshotsFromBackned(opt)
+	snapshots, err := r.GetSnapshotsFromBackned(*opt)
 	if err != nil {
 		return nil, false, apierrors.NewInternalError(err)
 	}
 	if len(snapshots) == 0 {
 		return nil, false, apierrors.NewNotFound(repositories.Resource(repov1alpha1.ResourceSingularSnapshot), name)
 	}
+	// snapshots under the lock of the immutability policy must not be deleted
+	if repo.IsSnapshotLocked(snapshots[0].CreationTimestamp.Time, time.Now()) {
+		return nil, false, apierrors.NewForbidden(
+			repositories.Resource(repov1alpha1.ResourceSingularSnapshot),
+			name,
+			fmt.Errorf("snapshot is locked by the immutability policy of Repository %s/%s until %s",
+				repo.Namespace, repo.Name, snapshots[0].Status.LockedUntil.UTC().Format(time.RFC3339)),
+		)
+	}
 	// delete snapshot
-	if err = r.ForgetSnapshotsFromBackend(opt); err != nil {
+	if err = r.ForgetSnapshotsFromBackend(*opt); err != nil {
 		return nil, false, apierrors.NewInternalError(err)
 	}
 	return nil, true, nil
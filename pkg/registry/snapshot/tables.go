@@ -48,6 +48,10 @@ func (c customTableConvertor) ConvertToTable(ctx context.Context, object runtime
 			return errNotAcceptable{resource: c.qualifiedResource}
 		}
 		snapshotID := []rune(snapshot.UID)
+		lockedUntil := ""
+		if snapshot.Status.LockedUntil != nil {
+			lockedUntil = snapshot.Status.LockedUntil.UTC().Format(time.RFC3339)
+		}
 		table.Rows = append(table.Rows, metav1.TableRow{
 			Cells: []any{
 				snapshot.GetName(),
@@ -55,6 +59,7 @@ func (c customTableConvertor) ConvertToTable(ctx context.Context, object runtime
 				snapshot.Status.Repository,
 				snapshot.Status.Hostname,
 				snapshot.GetCreationTimestamp().Time.UTC().Format(time.RFC3339),
+				lockedUntil,
 			},
 			Object: runtime.RawExtension{Object: obj},
 		})
@@ -86,6 +91,7 @@ func (c customTableConvertor) ConvertToTable(ctx context.Context, object runtime
 			{Name: "Repository", Type: "string", Format: "repository", Description: "Name of the repository where the Snapshot was backed up"},
 			{Name: "Hostname", Type: "string", Format: "hostname", Description: "Name of the host whose data was backed up"},
 			{Name: "Created At", Type: "date", Description: "Timestamp when the snapshot was created"},
+			{Name: "Locked Until", Type: "date", Description: "Timestamp until which the snapshot is protected from deletion"},
 		}
 	}
 	return &table, nil
@@ -18,6 +18,7 @@ package snapshot
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -29,7 +30,10 @@ import (
 	"stash.appscode.dev/stash/pkg/util"
 
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/klog/v2"
 	meta_util "kmodules.xyz/client-go/meta"
 )
@@ -116,6 +120,7 @@ func (r *REST) getSnapshotsFromBackend(opt Options) ([]repositories.Snapshot, er
 		snapshot.Status.Username = result.Username
 		snapshot.Status.Tags = result.Tags
 		snapshot.Status.Repository = opt.Repository.Name
+		snapshot.Status.LockedUntil = opt.Repository.SnapshotLockedUntil(result.Time)
 
 		snapshots = append(snapshots, *snapshot)
 	}
@@ -159,6 +164,73 @@ func (r *REST) forgetSnapshotsFromBackend(opt Options) error {
 	return err
 }
 
+// getSnapshotOptions finds the Repository and the storage Secret of the snapshot with the given name.
+// It returns API errors so that the subresources can return them to the client directly.
+func (r *REST) getSnapshotOptions(ctx context.Context, name string) (*Options, error) {
+	ns, ok := apirequest.NamespaceFrom(ctx)
+	if !ok {
+		return nil, apierrors.NewBadRequest("missing namespace")
+	}
+
+	repoName, snapshotId, err := util.GetRepoNameAndSnapshotID(name)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	repo, err := r.stashClient.StashV1alpha1().Repositories(ns).Get(ctx, repoName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, apierrors.NewNotFound(stash.Resource(stash.ResourceSingularRepository), repoName)
+		}
+		return nil, apierrors.NewInternalError(err)
+	}
+	if repo.Spec.Backend.Local != nil {
+		return nil, apierrors.NewBadRequest("local backend isn't supported in Stash community edition")
+	}
+
+	secret, err := r.kubeClient.CoreV1().Secrets(repo.Namespace).Get(ctx, repo.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, apierrors.NewNotFound(core.Resource("secret"), repo.Spec.Backend.StorageSecretName)
+		}
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	return &Options{
+		Repository:  repo,
+		Secret:      secret,
+		SnapshotIDs: []string{snapshotId},
+		InCluster:   false,
+	}, nil
+}
+
+// newResticWrapper configures a restic wrapper for the repository of the given options.
+// The caller is responsible for removing the returned scratch directory.
+func newResticWrapper(opt Options) (*restic.ResticWrapper, string, error) {
+	tempDir, err := os.MkdirTemp("", "stash")
+	if err != nil {
+		return nil, "", err
+	}
+
+	extraOpt := util.ExtraOptions{
+		StorageSecret: opt.Secret,
+		EnableCache:   false,
+		ScratchDir:    tempDir,
+	}
+	setupOpt, err := util.SetupOptionsForRepository(*opt.Repository, extraOpt)
+	if err != nil {
+		util.RemoveDirWithLogErr(tempDir)
+		return nil, "", fmt.Errorf("setup option for repository failed, reason: %s", err)
+	}
+
+	resticWrapper, err := restic.NewResticWrapper(setupOpt)
+	if err != nil {
+		util.RemoveDirWithLogErr(tempDir)
+		return nil, "", err
+	}
+	return resticWrapper, tempDir, nil
+}
+
 func repoNotFound(repo string, err error) bool {
 	repoNotFoundMessage := fmt.Sprintf("exit status 1, reason: %s", repo)
 
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"stash.appscode.dev/apimachinery/apis"
 	"stash.appscode.dev/apimachinery/apis/stash/v1beta1"
@@ -85,6 +86,14 @@ func (r *TaskOptions) setBackupInvokerVariables() error {
 
 	vars[apis.EnableCache] = strconv.FormatBool(!r.Backup.TargetInfo.TempDir.DisableCaching)
 
+	compression, packSize := util.CompressionForBackupTarget(r.Backup.TargetInfo.Target, r.Repository)
+	if compression != "" {
+		vars[apis.Compression] = string(compression)
+	}
+	if packSize != nil {
+		vars[apis.PackSize] = strconv.FormatInt(int64(*packSize), 10)
+	}
+
 	r.setInterimVolumeVariables(r.Backup.TargetInfo.InterimVolumeTemplate)
 
 	r.Variables = meta_util.OverwriteKeys(r.Variables, vars)
@@ -103,6 +112,15 @@ func (r *TaskOptions) setRestoreInvokerVariables() {
 	vars[apis.SourceHostname] = restoreOptions.SourceHost
 	vars[apis.RestorePaths] = strings.Join(restoreOptions.RestorePaths, ",")
 	vars[apis.RestoreSnapshots] = strings.Join(restoreOptions.Snapshots, ",")
+	vars[apis.RestorePointInTime] = ""
+	if restoreOptions.PointInTime != nil {
+		vars[apis.RestorePointInTime] = restoreOptions.PointInTime.Format(time.RFC3339)
+	}
+	pathMappings := make([]string, 0, len(restoreOptions.PathMappings))
+	for _, mapping := range restoreOptions.PathMappings {
+		pathMappings = append(pathMappings, mapping.SourcePath+":"+mapping.TargetPath)
+	}
+	vars[apis.RestorePathMappings] = strings.Join(pathMappings, ",")
 	vars[apis.IncludePatterns] = strings.Join(restoreOptions.Include, ",")
 	vars[apis.ExcludePatterns] = strings.Join(restoreOptions.Exclude, ",")
 
@@ -182,6 +200,8 @@ func (r *TaskOptions) setRepositoryVariables() error {
 		vars[apis.RepositoryRegion] = region
 	}
 	vars[apis.MaxConnections] = strconv.FormatInt(r.Repository.Spec.Backend.MaxConnections(), 10)
+	vars[apis.UploadLimit] = strconv.FormatInt(int64(r.Repository.Spec.UploadLimit), 10)
+	vars[apis.DownloadLimit] = strconv.FormatInt(int64(r.Repository.Spec.DownloadLimit), 10)
 
 	r.Variables = meta_util.OverwriteKeys(r.Variables, vars)
 	return nil
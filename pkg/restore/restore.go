@@ -228,13 +228,29 @@ func (opt *Options) runRestore(inv invoker.RestoreInvoker, targetInfo invoker.Re
 		return nil, nil
 	}
 
+	// share the per-node bandwidth with the other backup and restore processes running on this node
+	setupOpt := opt.SetupOpt
+	release, err := util.ReserveNodeBandwidth(&setupOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// setup restic wrapper
-	w, err := restic.NewResticWrapper(opt.SetupOpt)
+	w, err := restic.NewResticWrapper(setupOpt)
+	if err != nil {
+		return nil, err
+	}
+	restoreOptions, err := util.RestoreOptionsForTarget(opt.Host, targetInfo.Target)
 	if err != nil {
 		return nil, err
 	}
-	restoreOptions := util.RestoreOptionsForHost(opt.Host, targetInfo.Target.Rules)
 	restoreOptions.Args = targetInfo.Target.Args
+	statusOpt := status.UpdateStatusOptions{
+		StashClient: opt.StashClient,
+		TargetRef:   targetInfo.Target.Ref,
+	}
+	restoreOptions.OnProgress = statusOpt.RestoreProgressReporter(inv, opt.Host)
 	return w.RunRestore(restoreOptions, targetInfo.Target.Ref)
 }
 
@@ -0,0 +1,264 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	stash_cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	v1beta1_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1beta1/util"
+	stash_listers_v1beta1 "stash.appscode.dev/apimachinery/client/listers/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/invoker"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/meta"
+)
+
+const (
+	// InProcessSchedulerLockName is the name of the Lease used to elect the operator replica that triggers the backups
+	InProcessSchedulerLockName = "stash-backup-scheduler"
+	// inProcessSchedulerInterval is the interval at which the schedules are evaluated
+	inProcessSchedulerInterval = 10 * time.Second
+	// missedScheduleDeadline is the maximum delay after which a missed schedule is no longer triggered, like the
+	// startingDeadlineSeconds of a CronJob. It keeps an operator restart from replaying the schedules missed long ago.
+	missedScheduleDeadline = time.Hour
+)
+
+// InProcessScheduler triggers the BackupConfigurations from inside the operator instead of creating a CronJob for each
+// of them. Only the replica that holds the leader lease triggers the backups. The time of the last triggered schedule
+// is stored in the BackupConfiguration status so that the most recent schedule missed during a restart is caught up,
+// as long as it has not been missed by more than missedScheduleDeadline.
+type InProcessScheduler struct {
+	KubeClient  kubernetes.Interface
+	StashClient stash_cs.Interface
+	Lister      stash_listers_v1beta1.BackupConfigurationLister
+
+	mu sync.Mutex
+	// lastTriggered guards against triggering the same schedule twice while the lister has not observed the status update yet.
+	// It also remembers the newest BackupSession of a BackupConfiguration that has never been triggered by this scheduler.
+	lastTriggered map[types.UID]time.Time
+}
+
+// Run participates in the leader election and triggers the due backups while it is the leader.
+// It blocks until the stop channel is closed.
+func (s *InProcessScheduler) Run(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		meta.PodNamespace(),
+		InProcessSchedulerLockName,
+		s.KubeClient.CoreV1(),
+		s.KubeClient.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: meta.PodName()},
+	)
+	if err != nil {
+		klog.Errorf("failed to start in-process backup scheduler. Reason: %v", err)
+		return
+	}
+
+	// RunOrDie returns when the leadership is lost. Keep participating in the election until the operator stops.
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					klog.Infoln("Got leadership, starting in-process backup scheduler")
+					wait.UntilWithContext(ctx, s.triggerDueBackups, inProcessSchedulerInterval)
+				},
+				OnStoppedLeading: func() {
+					klog.Infoln("Lost leadership, stopping in-process backup scheduler")
+				},
+			},
+		})
+	}
+}
+
+func (s *InProcessScheduler) triggerDueBackups(ctx context.Context) {
+	backupConfigs, err := s.Lister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BackupConfigurations. Reason: %v", err)
+		return
+	}
+	for _, bc := range backupConfigs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.triggerIfDue(bc, time.Now()); err != nil {
+			klog.Errorf("failed to trigger backup for BackupConfiguration %s/%s. Reason: %v", bc.Namespace, bc.Name, err)
+		}
+	}
+}
+
+func (s *InProcessScheduler) triggerIfDue(bc *api_v1beta1.BackupConfiguration, now time.Time) error {
+	if bc.DeletionTimestamp != nil || bc.Spec.Paused || bc.Spec.Schedule == "" || bc.Status.Phase != api_v1beta1.BackupInvokerReady {
+		return nil
+	}
+
+	schedule, err := ParseScheduleInTimeZone(bc.Spec.Schedule, bc.Spec.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	since, err := s.lastScheduleTime(bc)
+	if err != nil {
+		return err
+	}
+
+	scheduled, missed := mostRecentScheduleTime(schedule, since, now)
+	if scheduled.IsZero() {
+		return nil
+	}
+	if missed > 1 {
+		klog.Infof("BackupConfiguration %s/%s missed %d schedules within the last %s. Triggering backup for the most recent one scheduled at %s",
+			bc.Namespace, bc.Name, missed, missedScheduleDeadline, scheduled.Format(time.RFC3339))
+	}
+
+	inv := invoker.NewBackupConfigurationInvoker(s.StashClient, bc)
+	retryLeft := int32(0)
+	if retryConfig := inv.GetRetryConfig(); retryConfig != nil {
+		retryLeft = retryConfig.MaxRetry
+	}
+	instant := &InstantScheduler{
+		StashClient: s.StashClient,
+		Invoker:     inv,
+		RetryLeft:   retryLeft,
+	}
+	if err := instant.Ensure(); err != nil {
+		return err
+	}
+	s.setLastTriggered(bc.UID, scheduled)
+	klog.Infof("Triggered backup for BackupConfiguration %s/%s scheduled at %s", bc.Namespace, bc.Name, scheduled.Format(time.RFC3339))
+
+	_, err = v1beta1_util.UpdateBackupConfigurationStatus(
+		context.TODO(),
+		s.StashClient.StashV1beta1(),
+		bc.ObjectMeta,
+		func(in *api_v1beta1.BackupConfigurationStatus) (types.UID, *api_v1beta1.BackupConfigurationStatus) {
+			in.LastScheduleTime = &metav1.Time{Time: scheduled}
+			return bc.UID, in
+		},
+		metav1.UpdateOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record the last schedule time. Reason: %v", err)
+	}
+	return nil
+}
+
+// lastScheduleTime returns the time after which the due schedules of the BackupConfiguration are looked for.
+// Until the in-process scheduler has triggered the BackupConfiguration once, i.e. after switching from the CronJob
+// mode, it is the creation time of the newest BackupSession. So, a schedule that has already run is not run again.
+func (s *InProcessScheduler) lastScheduleTime(bc *api_v1beta1.BackupConfiguration) (time.Time, error) {
+	since := bc.CreationTimestamp.Time
+	if bc.Status.LastScheduleTime != nil {
+		since = bc.Status.LastScheduleTime.Time
+	}
+	if t, ok := s.getLastTriggered(bc.UID); ok {
+		if t.After(since) {
+			since = t
+		}
+		return since, nil
+	}
+	if bc.Status.LastScheduleTime == nil {
+		newest, err := s.newestBackupSessionTime(bc)
+		if err != nil {
+			return since, err
+		}
+		if newest.After(since) {
+			since = newest
+		}
+		// remember it, so that the BackupSessions are not listed again until the next schedule is triggered
+		s.setLastTriggered(bc.UID, since)
+	}
+	return since, nil
+}
+
+// newestBackupSessionTime returns the creation time of the newest BackupSession of the BackupConfiguration.
+// It returns the zero time if the BackupConfiguration does not have any BackupSession.
+func (s *InProcessScheduler) newestBackupSessionTime(bc *api_v1beta1.BackupConfiguration) (time.Time, error) {
+	sessions, err := s.StashClient.StashV1beta1().BackupSessions(bc.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			apis.LabelInvokerType: api_v1beta1.ResourceKindBackupConfiguration,
+			apis.LabelInvokerName: bc.Name,
+		}).String(),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var newest time.Time
+	for _, session := range sessions.Items {
+		if session.CreationTimestamp.After(newest) {
+			newest = session.CreationTimestamp.Time
+		}
+	}
+	return newest, nil
+}
+
+// mostRecentScheduleTime returns the latest activation time of the schedule that is after since and not after now,
+// along with the number of activation times within this period. It returns the zero time if the schedule is not due.
+// Only the activations within missedScheduleDeadline of now are considered. So, the schedules missed long ago are
+// skipped without walking through each of them.
+func mostRecentScheduleTime(schedule *Schedule, since, now time.Time) (time.Time, int) {
+	if deadline := now.Add(-missedScheduleDeadline); since.Before(deadline) {
+		since = deadline
+	}
+	var latest time.Time
+	missed := 0
+	for t := schedule.Next(since); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		latest = t
+		missed++
+	}
+	return latest, missed
+}
+
+func (s *InProcessScheduler) getLastTriggered(uid types.UID) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.lastTriggered[uid]
+	return t, ok
+}
+
+func (s *InProcessScheduler) setLastTriggered(uid types.UID, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastTriggered == nil {
+		s.lastTriggered = map[types.UID]time.Time{}
+	}
+	s.lastTriggered[uid] = t
+}
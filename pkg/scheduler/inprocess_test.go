@@ -0,0 +1,130 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/client/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMostRecentScheduleTime(t *testing.T) {
+	now := parseTime("2021-03-04T05:06:07Z")
+
+	testCases := []struct {
+		description    string
+		schedule       string
+		since          string
+		expected       string
+		expectedMissed int
+	}{
+		{description: "not due", schedule: "0 6 * * *", since: "2021-03-04T00:00:00Z", expected: "", expectedMissed: 0},
+		{description: "single due schedule", schedule: "0 5 * * *", since: "2021-03-04T00:00:00Z", expected: "2021-03-04T05:00:00Z", expectedMissed: 1},
+		{description: "caught up to now", schedule: "0 5 * * *", since: "2021-03-04T05:06:07Z", expected: "", expectedMissed: 0},
+		{description: "multiple missed schedules", schedule: "*/20 * * * *", since: "2021-03-04T04:30:00Z", expected: "2021-03-04T05:00:00Z", expectedMissed: 2},
+		{description: "missed schedules are bounded by the deadline", schedule: "* * * * *", since: "2021-02-01T00:00:00Z", expected: "2021-03-04T05:06:00Z", expectedMissed: 60},
+		{description: "schedule missed beyond the deadline is skipped", schedule: "0 1 * * *", since: "2021-03-01T00:00:00Z", expected: "", expectedMissed: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := ParseSchedule(tc.schedule)
+			if err != nil {
+				t.Fatalf("failed to parse schedule %q: %v", tc.schedule, err)
+			}
+			scheduled, missed := mostRecentScheduleTime(s, parseTime(tc.since), now)
+			var expected time.Time
+			if tc.expected != "" {
+				expected = parseTime(tc.expected)
+			}
+			if !scheduled.Equal(expected) || missed != tc.expectedMissed {
+				t.Errorf("expected %s with %d missed schedules, found %s with %d", expected, tc.expectedMissed, scheduled, missed)
+			}
+		})
+	}
+}
+
+func TestLastScheduleTime(t *testing.T) {
+	created := parseTime("2021-01-01T00:00:00Z")
+	lastSession := parseTime("2021-03-04T01:00:00Z")
+	lastSchedule := parseTime("2021-03-04T02:00:00Z")
+
+	newBackupConfig := func(name string, lastScheduleTime *time.Time) *api_v1beta1.BackupConfiguration {
+		bc := &api_v1beta1.BackupConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "demo",
+				UID:               types.UID("uid-" + name),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+		}
+		if lastScheduleTime != nil {
+			bc.Status.LastScheduleTime = &metav1.Time{Time: *lastScheduleTime}
+		}
+		return bc
+	}
+	newSession := func(name, invoker string, creation time.Time) runtime.Object {
+		return &api_v1beta1.BackupSession{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "demo",
+				CreationTimestamp: metav1.NewTime(creation),
+				Labels: map[string]string{
+					apis.LabelInvokerType: api_v1beta1.ResourceKindBackupConfiguration,
+					apis.LabelInvokerName: invoker,
+				},
+			},
+		}
+	}
+
+	s := &InProcessScheduler{
+		StashClient: fake.NewSimpleClientset(
+			newSession("switched-1", "switched", lastSession.Add(-24*time.Hour)),
+			newSession("switched-2", "switched", lastSession),
+			newSession("other-1", "other", lastSchedule.Add(time.Hour)),
+		),
+	}
+
+	testCases := []struct {
+		description string
+		bc          *api_v1beta1.BackupConfiguration
+		expected    time.Time
+	}{
+		{description: "switched from the CronJob mode", bc: newBackupConfig("switched", nil), expected: lastSession},
+		{description: "without any BackupSession", bc: newBackupConfig("new", nil), expected: created},
+		{description: "already triggered", bc: newBackupConfig("triggered", &lastSchedule), expected: lastSchedule},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			since, err := s.lastScheduleTime(tc.bc)
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if !since.Equal(tc.expected) {
+				t.Errorf("expected %s, found %s", tc.expected, since)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"time"
+
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	ui_api "stash.appscode.dev/apimachinery/apis/ui/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpcomingBackupTime returns the next time after now when the BackupConfiguration will be triggered.
+// The schedule is evaluated in the TimeZone of the BackupConfiguration.
+// It returns nil if the BackupConfiguration is paused or does not have any schedule.
+func UpcomingBackupTime(bc *api_v1beta1.BackupConfiguration, now time.Time) (*metav1.Time, error) {
+	if bc.Spec.Paused || bc.Spec.Schedule == "" {
+		return nil, nil
+	}
+	schedule, err := ParseScheduleInTimeZone(bc.Spec.Schedule, bc.Spec.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &metav1.Time{Time: next}, nil
+}
+
+// BackupOverviewSpecFor returns the schedule related part of the BackupOverview of a BackupConfiguration.
+// The UpcomingBackupTime is computed in the TimeZone of the BackupConfiguration.
+func BackupOverviewSpecFor(bc *api_v1beta1.BackupConfiguration, now time.Time) (ui_api.BackupOverviewSpec, error) {
+	spec := ui_api.BackupOverviewSpec{
+		Schedule:   bc.Spec.Schedule,
+		TimeZone:   bc.Spec.TimeZone,
+		Status:     ui_api.BackupStatusActive,
+		Repository: bc.Spec.Repository.Name,
+	}
+	if bc.Spec.Paused {
+		spec.Status = ui_api.BackupStatusPaused
+	}
+	upcoming, err := UpcomingBackupTime(bc, now)
+	if err != nil {
+		return spec, err
+	}
+	spec.UpcomingBackupTime = upcoming
+	return spec, nil
+}
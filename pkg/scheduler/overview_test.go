@@ -0,0 +1,108 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	ui_api "stash.appscode.dev/apimachinery/apis/ui/v1alpha1"
+)
+
+func TestUpcomingBackupTime(t *testing.T) {
+	now := parseTime("2021-03-04T05:06:07Z")
+
+	testCases := []struct {
+		description string
+		spec        api_v1beta1.BackupConfigurationSpec
+		expected    string
+		expectErr   bool
+	}{
+		{description: "utc", spec: api_v1beta1.BackupConfigurationSpec{Schedule: "0 6 * * *", TimeZone: "UTC"}, expected: "2021-03-04T06:00:00Z"},
+		{description: "time zone ahead of utc", spec: api_v1beta1.BackupConfigurationSpec{Schedule: "0 6 * * *", TimeZone: "Asia/Dhaka"}, expected: "2021-03-05T00:00:00Z"},
+		{description: "time zone behind utc", spec: api_v1beta1.BackupConfigurationSpec{Schedule: "0 6 * * *", TimeZone: "America/New_York"}, expected: "2021-03-04T11:00:00Z"},
+		{description: "paused", spec: api_v1beta1.BackupConfigurationSpec{Schedule: "0 6 * * *", TimeZone: "UTC", Paused: true}},
+		{description: "no schedule", spec: api_v1beta1.BackupConfigurationSpec{TimeZone: "UTC"}},
+		{description: "unknown time zone", spec: api_v1beta1.BackupConfigurationSpec{Schedule: "0 6 * * *", TimeZone: "Invalid/Zone"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			bc := &api_v1beta1.BackupConfiguration{Spec: tc.spec}
+			upcoming, err := UpcomingBackupTime(bc, now)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, found none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expected == "" {
+				if upcoming != nil {
+					t.Errorf("expected no upcoming backup time, found %s", upcoming.Time)
+				}
+				return
+			}
+			if upcoming == nil {
+				t.Fatalf("expected upcoming backup time %s, found none", tc.expected)
+			}
+			if expected := parseTime(tc.expected); !upcoming.Time.Equal(expected) {
+				t.Errorf("expected upcoming backup time %s, found %s", expected, upcoming.Time)
+			}
+		})
+	}
+}
+
+func TestBackupOverviewSpecFor(t *testing.T) {
+	now := parseTime("2021-03-04T05:06:07Z")
+	bc := &api_v1beta1.BackupConfiguration{
+		Spec: api_v1beta1.BackupConfigurationSpec{
+			Schedule: "30 23 * * *",
+			TimeZone: "Europe/Berlin",
+		},
+	}
+	bc.Spec.Repository.Name = "gcs-repo"
+
+	spec, err := BackupOverviewSpecFor(bc, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.Schedule != bc.Spec.Schedule || spec.TimeZone != bc.Spec.TimeZone {
+		t.Errorf("expected schedule %q in time zone %q, found %q in %q", bc.Spec.Schedule, bc.Spec.TimeZone, spec.Schedule, spec.TimeZone)
+	}
+	if spec.Status != ui_api.BackupStatusActive {
+		t.Errorf("expected status %s, found %s", ui_api.BackupStatusActive, spec.Status)
+	}
+	if spec.Repository != "gcs-repo" {
+		t.Errorf("expected repository gcs-repo, found %s", spec.Repository)
+	}
+	expected := parseTime("2021-03-04T22:30:00Z")
+	if spec.UpcomingBackupTime == nil || !spec.UpcomingBackupTime.Time.Equal(expected) {
+		t.Errorf("expected upcoming backup time %s, found %v", expected, spec.UpcomingBackupTime)
+	}
+
+	bc.Spec.Paused = true
+	spec, err = BackupOverviewSpecFor(bc, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.Status != ui_api.BackupStatusPaused || spec.UpcomingBackupTime != nil {
+		t.Errorf("expected paused status without upcoming backup time, found %s and %v", spec.Status, spec.UpcomingBackupTime)
+	}
+}
@@ -78,6 +78,10 @@ func (s *PeriodicScheduler) Ensure() error {
 			core_util.EnsureOwnerReference(&in.ObjectMeta, ownerRef)
 
 			in.Spec.Schedule = s.Invoker.GetSchedule()
+			in.Spec.TimeZone = nil
+			if tz := s.Invoker.GetTimeZone(); tz != "" {
+				in.Spec.TimeZone = pointer.StringP(tz)
+			}
 			in.Spec.Suspend = pointer.BoolP(s.Invoker.IsPaused()) // this ensure that the CronJob is suspended when the backup invoker is paused.
 			in.Spec.JobTemplate.Labels = meta_util.OverwriteKeys(in.Spec.JobTemplate.Labels, s.Invoker.GetLabels())
 			// ensure that job gets deleted on completion
@@ -171,6 +175,27 @@ func (s *PeriodicScheduler) Cleanup() error {
 	return s.cleanupRBAC()
 }
 
+// Remove deletes the backup triggering CronJob and its RBAC resources.
+// It is used when the backups are triggered by the in-process scheduler of the operator.
+func (s *PeriodicScheduler) Remove() error {
+	invMeta := s.Invoker.GetObjectMeta()
+	err := batchutil.DeleteCronJob(
+		context.TODO(),
+		s.KubeClient,
+		types.NamespacedName{
+			Name:      s.generateName(),
+			Namespace: invMeta.Namespace,
+		},
+	)
+	if err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	if err := s.KubeClient.RbacV1().RoleBindings(invMeta.Namespace).Delete(context.TODO(), s.generateName(), metav1.DeleteOptions{}); err != nil && !kerr.IsNotFound(err) {
+		return err
+	}
+	return s.cleanupRBAC()
+}
+
 func (s *PeriodicScheduler) cleanupRBAC() error {
 	return s.RBACOptions.EnsureRBACResourcesDeleted()
 }
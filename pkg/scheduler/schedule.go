@@ -0,0 +1,256 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. It supports the same syntax as the Kubernetes CronJob,
+// i.e. the standard 5 fields format, the "@hourly", "@daily" etc. macros, "@every <duration>"
+// and the "CRON_TZ=<zone>" or "TZ=<zone>" prefix.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar indicate whether the day-of-month and the day-of-week fields were "*"
+	domStar, dowStar bool
+	// every is set for the "@every <duration>" schedules
+	every    time.Duration
+	location *time.Location
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = bounds{min: 0, max: 59}
+	hourBounds   = bounds{min: 0, max: 23}
+	domBounds    = bounds{min: 1, max: 31}
+	monthBounds  = bounds{min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted as Sunday as well
+	dowBounds = bounds{min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a cron expression.
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	location := time.Local
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.Index(spec, " ")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid schedule %q: missing cron expression after the time zone", spec)
+		}
+		zone := spec[strings.Index(spec, "=")+1 : i]
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: unknown time zone %q", spec, zone)
+		}
+		location = loc
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be at least 1s", spec)
+		}
+		return &Schedule{every: d, location: location}, nil
+	}
+	if expr, ok := macros[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, found %d", spec, len(fields))
+	}
+
+	s := &Schedule{location: location}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, fmt.Errorf("invalid minute field of schedule %q: %v", spec, err)
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, fmt.Errorf("invalid hour field of schedule %q: %v", spec, err)
+	}
+	if s.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field of schedule %q: %v", spec, err)
+	}
+	if s.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, fmt.Errorf("invalid month field of schedule %q: %v", spec, err)
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field of schedule %q: %v", spec, err)
+	}
+	// treat 7 as Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+	return s, nil
+}
+
+// ParseScheduleInTimeZone parses a cron expression that is evaluated in the given time zone.
+// The local time zone is used if the time zone is empty. Specifying both the time zone and a
+// "CRON_TZ=" or "TZ=" prefix in the expression is not allowed.
+func ParseScheduleInTimeZone(spec, timeZone string) (*Schedule, error) {
+	if timeZone == "" {
+		return ParseSchedule(spec)
+	}
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		return nil, fmt.Errorf("invalid schedule %q: time zone must not be specified in the schedule when timeZone is set", spec)
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", timeZone)
+	}
+	return ParseSchedule(fmt.Sprintf("CRON_TZ=%s %s", timeZone, spec))
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bitset.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeExpr, step := item, uint(1)
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.ParseUint(item[i+1:], 10, 0)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("invalid step %q", item[i+1:])
+			}
+			rangeExpr, step = item[:i], uint(n)
+		}
+
+		var start, end uint
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			start, end = b.min, b.max
+		case strings.Contains(rangeExpr, "-"):
+			parts := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if start, err = parseValue(parts[0], b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(parts[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseValue(rangeExpr, b)
+			if err != nil {
+				return 0, err
+			}
+			start, end = v, v
+			// "5/10" means starting from 5 to the max value with a step of 10
+			if strings.Contains(item, "/") {
+				end = b.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range %q", rangeExpr)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("value %d is out of range [%d, %d]", n, b.min, b.max)
+	}
+	return uint(n), nil
+}
+
+// Next returns the first activation time of the schedule that is strictly after the given time.
+// It returns the zero time if no activation time was found within the next 5 years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(time.Second).Add(s.every)
+	}
+
+	origLocation := t.Location()
+	t = t.In(s.location)
+	// start from the next whole minute
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t.In(origLocation)
+	}
+	return time.Time{}
+}
+
+// dayMatches follows the cron semantics: if both day-of-month and day-of-week are restricted,
+// the day matches when either of them matches.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,91 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	testCases := []struct {
+		description string
+		schedule    string
+		from        string
+		expected    string
+	}{
+		{description: "every minute", schedule: "* * * * *", from: "2021-03-04T05:06:07", expected: "2021-03-04T05:07:00"},
+		{description: "step in minutes", schedule: "*/15 * * * *", from: "2021-03-04T05:16:00", expected: "2021-03-04T05:30:00"},
+		{description: "daily macro", schedule: "@daily", from: "2021-03-04T05:06:07", expected: "2021-03-05T00:00:00"},
+		{description: "range and list", schedule: "30 1-3,22 * * *", from: "2021-03-04T03:30:00", expected: "2021-03-04T22:30:00"},
+		{description: "month rollover", schedule: "0 0 1 * *", from: "2021-12-15T00:00:00", expected: "2022-01-01T00:00:00"},
+		{description: "day of week by name", schedule: "0 12 * * mon", from: "2021-03-04T05:06:07", expected: "2021-03-08T12:00:00"},
+		{description: "sunday as 7", schedule: "0 0 * * 7", from: "2021-03-04T05:06:07", expected: "2021-03-07T00:00:00"},
+		{description: "day of month or day of week", schedule: "0 0 10 * fri", from: "2021-03-04T05:06:07", expected: "2021-03-05T00:00:00"},
+		{description: "leap day", schedule: "0 0 29 2 *", from: "2021-03-01T00:00:00", expected: "2024-02-29T00:00:00"},
+		{description: "time zone", schedule: "CRON_TZ=Asia/Dhaka 0 6 * * *", from: "2021-03-04T05:06:07Z", expected: "2021-03-05T00:00:00Z"},
+		{description: "every interval", schedule: "@every 90m", from: "2021-03-04T05:06:07Z", expected: "2021-03-04T06:36:07Z"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := ParseSchedule(tc.schedule)
+			if err != nil {
+				t.Fatalf("failed to parse schedule %q: %v", tc.schedule, err)
+			}
+			from, expected := parseTime(tc.from), parseTime(tc.expected)
+			if next := s.Next(from); !next.Equal(expected) {
+				t.Errorf("expected next activation at %s, found %s", expected, next)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "TZ=Invalid/Zone * * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected error for schedule %q", spec)
+		}
+	}
+}
+
+func TestParseScheduleInTimeZone(t *testing.T) {
+	s, err := ParseScheduleInTimeZone("0 6 * * *", "Asia/Dhaka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := parseTime("2021-03-05T00:00:00Z")
+	if next := s.Next(parseTime("2021-03-04T05:06:07Z")); !next.Equal(expected) {
+		t.Errorf("expected next activation at %s, found %s", expected, next)
+	}
+
+	if _, err := ParseScheduleInTimeZone("CRON_TZ=UTC 0 6 * * *", "Asia/Dhaka"); err == nil {
+		t.Errorf("expected error for time zone specified in both schedule and timeZone")
+	}
+	if _, err := ParseScheduleInTimeZone("0 6 * * *", "Invalid/Zone"); err == nil {
+		t.Errorf("expected error for unknown time zone")
+	}
+}
+
+// parseTime parses the time in the local time zone unless the zone is specified explicitly
+func parseTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	t, _ := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local)
+	return t
+}
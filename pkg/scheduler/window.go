@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+)
+
+// WindowDecision reports whether a backup is allowed to run at a certain time according to the backup windows.
+type WindowDecision struct {
+	// Open is true if the backup is allowed to run
+	Open bool
+	// Reason is the BackupWindowOpen condition reason explaining the decision
+	Reason  string
+	Message string
+	// OpensAt is the earliest time when the backup might be allowed to run.
+	// It is zero if the window is already open or no upcoming window was found.
+	OpensAt time.Time
+}
+
+// ParseBackupWindow parses the Start schedule of a BackupWindow in the time zone of the window.
+// The defaultTimeZone is used if the window does not specify any time zone.
+func ParseBackupWindow(w api_v1beta1.BackupWindow, defaultTimeZone string) (*Schedule, error) {
+	if w.Duration.Duration <= 0 {
+		return nil, fmt.Errorf("invalid backup window %q: duration must be positive", w.Start)
+	}
+	timeZone := w.TimeZone
+	if timeZone == "" {
+		timeZone = defaultTimeZone
+	}
+	schedule, err := ParseScheduleInTimeZone(w.Start, timeZone)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.every > 0 {
+		return nil, fmt.Errorf("invalid backup window %q: @every schedules are not supported", w.Start)
+	}
+	return schedule, nil
+}
+
+// CheckBackupWindows decides whether a backup is allowed to run at the given time.
+// A backup is allowed if the time is not inside any of the blackout windows and, when allowed windows
+// are specified, inside at least one of them. The windows without a time zone are evaluated in the given timeZone.
+func CheckBackupWindows(allowed, blackout []api_v1beta1.BackupWindow, timeZone string, now time.Time) (*WindowDecision, error) {
+	for _, w := range blackout {
+		schedule, err := ParseBackupWindow(w, timeZone)
+		if err != nil {
+			return nil, err
+		}
+		if end, ok := windowEnd(schedule, w.Duration.Duration, now); ok {
+			return &WindowDecision{
+				Reason:  api_v1beta1.InsideBlackoutWindow,
+				Message: fmt.Sprintf("Current time is inside the blackout window %q which closes at %s.", w.Start, end.Format(time.RFC3339)),
+				OpensAt: end,
+			}, nil
+		}
+	}
+
+	if len(allowed) == 0 {
+		return &WindowDecision{Open: true, Reason: api_v1beta1.InsideAllowedWindow}, nil
+	}
+
+	var opensAt time.Time
+	for _, w := range allowed {
+		schedule, err := ParseBackupWindow(w, timeZone)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := windowEnd(schedule, w.Duration.Duration, now); ok {
+			return &WindowDecision{Open: true, Reason: api_v1beta1.InsideAllowedWindow}, nil
+		}
+		if next := schedule.Next(now); !next.IsZero() && (opensAt.IsZero() || next.Before(opensAt)) {
+			opensAt = next
+		}
+	}
+
+	msg := "Current time is outside of the allowed windows."
+	if !opensAt.IsZero() {
+		msg = fmt.Sprintf("Current time is outside of the allowed windows. Next window opens at %s.", opensAt.Format(time.RFC3339))
+	}
+	return &WindowDecision{
+		Reason:  api_v1beta1.OutsideAllowedWindows,
+		Message: msg,
+		OpensAt: opensAt,
+	}, nil
+}
+
+// windowEnd returns the closing time of the window that contains t, if any.
+// The window contains t if it was opened within the last duration.
+func windowEnd(schedule *Schedule, duration time.Duration, t time.Time) (time.Time, bool) {
+	start := schedule.Next(t.Add(-duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	return start.Add(duration), true
+}
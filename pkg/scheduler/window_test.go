@@ -0,0 +1,80 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckBackupWindows(t *testing.T) {
+	// weekdays from 22:00 to 04:00 in UTC
+	nightly := api_v1beta1.BackupWindow{Start: "0 22 * * 1-5", Duration: metav1.Duration{Duration: 6 * time.Hour}, TimeZone: "UTC"}
+	// every 1st day of the month from 00:00 to 02:00 in UTC
+	monthly := api_v1beta1.BackupWindow{Start: "0 0 1 * *", Duration: metav1.Duration{Duration: 2 * time.Hour}, TimeZone: "UTC"}
+
+	testCases := []struct {
+		description string
+		allowed     []api_v1beta1.BackupWindow
+		blackout    []api_v1beta1.BackupWindow
+		now         string
+		open        bool
+		reason      string
+		opensAt     string
+	}{
+		{description: "no windows", now: "2021-03-04T12:00:00Z", open: true, reason: api_v1beta1.InsideAllowedWindow},
+		{description: "inside allowed window", allowed: []api_v1beta1.BackupWindow{nightly}, now: "2021-03-04T23:00:00Z", open: true, reason: api_v1beta1.InsideAllowedWindow},
+		{description: "inside allowed window after midnight", allowed: []api_v1beta1.BackupWindow{nightly}, now: "2021-03-05T03:59:00Z", open: true, reason: api_v1beta1.InsideAllowedWindow},
+		{description: "allowed window closed", allowed: []api_v1beta1.BackupWindow{nightly}, now: "2021-03-05T04:00:00Z", reason: api_v1beta1.OutsideAllowedWindows, opensAt: "2021-03-05T22:00:00Z"},
+		{description: "outside allowed window on weekend", allowed: []api_v1beta1.BackupWindow{nightly}, now: "2021-03-06T23:00:00Z", reason: api_v1beta1.OutsideAllowedWindows, opensAt: "2021-03-08T22:00:00Z"},
+		{description: "inside blackout window", blackout: []api_v1beta1.BackupWindow{monthly}, now: "2021-04-01T01:00:00Z", reason: api_v1beta1.InsideBlackoutWindow, opensAt: "2021-04-01T02:00:00Z"},
+		{description: "blackout takes precedence", allowed: []api_v1beta1.BackupWindow{nightly}, blackout: []api_v1beta1.BackupWindow{monthly}, now: "2021-04-01T01:00:00Z", reason: api_v1beta1.InsideBlackoutWindow, opensAt: "2021-04-01T02:00:00Z"},
+		{description: "outside blackout window", blackout: []api_v1beta1.BackupWindow{monthly}, now: "2021-04-01T02:00:00Z", open: true, reason: api_v1beta1.InsideAllowedWindow},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			decision, err := CheckBackupWindows(tc.allowed, tc.blackout, "", parseTime(tc.now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Open != tc.open || decision.Reason != tc.reason {
+				t.Errorf("expected open: %v, reason: %s. found open: %v, reason: %s", tc.open, tc.reason, decision.Open, decision.Reason)
+			}
+			if tc.opensAt != "" && !decision.OpensAt.Equal(parseTime(tc.opensAt)) {
+				t.Errorf("expected the window to open at %s, found %s", tc.opensAt, decision.OpensAt)
+			}
+		})
+	}
+}
+
+func TestParseBackupWindowErrors(t *testing.T) {
+	windows := []api_v1beta1.BackupWindow{
+		{Start: "0 22 * * *"},
+		{Start: "@every 1h", Duration: metav1.Duration{Duration: time.Hour}},
+		{Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Invalid/Zone"},
+	}
+	for _, w := range windows {
+		if _, err := ParseBackupWindow(w, ""); err == nil {
+			t.Errorf("expected error for backup window %+v", w)
+		}
+	}
+}
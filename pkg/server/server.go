@@ -258,7 +258,11 @@ func (c completedConfig) New() (*StashServer, error) {
 	{
 		apiGroupInfo := genericapiserver.NewDefaultAPIGroupInfo(repositories.GroupName, Scheme, metav1.ParameterCodec, Codecs)
 		v1alpha1storage := map[string]rest.Storage{}
-		v1alpha1storage[v1alpha1.ResourcePluralSnapshot] = snapregistry.NewREST(c.ExtraConfig.ClientConfig)
+		snapshotStorage := snapregistry.NewREST(c.ExtraConfig.ClientConfig)
+		v1alpha1storage[v1alpha1.ResourcePluralSnapshot] = snapshotStorage
+		v1alpha1storage[v1alpha1.ResourcePluralSnapshot+"/files"] = snapregistry.NewFilesREST(snapshotStorage)
+		v1alpha1storage[v1alpha1.ResourcePluralSnapshot+"/download"] = snapregistry.NewDownloadREST(snapshotStorage)
+		v1alpha1storage[v1alpha1.ResourcePluralSnapshot+"/diff"] = snapregistry.NewDiffREST(snapshotStorage)
 		apiGroupInfo.VersionedResourcesStorageMap["v1alpha1"] = v1alpha1storage
 
 		if err := s.GenericAPIServer.InstallAPIGroup(&apiGroupInfo); err != nil {
@@ -0,0 +1,89 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/invoker"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	"k8s.io/klog/v2"
+)
+
+// progressReportInterval is the minimum interval between two progress updates of a host.
+// It keeps a long running backup or restore from flooding the API server with status updates.
+const progressReportInterval = 30 * time.Second
+
+// BackupProgressReporter returns a restic.ProgressFunc that records the progress of the backup of the host
+// in the target status of the BackupSession.
+func (o UpdateStatusOptions) BackupProgressReporter(backupSession *v1beta1.BackupSession, host string) restic.ProgressFunc {
+	// use a separate handler so that the reporter does not share the BackupSession with the caller
+	session := invoker.NewBackupSessionHandler(o.StashClient, backupSession.DeepCopy())
+	return throttleProgress(func(progress v1beta1.Progress) error {
+		return session.UpdateStatus(&v1beta1.BackupSessionStatus{
+			Targets: []v1beta1.BackupTargetStatus{
+				{
+					Ref: o.TargetRef,
+					Stats: []v1beta1.HostBackupStats{
+						{
+							Hostname: host,
+							Progress: &progress,
+						},
+					},
+				},
+			},
+		})
+	})
+}
+
+// RestoreProgressReporter returns a restic.ProgressFunc that records the progress of the restore of the host
+// in the target status of the restore invoker.
+func (o UpdateStatusOptions) RestoreProgressReporter(inv invoker.RestoreInvoker, host string) restic.ProgressFunc {
+	return throttleProgress(func(progress v1beta1.Progress) error {
+		return inv.UpdateStatus(invoker.RestoreInvokerStatus{
+			TargetStatus: []v1beta1.RestoreMemberStatus{
+				{
+					Ref: o.TargetRef,
+					Stats: []v1beta1.HostRestoreStats{
+						{
+							Hostname: host,
+							Progress: &progress,
+						},
+					},
+				},
+			},
+		})
+	})
+}
+
+// throttleProgress drops the progress that arrives within progressReportInterval of the last reported one.
+// The completed progress is always reported so that the status does not get stuck at the last reported one.
+// A failure to report the progress is only logged as it must not fail the backup or restore.
+func throttleProgress(report func(progress v1beta1.Progress) error) restic.ProgressFunc {
+	var lastReported time.Time
+	return func(progress v1beta1.Progress) {
+		if progress.PercentDone < 100 && time.Since(lastReported) < progressReportInterval {
+			return
+		}
+		lastReported = time.Now()
+		if err := report(progress); err != nil {
+			klog.Warningf("Failed to update the progress. Reason: %v", err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"testing"
+
+	"stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+)
+
+func TestStepProgress(t *testing.T) {
+	var reported []v1beta1.Progress
+	progress := restic.NewStepProgress(func(p v1beta1.Progress) {
+		reported = append(reported, p)
+	}, 2)
+
+	// first path
+	progress.Reporter()(v1beta1.Progress{PercentDone: 50, TotalBytes: 100, BytesProcessed: 50, TotalFiles: 4, FilesProcessed: 2, ETA: "10s"})
+	progress.Complete()
+	// second path
+	progress.Reporter()(v1beta1.Progress{PercentDone: 50, TotalBytes: 200, BytesProcessed: 100, TotalFiles: 2, FilesProcessed: 1, ETA: "20s"})
+	progress.Complete()
+
+	expected := []v1beta1.Progress{
+		{PercentDone: 25, TotalBytes: 100, BytesProcessed: 50, TotalFiles: 4, FilesProcessed: 2},
+		{PercentDone: 50, TotalBytes: 100, BytesProcessed: 100, TotalFiles: 4, FilesProcessed: 4},
+		{PercentDone: 75, TotalBytes: 300, BytesProcessed: 200, TotalFiles: 6, FilesProcessed: 5, ETA: "20s"},
+		{PercentDone: 100, TotalBytes: 300, BytesProcessed: 300, TotalFiles: 6, FilesProcessed: 6},
+	}
+	if len(reported) != len(expected) {
+		t.Fatalf("expected %d progress updates, found %d", len(expected), len(reported))
+	}
+	for i := range expected {
+		reported[i].LastUpdateTime = nil
+		if reported[i] != expected[i] {
+			t.Errorf("update %d: expected %+v, found %+v", i, expected[i], reported[i])
+		}
+	}
+}
+
+func TestStepProgressWithoutReporter(t *testing.T) {
+	progress := restic.NewStepProgress(nil, 2)
+	if progress.Reporter() != nil {
+		t.Errorf("expected no reporter when no progress has been asked for")
+	}
+	progress.Complete()
+}
+
+func TestThrottleProgress(t *testing.T) {
+	var reported []int32
+	onProgress := throttleProgress(func(progress v1beta1.Progress) error {
+		reported = append(reported, progress.PercentDone)
+		return nil
+	})
+
+	progress := restic.NewStepProgress(onProgress, 2)
+	progress.Reporter()(v1beta1.Progress{PercentDone: 10, TotalBytes: 100, BytesProcessed: 10})
+	progress.Reporter()(v1beta1.Progress{PercentDone: 80, TotalBytes: 100, BytesProcessed: 80})
+	progress.Complete()
+	progress.Reporter()(v1beta1.Progress{PercentDone: 50, TotalBytes: 100, BytesProcessed: 50})
+	progress.Complete()
+
+	// the updates within progressReportInterval of the first one are dropped, except the completed one
+	expected := []int32{5, 100}
+	if len(reported) != len(expected) {
+		t.Fatalf("expected progress %v, found %v", expected, reported)
+	}
+	for i := range expected {
+		if reported[i] != expected[i] {
+			t.Errorf("expected progress %v, found %v", expected, reported)
+		}
+	}
+}
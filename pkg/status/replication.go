@@ -0,0 +1,123 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// replicateRepository copies the snapshots of the Repository to its replicas. A replication failure does not fail
+// the backup. Instead, it is recorded in the replica status and a warning event is created for the Repository.
+func (o *UpdateStatusOptions) replicateRepository(repo *v1alpha1.Repository, retentionPolicy v1alpha1.RetentionPolicy) []v1alpha1.ReplicaStatus {
+	statuses := make([]v1alpha1.ReplicaStatus, 0, len(repo.Spec.Replicas))
+	src, srcErr := restic.NewResticWrapper(o.SetupOpt)
+	for _, replica := range repo.Spec.Replicas {
+		klog.Infof("Replicating snapshots to replica %q.....", replica.Name)
+		now := metav1.Now()
+		status := v1alpha1.ReplicaStatus{
+			Name:                replica.Name,
+			LastReplicationTime: &now,
+		}
+
+		err := srcErr
+		var stats *restic.ReplicationStats
+		if err == nil {
+			stats, err = o.replicateTo(src, repo, replica, retentionPolicy)
+		}
+		if err != nil {
+			// keep the last known progress of the replica
+			if prev := getReplicaStatus(repo.Status.Replicas, replica.Name); prev != nil {
+				status.LastCopiedSnapshot = prev.LastCopiedSnapshot
+				status.LastCopiedSnapshotTime = prev.LastCopiedSnapshotTime
+				status.Lag = prev.Lag
+			}
+			status.Error = err.Error()
+			eventer.CreateEventWithLog(
+				o.KubeClient,
+				eventer.EventSourceStatusUpdater,
+				repo,
+				core.EventTypeWarning,
+				eventer.EventReasonRepositoryReplicationFailed,
+				fmt.Sprintf("Failed to replicate snapshots to replica %q. Reason: %v", replica.Name, err),
+			)
+		} else {
+			status.LastCopiedSnapshot = stats.LastCopiedSnapshot
+			if !stats.LastCopiedSnapshotTime.IsZero() {
+				status.LastCopiedSnapshotTime = &metav1.Time{Time: stats.LastCopiedSnapshotTime}
+			}
+			status.Lag = stats.Lag
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (o *UpdateStatusOptions) replicateTo(src *restic.ResticWrapper, repo *v1alpha1.Repository, replica v1alpha1.RepositoryReplica, retentionPolicy v1alpha1.RetentionPolicy) (*restic.ReplicationStats, error) {
+	secret, err := o.KubeClient.CoreV1().Secrets(repo.Namespace).Get(context.TODO(), replica.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the Repository may have been created before its replica Secret, so the webhook could not check the credentials
+	if err := util.ReplicaCredentialsConflict(repo.Spec.Backend, o.SetupOpt.StorageSecret, replica.Backend, secret); err != nil {
+		return nil, err
+	}
+	setupOpt, err := util.SetupOptionsForBackend(replica.Backend, util.ExtraOptions{
+		StorageSecret: secret,
+		ScratchDir:    o.SetupOpt.ScratchDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	setupOpt.Nice = o.SetupOpt.Nice
+	setupOpt.IONice = o.SetupOpt.IONice
+	setupOpt.LockPeriod = o.SetupOpt.LockPeriod
+	setupOpt.UploadLimit = o.SetupOpt.UploadLimit
+	setupOpt.DownloadLimit = o.SetupOpt.DownloadLimit
+
+	dst, err := restic.NewResticWrapper(setupOpt)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := dst.ReplicateFrom(src)
+	if err != nil {
+		return nil, err
+	}
+	// keep the replica in sync with the snapshots removed from the Repository
+	if _, err := dst.ApplyRetentionPolicies(retentionPolicy); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func getReplicaStatus(statuses []v1alpha1.ReplicaStatus, name string) *v1alpha1.ReplicaStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
@@ -32,6 +32,7 @@ import (
 	"stash.appscode.dev/apimachinery/pkg/metrics"
 	"stash.appscode.dev/apimachinery/pkg/restic"
 	"stash.appscode.dev/stash/pkg/eventer"
+	"stash.appscode.dev/stash/pkg/util"
 
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -241,7 +242,7 @@ func (o UpdateStatusOptions) executePostBackupActions(inv invoker.BackupInvoker,
 	for _, targetStatus := range session.GetTargetStatus() {
 		if invoker.TargetMatched(targetStatus.Ref, curTarget) && len(targetStatus.PostBackupActions) > 0 {
 			// For StatefulSet and DaemonSet, only the last host will run these PostBackupActions
-			if curTarget.Kind == apis.KindStatefulSet || curTarget.Kind == apis.KindDaemonSet {
+			if util.IsOrdinalHostWorkload(curTarget.APIVersion, curTarget.Kind) || curTarget.Kind == apis.KindDaemonSet {
 				if len(targetStatus.Stats) != (int(*targetStatus.TotalHosts) - numCurHosts) {
 					klog.Infof("Skipping running PostBackupActions. Reason: Only the last host will execute the post backup actions for %s", curTarget.Kind)
 					return nil
@@ -258,6 +259,15 @@ func (o UpdateStatusOptions) executePostBackupActions(inv invoker.BackupInvoker,
 }
 
 func (o *UpdateStatusOptions) executePostBackupActionsForTarget(inv invoker.BackupInvoker, session *invoker.BackupSessionHandler, targetStatus v1beta1.BackupTargetStatus) error {
+	// the retention policy must not remove the snapshots that are locked by the immutability policy
+	repo, err := inv.GetRepository()
+	if err != nil {
+		return err
+	}
+	if repo.Spec.Immutability != nil {
+		o.SetupOpt.LockPeriod = repo.Spec.Immutability.RetentionPeriod.Duration
+	}
+
 	var repoStats restic.RepositoryStats
 	for _, action := range targetStatus.PostBackupActions {
 		switch action {
@@ -358,6 +368,10 @@ func (o *UpdateStatusOptions) updateRepositoryStatus(inv invoker.BackupInvoker,
 		if err != nil {
 			return err
 		}
+		var replicas []v1alpha1.ReplicaStatus
+		if len(repo.Spec.Replicas) > 0 {
+			replicas = o.replicateRepository(repo, inv.GetRetentionPolicy())
+		}
 		startTime := session.GetObjectMeta().CreationTimestamp
 		_, err = stash_util.UpdateRepositoryStatus(
 			context.TODO(),
@@ -369,6 +383,7 @@ func (o *UpdateStatusOptions) updateRepositoryStatus(inv invoker.BackupInvoker,
 				in.SnapshotsRemovedOnLastCleanup = repoStats.SnapshotsRemovedOnLastCleanup
 				in.TotalSize = repoStats.Size
 				in.LastBackupTime = &startTime
+				in.Replicas = replicas
 				return repo.UID, in
 			}, metav1.UpdateOptions{})
 		return err
@@ -0,0 +1,59 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// BackupConfigurationSpecForBlueprint returns the spec of the BackupConfiguration that a BackupBlueprint generates for
+// the target. The schedule of the blueprint is overwritten by the 'stash.appscode.com/schedule' annotation of the target,
+// if present. The TimeZone of the blueprint is copied in both cases, so the generated schedule is evaluated in that zone.
+func BackupConfigurationSpecForBlueprint(
+	blueprint *api_v1beta1.BackupBlueprint,
+	target *api_v1beta1.BackupTarget,
+	repository string,
+	targetAnnotations map[string]string,
+) api_v1beta1.BackupConfigurationSpec {
+	bb := blueprint.DeepCopy()
+	schedule := bb.Spec.Schedule
+	if s, ok := targetAnnotations[api_v1beta1.KeySchedule]; ok && s != "" {
+		schedule = s
+	}
+	return api_v1beta1.BackupConfigurationSpec{
+		BackupConfigurationTemplateSpec: api_v1beta1.BackupConfigurationTemplateSpec{
+			Task:                  bb.Spec.Task,
+			Target:                target,
+			RuntimeSettings:       bb.Spec.RuntimeSettings,
+			TempDir:               bb.Spec.TempDir,
+			InterimVolumeTemplate: bb.Spec.InterimVolumeTemplate,
+			Hooks:                 bb.Spec.Hooks,
+		},
+		Schedule: schedule,
+		TimeZone: bb.Spec.TimeZone,
+		Repository: kmapi.ObjectReference{
+			Namespace: bb.Spec.RepoNamespace,
+			Name:      repository,
+		},
+		RetentionPolicy:    bb.Spec.RetentionPolicy,
+		BackupHistoryLimit: bb.Spec.BackupHistoryLimit,
+		TimeOut:            bb.Spec.TimeOut,
+		RetryConfig:        bb.Spec.RetryConfig,
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+
+	"k8s.io/utils/ptr"
+)
+
+func TestBackupConfigurationSpecForBlueprint(t *testing.T) {
+	blueprint := &api_v1beta1.BackupBlueprint{
+		Spec: api_v1beta1.BackupBlueprintSpec{
+			RepoNamespace:      "stash",
+			Schedule:           "0 2 * * *",
+			TimeZone:           "Europe/Berlin",
+			Task:               api_v1beta1.TaskRef{Name: "postgres-backup"},
+			BackupHistoryLimit: ptr.To[int32](3),
+		},
+	}
+	target := &api_v1beta1.BackupTarget{Alias: "db"}
+
+	testCases := []struct {
+		description      string
+		annotations      map[string]string
+		expectedSchedule string
+	}{
+		{description: "schedule of the blueprint", annotations: nil, expectedSchedule: "0 2 * * *"},
+		{description: "schedule overwritten by annotation", annotations: map[string]string{api_v1beta1.KeySchedule: "*/30 * * * *"}, expectedSchedule: "*/30 * * * *"},
+		{description: "empty schedule annotation", annotations: map[string]string{api_v1beta1.KeySchedule: ""}, expectedSchedule: "0 2 * * *"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			spec := BackupConfigurationSpecForBlueprint(blueprint, target, "db-repo", tc.annotations)
+			if spec.Schedule != tc.expectedSchedule {
+				t.Errorf("expected schedule %q, found %q", tc.expectedSchedule, spec.Schedule)
+			}
+			if spec.TimeZone != blueprint.Spec.TimeZone {
+				t.Errorf("expected time zone %q, found %q", blueprint.Spec.TimeZone, spec.TimeZone)
+			}
+			if spec.Repository.Namespace != "stash" || spec.Repository.Name != "db-repo" {
+				t.Errorf("expected repository stash/db-repo, found %s/%s", spec.Repository.Namespace, spec.Repository.Name)
+			}
+			if spec.Task.Name != "postgres-backup" || spec.Target != target {
+				t.Errorf("expected task and target of the blueprint, found %v and %v", spec.Task, spec.Target)
+			}
+			if spec.BackupHistoryLimit == nil || *spec.BackupHistoryLimit != 3 {
+				t.Errorf("expected backup history limit 3, found %v", spec.BackupHistoryLimit)
+			}
+			if spec.BackupHistoryLimit == blueprint.Spec.BackupHistoryLimit {
+				t.Errorf("expected the spec not to share the backup history limit with the blueprint")
+			}
+		})
+	}
+}
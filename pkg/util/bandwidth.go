@@ -0,0 +1,198 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"stash.appscode.dev/apimachinery/apis"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+// nodeBandwidthHostPath is the directory on the node where the Stash containers hold the slots
+// of the per-node bandwidth limits.
+const nodeBandwidthHostPath = "/var/run/stash/bandwidth"
+
+// bandwidthSlotPollInterval is the interval to look for a free bandwidth slot when all of them are in use.
+const bandwidthSlotPollInterval = 5 * time.Second
+
+// NodeBandwidthLimit is the bandwidth in KiB/s shared by all the Stash containers running on a node. Zero means unlimited.
+// The bandwidth is divided into a fixed number of slots, so that the share of a process does not depend on
+// the processes that start or complete after it.
+type NodeBandwidthLimit struct {
+	Upload   int32
+	Download int32
+	Slots    int32
+}
+
+var nodeBandwidthLimit NodeBandwidthLimit
+
+func SetNodeBandwidthLimit(limit NodeBandwidthLimit) {
+	nodeBandwidthLimit = limit
+}
+
+func GetNodeBandwidthLimit() NodeBandwidthLimit {
+	return nodeBandwidthLimit
+}
+
+func (l NodeBandwidthLimit) IsSet() bool {
+	return l.Upload > 0 || l.Download > 0
+}
+
+// UpsertNodeBandwidthLimit passes the per-node bandwidth limits to the container and mounts the node-local directory
+// that the containers use to share them. Nothing is changed if the operator has not been configured with any limit.
+// The directory is mounted as a hostPath volume, so the pods get rejected in the namespaces that enforce the baseline
+// or restricted Pod Security Standards. The per-node limits must not be used for such namespaces.
+func UpsertNodeBandwidthLimit(container core.Container, volumes []core.Volume) (core.Container, []core.Volume) {
+	limit := GetNodeBandwidthLimit()
+	if !limit.IsSet() {
+		return container, volumes
+	}
+	container.Env = core_util.UpsertEnvVars(container.Env,
+		core.EnvVar{
+			Name:  apis.KeyNodeUploadLimit,
+			Value: strconv.Itoa(int(limit.Upload)),
+		},
+		core.EnvVar{
+			Name:  apis.KeyNodeDownloadLimit,
+			Value: strconv.Itoa(int(limit.Download)),
+		},
+		core.EnvVar{
+			Name:  apis.KeyNodeBandwidthSlots,
+			Value: strconv.Itoa(int(limit.Slots)),
+		},
+	)
+	container.VolumeMounts = core_util.UpsertVolumeMountByPath(container.VolumeMounts, core.VolumeMount{
+		Name:      apis.BandwidthVolumeName,
+		MountPath: apis.BandwidthDirMountPath,
+	})
+	hostPathType := core.HostPathDirectoryOrCreate
+	volumes = core_util.UpsertVolume(volumes, core.Volume{
+		Name: apis.BandwidthVolumeName,
+		VolumeSource: core.VolumeSource{
+			HostPath: &core.HostPathVolumeSource{
+				Path: nodeBandwidthHostPath,
+				Type: &hostPathType,
+			},
+		},
+	})
+	return container, volumes
+}
+
+// UpsertNodeBandwidthLimitInPodSpec applies UpsertNodeBandwidthLimit to all the containers of the pod.
+func UpsertNodeBandwidthLimitInPodSpec(podSpec core.PodSpec) core.PodSpec {
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i], podSpec.Volumes = UpsertNodeBandwidthLimit(podSpec.InitContainers[i], podSpec.Volumes)
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i], podSpec.Volumes = UpsertNodeBandwidthLimit(podSpec.Containers[i], podSpec.Volumes)
+	}
+	return podSpec
+}
+
+// ReserveNodeBandwidth takes a slot of the per-node bandwidth and lowers the limits of setupOpt to the share of a slot.
+// As restic can not change its limits while running, the share is fixed. It waits until a slot becomes free
+// if all of them are in use. The returned function releases the slot and must always be called.
+func ReserveNodeBandwidth(setupOpt *restic.SetupOptions) (func(), error) {
+	release := func() {}
+
+	limit := NodeBandwidthLimit{
+		Upload:   getInt32Env(apis.KeyNodeUploadLimit),
+		Download: getInt32Env(apis.KeyNodeDownloadLimit),
+		Slots:    max(getInt32Env(apis.KeyNodeBandwidthSlots), 1),
+	}
+	if !limit.IsSet() {
+		return release, nil
+	}
+	if _, err := os.Stat(apis.BandwidthDirMountPath); err != nil {
+		klog.Warningf("Ignoring the per-node bandwidth limit. Reason: %v", err)
+		return release, nil
+	}
+
+	for {
+		var err error
+		release, err = acquireBandwidthSlot(apis.BandwidthDirMountPath, limit.Slots)
+		if err != nil {
+			return func() {}, err
+		}
+		if release != nil {
+			break
+		}
+		klog.Infof("All the %d bandwidth slots of the node are in use. Waiting for a free slot...", limit.Slots)
+		time.Sleep(bandwidthSlotPollInterval)
+	}
+
+	setupOpt.UploadLimit = bandwidthShare(setupOpt.UploadLimit, limit.Upload, limit.Slots)
+	setupOpt.DownloadLimit = bandwidthShare(setupOpt.DownloadLimit, limit.Download, limit.Slots)
+	klog.Infof("Using a slot of the node bandwidth. Upload limit: %d KiB/s, download limit: %d KiB/s",
+		setupOpt.UploadLimit, setupOpt.DownloadLimit)
+	return release, nil
+}
+
+// acquireBandwidthSlot locks the first free slot file of the directory and returns the function that releases it.
+// It returns nil if all the slots are in use. The lock is held as long as the process is alive,
+// so that a crashed process does not hold any slot.
+func acquireBandwidthSlot(dir string, slots int32) (func(), error) {
+	for i := int32(0); i < slots; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("slot-%d", i)), os.O_CREATE|os.O_RDWR, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+				_ = f.Close()
+			}, nil
+		}
+		_ = f.Close()
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// bandwidthShare returns the smaller of the Repository limit and the share of a slot of the node limit.
+func bandwidthShare(repoLimit, nodeLimit, slots int32) int32 {
+	if nodeLimit <= 0 {
+		return repoLimit
+	}
+	share := max(nodeLimit/max(slots, 1), 1)
+	if repoLimit > 0 && repoLimit < share {
+		return repoLimit
+	}
+	return share
+}
+
+func getInt32Env(key string) int32 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(v)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+func TestBandwidthShare(t *testing.T) {
+	testCases := []struct {
+		description string
+		repoLimit   int32
+		nodeLimit   int32
+		slots       int32
+		expected    int32
+	}{
+		{description: "no node limit", repoLimit: 100, nodeLimit: 0, slots: 4, expected: 100},
+		{description: "no limit at all", repoLimit: 0, nodeLimit: 0, slots: 4, expected: 0},
+		{description: "only node limit", repoLimit: 0, nodeLimit: 1000, slots: 4, expected: 250},
+		{description: "repository limit below the share", repoLimit: 100, nodeLimit: 1000, slots: 4, expected: 100},
+		{description: "repository limit above the share", repoLimit: 500, nodeLimit: 1000, slots: 4, expected: 250},
+		{description: "single slot", repoLimit: 0, nodeLimit: 1000, slots: 1, expected: 1000},
+		{description: "share rounded down to the minimum", repoLimit: 0, nodeLimit: 3, slots: 4, expected: 1},
+		{description: "invalid slot count", repoLimit: 0, nodeLimit: 1000, slots: 0, expected: 1000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if share := bandwidthShare(tc.repoLimit, tc.nodeLimit, tc.slots); share != tc.expected {
+				t.Errorf("expected share %d, found %d", tc.expected, share)
+			}
+		})
+	}
+}
+
+func TestAcquireBandwidthSlot(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := acquireBandwidthSlot(dir, 2)
+	if err != nil || first == nil {
+		t.Fatalf("expected the first slot to be acquired, found error %v", err)
+	}
+	second, err := acquireBandwidthSlot(dir, 2)
+	if err != nil || second == nil {
+		t.Fatalf("expected the second slot to be acquired, found error %v", err)
+	}
+
+	third, err := acquireBandwidthSlot(dir, 2)
+	if err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	if third != nil {
+		t.Fatal("expected no free slot, found one")
+	}
+
+	// a released slot is handed out again
+	first()
+	third, err = acquireBandwidthSlot(dir, 2)
+	if err != nil || third == nil {
+		t.Fatalf("expected the released slot to be acquired, found error %v", err)
+	}
+	second()
+	third()
+}
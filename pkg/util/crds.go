@@ -140,10 +140,14 @@ func pvcBackupFunction(image docker.Docker) *api_v1beta1.Function {
 				"--path=${REPOSITORY_PREFIX:=}",
 				"--enable-cache=${ENABLE_CACHE:=true}",
 				"--max-connections=${MAX_CONNECTIONS:=0}",
+				"--upload-limit=${UPLOAD_LIMIT:=0}",
+				"--download-limit=${DOWNLOAD_LIMIT:=0}",
 				"--hostname=${HOSTNAME:=}",
 				"--backup-paths=${TARGET_PATHS}",
 				"--exclude=${EXCLUDE_PATTERNS:=}",
 				"--args=${DRIVER_ARGS:=}",
+				"--compression=${COMPRESSION:=}",
+				"--pack-size=${PACK_SIZE:=0}",
 				"--invoker-kind=${INVOKER_KIND:=}",
 				"--invoker-name=${INVOKER_NAME:=}",
 				"--storage-secret-name=${REPOSITORY_SECRET_NAME}",
@@ -191,12 +195,16 @@ func pvcRestoreFunction(image docker.Docker) *api_v1beta1.Function {
 				"--path=${REPOSITORY_PREFIX:=}",
 				"--enable-cache=${ENABLE_CACHE:=true}",
 				"--max-connections=${MAX_CONNECTIONS:=0}",
+				"--upload-limit=${UPLOAD_LIMIT:=0}",
+				"--download-limit=${DOWNLOAD_LIMIT:=0}",
 				"--hostname=${HOSTNAME:=}",
 				"--restore-paths=${RESTORE_PATHS}",
 				"--include=${INCLUDE_PATTERNS:=}",
 				"--exclude=${EXCLUDE_PATTERNS:=}",
 				"--args=${DRIVER_ARGS:=}",
 				"--snapshots=${RESTORE_SNAPSHOTS:=}",
+				"--point-in-time=${RESTORE_POINT_IN_TIME:=}",
+				"--path-mappings=${RESTORE_PATH_MAPPINGS:=}",
 				"--output-dir=${outputDir:=}",
 				"--invoker-kind=${INVOKER_KIND:=}",
 				"--invoker-name=${INVOKER_NAME:=}",
@@ -23,6 +23,7 @@ import (
 
 	go_str "gomodules.xyz/x/strings"
 	core "k8s.io/api/core/v1"
+	store "kmodules.xyz/objectstore-api/api/v1"
 )
 
 // options that don't come from repository, backup-config, backup-session, restore-session
@@ -34,7 +35,7 @@ type ExtraOptions struct {
 	StorageSecret *core.Secret
 }
 
-func BackupOptionsForBackupTarget(backupTarget *api.BackupTarget, retentionPolicy api_v1alpha1.RetentionPolicy, extraOpt ExtraOptions) restic.BackupOptions {
+func BackupOptionsForBackupTarget(backupTarget *api.BackupTarget, repository *api_v1alpha1.Repository, retentionPolicy api_v1alpha1.RetentionPolicy, extraOpt ExtraOptions) restic.BackupOptions {
 	backupOpt := restic.BackupOptions{
 		Host:            extraOpt.Host,
 		RetentionPolicy: retentionPolicy,
@@ -44,17 +45,56 @@ func BackupOptionsForBackupTarget(backupTarget *api.BackupTarget, retentionPolic
 		backupOpt.Exclude = backupTarget.Exclude
 		backupOpt.Args = backupTarget.Args
 	}
+	compression, packSize := CompressionForBackupTarget(backupTarget, repository)
+	backupOpt.Compression = string(compression)
+	if packSize != nil {
+		backupOpt.PackSize = *packSize
+	}
 	return backupOpt
 }
 
+// CompressionForBackupTarget returns the compression mode and the pack size to use for the backup target.
+// The settings of the target override the ones of the Repository.
+func CompressionForBackupTarget(backupTarget *api.BackupTarget, repository *api_v1alpha1.Repository) (api_v1alpha1.CompressionMode, *int32) {
+	var compression api_v1alpha1.CompressionMode
+	var packSize *int32
+	if repository != nil {
+		compression = repository.Spec.Compression
+		packSize = repository.Spec.PackSize
+	}
+	if backupTarget != nil {
+		if backupTarget.Compression != "" {
+			compression = backupTarget.Compression
+		}
+		if backupTarget.PackSize != nil {
+			packSize = backupTarget.PackSize
+		}
+	}
+	return compression, packSize
+}
+
 // return the matching rule
 // if targetHosts is empty for a rule, it will match any hostname
 func RestoreOptionsForHost(hostname string, rules []api.Rule) restic.RestoreOptions {
+	return restoreOptionsForHost(hostname, hostname, rules)
+}
+
+// RestoreOptionsForTarget returns the matching rule of the target for the host. Unless the rule specifies a sourceHost,
+// the host restores the data of the respective host of the target's source.
+func RestoreOptionsForTarget(hostname string, target *api.RestoreTarget) (restic.RestoreOptions, error) {
+	sourceHost, err := SourceHostForHost(target, hostname)
+	if err != nil {
+		return restic.RestoreOptions{}, err
+	}
+	return restoreOptionsForHost(hostname, sourceHost, target.Rules), nil
+}
+
+func restoreOptionsForHost(hostname, defaultSourceHost string, rules []api.Rule) restic.RestoreOptions {
 	var matchedRule restic.RestoreOptions
 	// first check for rules non-empty targetHost
 	for _, rule := range rules {
 		// if sourceHost is specified in the rule then use it. otherwise use workload itself as host
-		sourceHost := hostname
+		sourceHost := defaultSourceHost
 		if rule.SourceHost != "" {
 			sourceHost = rule.SourceHost
 		}
@@ -67,6 +107,10 @@ func RestoreOptionsForHost(hostname string, rules []api.Rule) restic.RestoreOpti
 				Snapshots:    rule.Snapshots,
 				Include:      rule.Include,
 				Exclude:      rule.Exclude,
+				PathMappings: rule.PathMappings,
+			}
+			if rule.PointInTime != nil {
+				matchedRule.PointInTime = &rule.PointInTime.Time
 			}
 			// if rule has empty targetHost then check further rules to see if any other rule with non-empty targetHost matches
 			if len(rule.TargetHosts) == 0 {
@@ -81,21 +125,31 @@ func RestoreOptionsForHost(hostname string, rules []api.Rule) restic.RestoreOpti
 }
 
 func SetupOptionsForRepository(repository api_v1alpha1.Repository, extraOpt ExtraOptions) (restic.SetupOptions, error) {
-	provider, err := repository.Spec.Backend.Provider()
+	setupOpt, err := SetupOptionsForBackend(repository.Spec.Backend, extraOpt)
+	if err != nil {
+		return restic.SetupOptions{}, err
+	}
+	setupOpt.UploadLimit = repository.Spec.UploadLimit
+	setupOpt.DownloadLimit = repository.Spec.DownloadLimit
+	return setupOpt, nil
+}
+
+func SetupOptionsForBackend(backend store.Backend, extraOpt ExtraOptions) (restic.SetupOptions, error) {
+	provider, err := backend.Provider()
 	if err != nil {
 		return restic.SetupOptions{}, err
 	}
-	bucket, err := repository.Spec.Backend.Container()
+	bucket, err := backend.Container()
 	if err != nil {
 		return restic.SetupOptions{}, err
 	}
-	prefix, err := repository.Spec.Backend.Prefix()
+	prefix, err := backend.Prefix()
 	if err != nil {
 		return restic.SetupOptions{}, err
 	}
-	endpoint, _ := repository.Spec.Backend.Endpoint()
-	region, _ := repository.Spec.Backend.Region()
-	insecureTLS := repository.Spec.Backend.InsecureTLS()
+	endpoint, _ := backend.Endpoint()
+	region, _ := backend.Region()
+	insecureTLS := backend.InsecureTLS()
 
 	return restic.SetupOptions{
 		Provider:       provider,
@@ -108,6 +162,6 @@ func SetupOptionsForRepository(repository api_v1alpha1.Repository, extraOpt Extr
 		StorageSecret:  extraOpt.StorageSecret,
 		ScratchDir:     extraOpt.ScratchDir,
 		EnableCache:    extraOpt.EnableCache,
-		MaxConnections: repository.Spec.Backend.MaxConnections(),
+		MaxConnections: backend.MaxConnections(),
 	}, nil
 }
@@ -0,0 +1,108 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	store "kmodules.xyz/objectstore-api/api/v1"
+)
+
+// ValidateReplicaCredentials checks that restic can access the Repository and each of its replicas at the same time.
+// restic copy reads the backend credentials of both repositories from the same environment variables, so a replica
+// that uses the same provider as the Repository must use the same credentials. i.e. replicating between two GCS buckets
+// with different service accounts or between two S3 buckets of different accounts is not supported.
+// The check is skipped for a replica whose storage Secret does not exist yet.
+func ValidateReplicaCredentials(kubeClient kubernetes.Interface, repo *api_v1alpha1.Repository) error {
+	if len(repo.Spec.Replicas) == 0 {
+		return nil
+	}
+	secret, err := getStorageSecret(kubeClient, repo.Namespace, repo.Spec.Backend.StorageSecretName)
+	if err != nil || secret == nil {
+		return err
+	}
+	for _, replica := range repo.Spec.Replicas {
+		replicaSecret, err := getStorageSecret(kubeClient, repo.Namespace, replica.Backend.StorageSecretName)
+		if err != nil {
+			return err
+		}
+		if replicaSecret == nil {
+			continue
+		}
+		if err := ReplicaCredentialsConflict(repo.Spec.Backend, secret, replica.Backend, replicaSecret); err != nil {
+			return fmt.Errorf("invalid replica %q. Reason: %v", replica.Name, err)
+		}
+	}
+	return nil
+}
+
+// ReplicaCredentialsConflict returns an error if the backend of a replica uses the same provider as the backend of
+// its Repository but the storage Secrets provide different credentials. The restic password and the CA certificate
+// are passed to restic separately for each repository, so they may differ.
+func ReplicaCredentialsConflict(backend store.Backend, secret *core.Secret, replicaBackend store.Backend, replicaSecret *core.Secret) error {
+	provider, err := backend.Provider()
+	if err != nil {
+		return err
+	}
+	replicaProvider, err := replicaBackend.Provider()
+	if err != nil {
+		return err
+	}
+	if provider != replicaProvider || secret == nil || replicaSecret == nil {
+		return nil
+	}
+	for _, key := range credentialKeys(secret, replicaSecret) {
+		if string(secret.Data[key]) != string(replicaSecret.Data[key]) {
+			return fmt.Errorf("the replica requires a different value for %s than the Repository. "+
+				"Replicating between %s backends that use different credentials is not supported", key, provider)
+		}
+	}
+	return nil
+}
+
+func credentialKeys(secrets ...*core.Secret) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, secret := range secrets {
+		for key := range secret.Data {
+			if key == restic.RESTIC_PASSWORD || key == restic.CA_CERT_DATA || seen[key] {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func getStorageSecret(kubeClient kubernetes.Interface, namespace, name string) (*core.Secret, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return nil, nil
+	}
+	return secret, err
+}
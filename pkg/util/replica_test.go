@@ -0,0 +1,129 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	store "kmodules.xyz/objectstore-api/api/v1"
+)
+
+func TestReplicaCredentialsConflict(t *testing.T) {
+	gcs := func(secret string) store.Backend {
+		return store.Backend{StorageSecretName: secret, GCS: &store.GCSSpec{Bucket: "stash-" + secret}}
+	}
+	s3 := func(secret string) store.Backend {
+		return store.Backend{StorageSecretName: secret, S3: &store.S3Spec{Endpoint: "s3.amazonaws.com", Bucket: "stash-" + secret}}
+	}
+
+	testCases := []struct {
+		description    string
+		backend        store.Backend
+		data           map[string]string
+		replicaBackend store.Backend
+		replicaData    map[string]string
+		expectErr      bool
+	}{
+		{
+			description:    "same provider with same credentials and different passwords",
+			backend:        s3("primary"),
+			data:           map[string]string{"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret", "RESTIC_PASSWORD": "foo"},
+			replicaBackend: s3("replica"),
+			replicaData:    map[string]string{"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret", "RESTIC_PASSWORD": "bar"},
+		},
+		{
+			description:    "s3 accounts with different credentials",
+			backend:        s3("primary"),
+			data:           map[string]string{"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret"},
+			replicaBackend: s3("replica"),
+			replicaData:    map[string]string{"AWS_ACCESS_KEY_ID": "other-key", "AWS_SECRET_ACCESS_KEY": "other-secret"},
+			expectErr:      true,
+		},
+		{
+			description:    "gcs buckets with different service accounts",
+			backend:        gcs("primary"),
+			data:           map[string]string{"GOOGLE_PROJECT_ID": "project", "GOOGLE_SERVICE_ACCOUNT_JSON_KEY": "sa-1"},
+			replicaBackend: gcs("replica"),
+			replicaData:    map[string]string{"GOOGLE_PROJECT_ID": "project", "GOOGLE_SERVICE_ACCOUNT_JSON_KEY": "sa-2"},
+			expectErr:      true,
+		},
+		{
+			description:    "credential missing in the replica",
+			backend:        gcs("primary"),
+			data:           map[string]string{"GOOGLE_PROJECT_ID": "project", "GOOGLE_SERVICE_ACCOUNT_JSON_KEY": "sa-1"},
+			replicaBackend: gcs("replica"),
+			replicaData:    map[string]string{"GOOGLE_PROJECT_ID": "project"},
+			expectErr:      true,
+		},
+		{
+			description:    "different providers",
+			backend:        s3("primary"),
+			data:           map[string]string{"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret"},
+			replicaBackend: gcs("replica"),
+			replicaData:    map[string]string{"GOOGLE_PROJECT_ID": "project", "GOOGLE_SERVICE_ACCOUNT_JSON_KEY": "sa-1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := ReplicaCredentialsConflict(tc.backend, newSecret(tc.backend.StorageSecretName, tc.data), tc.replicaBackend, newSecret(tc.replicaBackend.StorageSecretName, tc.replicaData))
+			if tc.expectErr && err == nil {
+				t.Errorf("expected error, found none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("expected no error, found: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateReplicaCredentials(t *testing.T) {
+	repo := &api_v1alpha1.Repository{
+		ObjectMeta: metav1.ObjectMeta{Name: "gcs-repo", Namespace: "demo"},
+		Spec: api_v1alpha1.RepositorySpec{
+			Backend: store.Backend{StorageSecretName: "primary", GCS: &store.GCSSpec{Bucket: "primary"}},
+			Replicas: []api_v1alpha1.RepositoryReplica{
+				{Name: "dr", Backend: store.Backend{StorageSecretName: "replica", GCS: &store.GCSSpec{Bucket: "replica"}}},
+			},
+		},
+	}
+	primary := newSecret("primary", map[string]string{"GOOGLE_SERVICE_ACCOUNT_JSON_KEY": "sa-1"})
+	replica := newSecret("replica", map[string]string{"GOOGLE_SERVICE_ACCOUNT_JSON_KEY": "sa-2"})
+
+	if err := ValidateReplicaCredentials(fake.NewSimpleClientset(primary), repo); err != nil {
+		t.Errorf("expected the check to be skipped for a missing replica Secret, found: %v", err)
+	}
+	if err := ValidateReplicaCredentials(fake.NewSimpleClientset(primary, replica), repo); err == nil {
+		t.Errorf("expected error for replica with different credentials, found none")
+	}
+}
+
+func newSecret(name string, data map[string]string) *core.Secret {
+	secret := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo"},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+	return secret
+}
@@ -0,0 +1,188 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	v1beta1_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1beta1/util"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// MaintenanceTaskMigrate is the task of the `maintain-repository` command that migrates the restic repository.
+// Unlike the other maintenance tasks, it is run on demand by the migration Job.
+const MaintenanceTaskMigrate = "migrate"
+
+// MigrateResticRepositoryToV2 upgrades the restic repository to format version 2 so that the new data gets compressed.
+// If repackUncompressed is true, the existing data is compressed too. The result is verified by checking the
+// format version and the integrity of the repository.
+func MigrateResticRepositoryToV2(w *restic.ResticWrapper, repackUncompressed bool) error {
+	version, err := w.GetRepositoryVersion()
+	if err != nil {
+		return err
+	}
+	if version < 2 {
+		if _, err := w.MigrateRepoToV2(); err != nil {
+			return err
+		}
+	} else {
+		klog.Infof("Restic repository is already at version %d", version)
+	}
+
+	if repackUncompressed {
+		if _, err := w.Prune(restic.PruneOptions{RepackUncompressed: true}); err != nil {
+			return err
+		}
+	}
+
+	version, err = w.GetRepositoryVersion()
+	if err != nil {
+		return err
+	}
+	if version < 2 {
+		return fmt.Errorf("restic repository is still at version %d after the migration", version)
+	}
+	integrity, err := w.CheckRepository(restic.CheckOptions{})
+	if err != nil {
+		return err
+	}
+	if !integrity {
+		return fmt.Errorf("restic repository contains errors after the migration")
+	}
+	return nil
+}
+
+// PauseBackupInvokers pauses the referred BackupConfigurations and BackupBatches that are not paused yet
+// and returns the ones that have been paused.
+func PauseBackupInvokers(stashClient cs.Interface, refs []kmapi.TypedObjectReference) ([]kmapi.TypedObjectReference, error) {
+	var paused []kmapi.TypedObjectReference
+	for _, ref := range refs {
+		if !isBackupInvoker(ref) {
+			continue
+		}
+		changed, err := setBackupInvokerPaused(stashClient, ref, true)
+		if err != nil {
+			return paused, err
+		}
+		if changed {
+			paused = append(paused, ref)
+		}
+	}
+	return paused, nil
+}
+
+// ResumeBackupInvokers resumes the given BackupConfigurations and BackupBatches. The deleted ones are ignored.
+func ResumeBackupInvokers(stashClient cs.Interface, refs []kmapi.TypedObjectReference) error {
+	for _, ref := range refs {
+		if _, err := setBackupInvokerPaused(stashClient, ref, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasActiveBackupSession checks whether any of the referred BackupConfigurations and BackupBatches has a running
+// BackupSession. A Pending BackupSession is considered active too, as it might start once its backup slot or
+// backup window becomes available, even if the invoker has been paused in the meantime.
+func HasActiveBackupSession(stashClient cs.Interface, refs []kmapi.TypedObjectReference) (bool, error) {
+	for _, ref := range refs {
+		if !isBackupInvoker(ref) {
+			continue
+		}
+		sessions, err := stashClient.StashV1beta1().BackupSessions(ref.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(map[string]string{
+				apis.LabelInvokerType: ref.Kind,
+				apis.LabelInvokerName: ref.Name,
+			}).String(),
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, s := range sessions.Items {
+			if s.Status.Phase == api_v1beta1.BackupSessionRunning || s.Status.Phase == api_v1beta1.BackupSessionPending {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func isBackupInvoker(ref kmapi.TypedObjectReference) bool {
+	return ref.Kind == api_v1beta1.ResourceKindBackupConfiguration || ref.Kind == api_v1beta1.ResourceKindBackupBatch
+}
+
+// setBackupInvokerPaused sets `spec.paused` of the referred invoker and returns true if it has been changed.
+func setBackupInvokerPaused(stashClient cs.Interface, ref kmapi.TypedObjectReference, paused bool) (bool, error) {
+	switch ref.Kind {
+	case api_v1beta1.ResourceKindBackupConfiguration:
+		bc, err := stashClient.StashV1beta1().BackupConfigurations(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if kerr.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if bc.Spec.Paused == paused {
+			return false, nil
+		}
+		_, _, err = v1beta1_util.PatchBackupConfiguration(
+			context.TODO(),
+			stashClient.StashV1beta1(),
+			bc,
+			func(in *api_v1beta1.BackupConfiguration) *api_v1beta1.BackupConfiguration {
+				in.Spec.Paused = paused
+				return in
+			},
+			metav1.PatchOptions{},
+		)
+		return err == nil, err
+	case api_v1beta1.ResourceKindBackupBatch:
+		bb, err := stashClient.StashV1beta1().BackupBatches(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if kerr.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if bb.Spec.Paused == paused {
+			return false, nil
+		}
+		_, _, err = v1beta1_util.PatchBackupBatch(
+			context.TODO(),
+			stashClient.StashV1beta1(),
+			bb,
+			func(in *api_v1beta1.BackupBatch) *api_v1beta1.BackupBatch {
+				in.Spec.Paused = paused
+				return in
+			},
+			metav1.PatchOptions{},
+		)
+		return err == nil, err
+	default:
+		return false, fmt.Errorf("unknown backup invoker kind %q", ref.Kind)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	cs "stash.appscode.dev/apimachinery/client/clientset/versioned"
+	v1beta1_util "stash.appscode.dev/apimachinery/client/clientset/versioned/typed/stash/v1beta1/util"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// EnsureRestoreBatchMembers derives the members of a RestoreBatch that refers to a BackupSession and stores them
+// in its spec, so that the RestoreBatch is processed the same way as the one whose members are listed by hand.
+// Nothing is changed if the RestoreBatch does not refer to any BackupSession or already has members.
+func EnsureRestoreBatchMembers(config *rest.Config, stashClient cs.Interface, restoreBatch *api_v1beta1.RestoreBatch) (*api_v1beta1.RestoreBatch, error) {
+	if restoreBatch.Spec.BackupSession == nil || len(restoreBatch.Spec.Members) != 0 {
+		return restoreBatch, nil
+	}
+	members, repository, err := RestoreMembersFromBackupSession(config, stashClient, restoreBatch)
+	if err != nil {
+		return restoreBatch, err
+	}
+	restoreBatch, _, err = v1beta1_util.PatchRestoreBatch(
+		context.TODO(),
+		stashClient.StashV1beta1(),
+		restoreBatch,
+		func(in *api_v1beta1.RestoreBatch) *api_v1beta1.RestoreBatch {
+			in.Spec.Members = members
+			if in.Spec.Repository.Name == "" {
+				in.Spec.Repository = repository
+			}
+			return in
+		},
+		metav1.PatchOptions{},
+	)
+	return restoreBatch, err
+}
+
+// RestoreMembersFromBackupSession returns a member for each selected target of the BackupSession that the RestoreBatch
+// refers to. The members restore the snapshots that the BackupSession has taken for their hosts. The aliases, the Tasks
+// and the Repository are taken from the backup invoker of the BackupSession if it still exists.
+func RestoreMembersFromBackupSession(config *rest.Config, stashClient cs.Interface, restoreBatch *api_v1beta1.RestoreBatch) ([]api_v1beta1.RestoreTargetSpec, kmapi.ObjectReference, error) {
+	source := restoreBatch.Spec.BackupSession
+	backupSession, err := stashClient.StashV1beta1().BackupSessions(restoreBatch.Namespace).Get(context.TODO(), source.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, kmapi.ObjectReference{}, err
+	}
+	if backupSession.Status.Phase != api_v1beta1.BackupSessionSucceeded {
+		return nil, kmapi.ObjectReference{}, fmt.Errorf("BackupSession %s/%s has not succeeded. Current phase: %q",
+			backupSession.Namespace, backupSession.Name, backupSession.Status.Phase)
+	}
+
+	var selector labels.Selector
+	if source.Selector != nil {
+		selector, err = metav1.LabelSelectorAsSelector(source.Selector)
+		if err != nil {
+			return nil, kmapi.ObjectReference{}, err
+		}
+	}
+
+	templates, repository, err := getBackupInvokerTemplates(stashClient, backupSession)
+	if err != nil {
+		return nil, kmapi.ObjectReference{}, err
+	}
+
+	var members []api_v1beta1.RestoreTargetSpec
+	for _, targetStatus := range backupSession.Status.Targets {
+		ref := targetStatus.Ref
+		ref.Namespace = getTargetNamespace(ref, backupSession.Namespace)
+
+		template := findBackupTemplate(templates, ref, backupSession.Namespace)
+		alias := backupTargetAlias(template, targetStatus)
+		if len(source.Aliases) != 0 && !slices.Contains(source.Aliases, alias) {
+			continue
+		}
+		if selector != nil {
+			targetLabels, err := GetTargetLabels(config, ref)
+			if err != nil {
+				return nil, kmapi.ObjectReference{}, err
+			}
+			if !selector.Matches(labels.Set(targetLabels)) {
+				continue
+			}
+		}
+
+		member := api_v1beta1.RestoreTargetSpec{
+			Target: &api_v1beta1.RestoreTarget{
+				Ref:   ref,
+				Alias: alias,
+				Rules: snapshotRulesForTarget(targetStatus),
+			},
+		}
+		if template != nil {
+			member.Task = restoreTaskFor(template.Task)
+			member.RuntimeSettings = template.RuntimeSettings
+			member.TempDir = template.TempDir
+			member.InterimVolumeTemplate = template.InterimVolumeTemplate
+		}
+		members = append(members, member)
+	}
+	if len(members) == 0 {
+		return nil, kmapi.ObjectReference{}, fmt.Errorf("no target of BackupSession %s/%s matches the selection", backupSession.Namespace, backupSession.Name)
+	}
+	return members, repository, nil
+}
+
+// getBackupInvokerTemplates returns the backup templates and the Repository of the invoker of the BackupSession.
+// It returns nothing if the invoker has been deleted.
+func getBackupInvokerTemplates(stashClient cs.Interface, backupSession *api_v1beta1.BackupSession) ([]api_v1beta1.BackupConfigurationTemplateSpec, kmapi.ObjectReference, error) {
+	invokerRef := backupSession.Spec.Invoker
+	switch invokerRef.Kind {
+	case api_v1beta1.ResourceKindBackupBatch:
+		bb, err := stashClient.StashV1beta1().BackupBatches(backupSession.Namespace).Get(context.TODO(), invokerRef.Name, metav1.GetOptions{})
+		if err != nil {
+			if kerr.IsNotFound(err) {
+				return nil, kmapi.ObjectReference{}, nil
+			}
+			return nil, kmapi.ObjectReference{}, err
+		}
+		return bb.Spec.Members, bb.Spec.Repository, nil
+	case api_v1beta1.ResourceKindBackupConfiguration:
+		bc, err := stashClient.StashV1beta1().BackupConfigurations(backupSession.Namespace).Get(context.TODO(), invokerRef.Name, metav1.GetOptions{})
+		if err != nil {
+			if kerr.IsNotFound(err) {
+				return nil, kmapi.ObjectReference{}, nil
+			}
+			return nil, kmapi.ObjectReference{}, err
+		}
+		return []api_v1beta1.BackupConfigurationTemplateSpec{bc.Spec.BackupConfigurationTemplateSpec}, bc.Spec.Repository, nil
+	default:
+		return nil, kmapi.ObjectReference{}, fmt.Errorf("unknown backup invoker kind %q", invokerRef.Kind)
+	}
+}
+
+func findBackupTemplate(templates []api_v1beta1.BackupConfigurationTemplateSpec, ref api_v1beta1.TargetRef, namespace string) *api_v1beta1.BackupConfigurationTemplateSpec {
+	for i, t := range templates {
+		if t.Target != nil && IsBackupTarget(t.Target, ref, namespace) {
+			return &templates[i]
+		}
+	}
+	return nil
+}
+
+// backupTargetAlias returns the alias of the backup target. If the backup invoker is gone, the alias is recovered
+// from the hostname of a single host target, as the hostname of such a target is its alias.
+func backupTargetAlias(template *api_v1beta1.BackupConfigurationTemplateSpec, targetStatus api_v1beta1.BackupTargetStatus) string {
+	if template != nil {
+		return template.Target.Alias
+	}
+	if len(targetStatus.Stats) == 1 && targetStatus.Stats[0].Hostname != apis.DefaultHost {
+		return targetStatus.Stats[0].Hostname
+	}
+	return ""
+}
+
+// snapshotRulesForTarget returns a rule for each of the backed up hosts of the target that restores the snapshots
+// taken for it. The rule of a single host target matches any host, so that it does not depend on the alias.
+func snapshotRulesForTarget(targetStatus api_v1beta1.BackupTargetStatus) []api_v1beta1.Rule {
+	var rules []api_v1beta1.Rule
+	for _, host := range targetStatus.Stats {
+		if host.Phase != api_v1beta1.HostBackupSucceeded || len(host.Snapshots) == 0 {
+			continue
+		}
+		rule := api_v1beta1.Rule{
+			SourceHost: host.Hostname,
+		}
+		for _, snapshot := range host.Snapshots {
+			rule.Snapshots = append(rule.Snapshots, snapshot.Name)
+		}
+		if len(targetStatus.Stats) > 1 {
+			rule.TargetHosts = []string{host.Hostname}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// restoreTaskFor returns the restore Task that pairs with the backup Task. The Tasks are named
+// "<name>-backup-<version>" and "<name>-restore-<version>". An empty Task is resolved from the AppBinding.
+// The params of the backup Task are not passed, as they are specific to the backup.
+func restoreTaskFor(backupTask api_v1beta1.TaskRef) api_v1beta1.TaskRef {
+	if backupTask.Name == "" {
+		return api_v1beta1.TaskRef{}
+	}
+	return api_v1beta1.TaskRef{
+		Name: strings.Replace(backupTask.Name, "-backup", "-restore", 1),
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+)
+
+func TestSnapshotRulesForTarget(t *testing.T) {
+	succeeded := func(host string, snapshots ...string) api_v1beta1.HostBackupStats {
+		stats := api_v1beta1.HostBackupStats{Hostname: host, Phase: api_v1beta1.HostBackupSucceeded}
+		for _, s := range snapshots {
+			stats.Snapshots = append(stats.Snapshots, api_v1beta1.SnapshotStats{Name: s})
+		}
+		return stats
+	}
+
+	testCases := []struct {
+		description string
+		stats       []api_v1beta1.HostBackupStats
+		expected    []api_v1beta1.Rule
+	}{
+		{
+			description: "single host matches any target host",
+			stats:       []api_v1beta1.HostBackupStats{succeeded("host-0", "snap-1", "snap-2")},
+			expected: []api_v1beta1.Rule{
+				{SourceHost: "host-0", Snapshots: []string{"snap-1", "snap-2"}},
+			},
+		},
+		{
+			description: "multiple hosts are restored into themselves",
+			stats:       []api_v1beta1.HostBackupStats{succeeded("pod-0", "snap-a"), succeeded("pod-1", "snap-b")},
+			expected: []api_v1beta1.Rule{
+				{TargetHosts: []string{"pod-0"}, SourceHost: "pod-0", Snapshots: []string{"snap-a"}},
+				{TargetHosts: []string{"pod-1"}, SourceHost: "pod-1", Snapshots: []string{"snap-b"}},
+			},
+		},
+		{
+			description: "failed host and host without snapshots are skipped",
+			stats: []api_v1beta1.HostBackupStats{
+				succeeded("pod-0", "snap-a"),
+				{Hostname: "pod-1", Phase: api_v1beta1.HostBackupFailed, Snapshots: []api_v1beta1.SnapshotStats{{Name: "snap-b"}}},
+				succeeded("pod-2"),
+			},
+			expected: []api_v1beta1.Rule{
+				{TargetHosts: []string{"pod-0"}, SourceHost: "pod-0", Snapshots: []string{"snap-a"}},
+			},
+		},
+		{
+			description: "no host",
+			stats:       nil,
+			expected:    nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			rules := snapshotRulesForTarget(api_v1beta1.BackupTargetStatus{Stats: tc.stats})
+			if !reflect.DeepEqual(rules, tc.expected) {
+				t.Errorf("expected rules %+v, found %+v", tc.expected, rules)
+			}
+		})
+	}
+}
+
+func TestBackupTargetAlias(t *testing.T) {
+	template := &api_v1beta1.BackupConfigurationTemplateSpec{
+		Target: &api_v1beta1.BackupTarget{Alias: "mysql"},
+	}
+
+	testCases := []struct {
+		description string
+		template    *api_v1beta1.BackupConfigurationTemplateSpec
+		hosts       []string
+		expected    string
+	}{
+		{description: "alias of the backup template", template: template, hosts: []string{"other"}, expected: "mysql"},
+		{description: "hostname of a single host target", hosts: []string{"mysql"}, expected: "mysql"},
+		{description: "default host", hosts: []string{apis.DefaultHost}, expected: ""},
+		{description: "multiple hosts", hosts: []string{"pod-0", "pod-1"}, expected: ""},
+		{description: "no host", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var targetStatus api_v1beta1.BackupTargetStatus
+			for _, h := range tc.hosts {
+				targetStatus.Stats = append(targetStatus.Stats, api_v1beta1.HostBackupStats{Hostname: h})
+			}
+			if alias := backupTargetAlias(tc.template, targetStatus); alias != tc.expected {
+				t.Errorf("expected alias %q, found %q", tc.expected, alias)
+			}
+		})
+	}
+}
+
+func TestRestoreTaskFor(t *testing.T) {
+	testCases := []struct {
+		description string
+		backupTask  api_v1beta1.TaskRef
+		expected    api_v1beta1.TaskRef
+	}{
+		{
+			description: "versioned task",
+			backupTask:  api_v1beta1.TaskRef{Name: "mysql-backup-8.0.21"},
+			expected:    api_v1beta1.TaskRef{Name: "mysql-restore-8.0.21"},
+		},
+		{
+			description: "params are dropped",
+			backupTask:  api_v1beta1.TaskRef{Name: "pvc-backup", Params: []api_v1beta1.Param{{Name: "args", Value: "--one-file-system"}}},
+			expected:    api_v1beta1.TaskRef{Name: "pvc-restore"},
+		},
+		{
+			description: "only the first occurrence is replaced",
+			backupTask:  api_v1beta1.TaskRef{Name: "etcd-backup-backup-3.5"},
+			expected:    api_v1beta1.TaskRef{Name: "etcd-restore-backup-3.5"},
+		},
+		{
+			description: "empty task is resolved from the AppBinding",
+			backupTask:  api_v1beta1.TaskRef{},
+			expected:    api_v1beta1.TaskRef{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if task := restoreTaskFor(tc.backupTask); !reflect.DeepEqual(task, tc.expected) {
+				t.Errorf("expected task %+v, found %+v", tc.expected, task)
+			}
+		})
+	}
+}
@@ -101,7 +101,8 @@ func FindRestoreSession(lister v1beta1_listers.RestoreSessionLister, targetRef v
 	result := make([]unstructured.Unstructured, 0)
 	// keep only those RestoreSession that has this workload as target
 	for _, rs := range restoreSessions {
-		if rs.DeletionTimestamp == nil &&
+		// a dry run RestoreSession does not restore anything into the workload
+		if rs.DeletionTimestamp == nil && !rs.Spec.DryRun &&
 			IsRestoreTarget(rs.Spec.Target, targetRef, rs.Namespace) &&
 			rs.Spec.Driver == v1beta1_api.ResticSnapshotter {
 			rs.GetObjectKind().SetGroupVersionKind(v1beta1_api.SchemeGroupVersion.WithKind(v1beta1_api.ResourceKindRestoreSession))
@@ -0,0 +1,181 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1alpha1 "stash.appscode.dev/apimachinery/apis/stash/v1alpha1"
+	v1beta1_api "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+	"stash.appscode.dev/apimachinery/pkg/restic"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RestoreHostsForTarget returns the hostnames that will restore the target. They are resolved the same way
+// as GetHostName resolves the hostname inside the restore container, but without touching the workload.
+func RestoreHostsForTarget(kubeClient kubernetes.Interface, invNamespace string, target *v1beta1_api.RestoreTarget) ([]string, error) {
+	if target == nil {
+		return []string{apis.DefaultHost}, nil
+	}
+	withAlias := func(suffix string) string {
+		if target.Alias != "" {
+			return fmt.Sprintf("%s-%s", target.Alias, suffix)
+		}
+		return suffix
+	}
+	ordinalHosts := func(replicas int32) []string {
+		hosts := make([]string, 0, replicas)
+		for i := int32(0); i < replicas; i++ {
+			if target.Alias != "" {
+				hosts = append(hosts, fmt.Sprintf("%s-%d", target.Alias, i))
+			} else {
+				hosts = append(hosts, fmt.Sprintf("host-%d", i))
+			}
+		}
+		return hosts
+	}
+
+	// restore is done via job when volumeClaimTemplate is specified
+	if len(target.VolumeClaimTemplates) != 0 {
+		if target.Replicas != nil {
+			return ordinalHosts(*target.Replicas), nil
+		}
+		if target.Alias != "" {
+			return []string{target.Alias}, nil
+		}
+		return []string{apis.DefaultHost}, nil
+	}
+
+	namespace := getTargetNamespace(target.Ref, invNamespace)
+	if a, ok := GetWorkloadAdapter(target.Ref.APIVersion, target.Ref.Kind); ok && a.HostModel == WorkloadHostModelOrdinal {
+		// the workloads registered through an adapter are not known to the typed client. so, the number of
+		// replicas must be provided in the restore target.
+		if target.Replicas != nil {
+			return ordinalHosts(*target.Replicas), nil
+		}
+		return nil, fmt.Errorf("'target.replicas' must be specified to resolve the hosts of %s %s/%s", target.Ref.Kind, namespace, target.Ref.Name)
+	}
+	switch target.Ref.Kind {
+	case apis.KindStatefulSet:
+		if target.Replicas != nil {
+			return ordinalHosts(*target.Replicas), nil
+		}
+		ss, err := kubeClient.AppsV1().StatefulSets(namespace).Get(context.TODO(), target.Ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		replicas := int32(1)
+		if ss.Spec.Replicas != nil {
+			replicas = *ss.Spec.Replicas
+		}
+		return ordinalHosts(replicas), nil
+	case apis.KindDaemonSet:
+		// for DaemonSet, the hostnames are the names of the nodes where its pods are running
+		dmn, err := kubeClient.AppsV1().DaemonSets(namespace).Get(context.TODO(), target.Ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector, err := metav1.LabelSelectorAsSelector(dmn.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		pods, err := kubeClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		nodes := sets.New[string]()
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName != "" && metav1.IsControlledBy(&pod, dmn) {
+				nodes.Insert(pod.Spec.NodeName)
+			}
+		}
+		hosts := make([]string, 0, nodes.Len())
+		for _, node := range sets.List(nodes) {
+			hosts = append(hosts, withAlias(node))
+		}
+		return hosts, nil
+	default:
+		if target.Alias != "" {
+			return []string{target.Alias}, nil
+		}
+		return []string{apis.DefaultHost}, nil
+	}
+}
+
+// PlanRestore resolves what each host of the restore invoker would restore from the Repository.
+// The data is only read from the Repository. Nothing is written into the target.
+func PlanRestore(kubeClient kubernetes.Interface, invNamespace string, repository *api_v1alpha1.Repository, driver v1beta1_api.Snapshotter, target *v1beta1_api.RestoreTarget) ([]v1beta1_api.HostRestorePlan, error) {
+	if driver == v1beta1_api.VolumeSnapshotter {
+		return nil, fmt.Errorf("restore plan is not supported for the %s driver", driver)
+	}
+	if target == nil {
+		return nil, fmt.Errorf("restore plan requires a target")
+	}
+	hosts, err := RestoreHostsForTarget(kubeClient, invNamespace, target)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(repository.Namespace).Get(context.TODO(), repository.Spec.Backend.StorageSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	scratchDir, err := os.MkdirTemp("", "stash-restore-plan")
+	if err != nil {
+		return nil, err
+	}
+	defer RemoveDirWithLogErr(scratchDir)
+
+	w, err := newPlanWrapper(repository, secret, scratchDir)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]v1beta1_api.HostRestorePlan, 0, len(hosts))
+	for _, host := range hosts {
+		restoreOptions, err := RestoreOptionsForTarget(host, target)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := w.PlanRestore(restoreOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan the restore of host %s: %w", host, err)
+		}
+		// a host that does not match any rule has nothing to restore, but it is kept in the plan
+		plan.Hostname = host
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func newPlanWrapper(repository *api_v1alpha1.Repository, secret *core.Secret, scratchDir string) (*restic.ResticWrapper, error) {
+	setupOpt, err := SetupOptionsForRepository(*repository, ExtraOptions{
+		StorageSecret: secret,
+		ScratchDir:    scratchDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restic.NewResticWrapper(setupOpt)
+}
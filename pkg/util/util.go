@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"stash.appscode.dev/apimachinery/apis"
@@ -102,13 +103,14 @@ func GetHostName(target any) (string, error) {
 	}
 
 	// backup/restore is running through sidecar/init-container. identify hostname for them.
-	switch targetRef.Kind {
-	case apis.KindStatefulSet:
+	switch {
+	case IsOrdinalHostWorkload(targetRef.APIVersion, targetRef.Kind):
 		// for StatefulSet, host name is 'host-<pod ordinal>'. stash operator set pod's name as 'POD_NAME' env
 		// in the sidecar/init-container through downward api. we have to parse the pod name to get ordinal.
+		// the workloads registered through an adapter with "Ordinal" host model are handled the same way.
 		podName := meta_util.PodName()
 		if podName == "" {
-			return "", fmt.Errorf("missing 'POD_NAME' env in StatefulSet: %s", apis.KindStatefulSet)
+			return "", fmt.Errorf("missing 'POD_NAME' env in %s: %s", targetRef.Kind, targetRef.Name)
 		}
 		podInfo := strings.Split(podName, "-")
 		podOrdinal := podInfo[len(podInfo)-1]
@@ -116,7 +118,7 @@ func GetHostName(target any) (string, error) {
 			return fmt.Sprintf("%s-%s", alias, podOrdinal), nil
 		}
 		return "host-" + podOrdinal, nil
-	case apis.KindDaemonSet:
+	case targetRef.Kind == apis.KindDaemonSet:
 		// for DaemonSet, host name is the node name. stash operator set the respective node name as 'NODE_NAME' env
 		// in the sidecar/init-container through downward api.
 		nodeName := os.Getenv(apis.KeyNodeName)
@@ -135,22 +137,75 @@ func GetHostName(target any) (string, error) {
 	}
 }
 
-func BackupModel(kind, taskName string) string {
-	if taskName == "" && isWorkload(kind) {
+// SourceHostForHost returns the name of the host whose backed up data will be restored into the given host of the target.
+// It is the host itself unless the target specifies a source. In that case, the host is mapped into the respective host
+// of the source workload, i.e. a replica of a StatefulSet restores the data of the replica with the same ordinal.
+func SourceHostForHost(target *api_v1beta1.RestoreTarget, hostname string) (string, error) {
+	if target == nil || target.Source == nil {
+		return hostname, nil
+	}
+
+	source := target.Source
+	switch {
+	case IsOrdinalHostWorkload(source.APIVersion, source.Kind):
+		ordinal := int32(0)
+		if source.Ordinal != nil {
+			ordinal = *source.Ordinal
+		}
+		if hasOrdinalHosts(target) {
+			// the hosts of the target are '<alias>-<ordinal>' or 'host-<ordinal>'
+			idx := strings.LastIndex(hostname, "-")
+			n, err := strconv.ParseInt(hostname[idx+1:], 10, 32)
+			if idx < 0 || err != nil {
+				return "", fmt.Errorf("failed to parse the pod ordinal from host %q", hostname)
+			}
+			ordinal = int32(n)
+		}
+		if source.Alias != "" {
+			return fmt.Sprintf("%s-%d", source.Alias, ordinal), nil
+		}
+		return fmt.Sprintf("host-%d", ordinal), nil
+	case source.Kind == apis.KindDaemonSet:
+		// the hosts of a DaemonSet are the nodes. they can't be mapped into the hosts of another workload.
+		return "", fmt.Errorf("restoring the backup of a %s into a different workload is not supported. Use the sourceHost field of the rules instead", source.Kind)
+	default:
+		if source.Alias != "" {
+			return source.Alias, nil
+		}
+		return apis.DefaultHost, nil
+	}
+}
+
+// hasOrdinalHosts checks whether each replica of the target is a separate host suffixed with its pod ordinal
+func hasOrdinalHosts(target *api_v1beta1.RestoreTarget) bool {
+	if len(target.VolumeClaimTemplates) != 0 {
+		return target.Replicas != nil
+	}
+	return IsOrdinalHostWorkload(target.Ref.APIVersion, target.Ref.Kind)
+}
+
+func BackupModel(apiVersion, kind, taskName string) string {
+	if taskName == "" && isWorkload(apiVersion, kind) {
 		return apis.ModelSidecar
 	}
 	return apis.ModelCronJob
 }
 
-func isWorkload(kind string) bool {
+func isWorkload(apiVersion, kind string) bool {
 	return kind == apis.KindDeployment ||
 		kind == apis.KindStatefulSet ||
 		kind == apis.KindDaemonSet ||
-		kind == apis.KindDeploymentConfig
+		kind == apis.KindDeploymentConfig ||
+		isAdaptedWorkload(apiVersion, kind)
+}
+
+func isAdaptedWorkload(apiVersion, kind string) bool {
+	_, ok := GetWorkloadAdapter(apiVersion, kind)
+	return ok
 }
 
-func RestoreModel(kind, taskName string) string {
-	return BackupModel(kind, taskName)
+func RestoreModel(apiVersion, kind, taskName string) string {
+	return BackupModel(apiVersion, kind, taskName)
 }
 
 func GetRepoNameAndSnapshotID(snapshotName string) (repoName, snapshotId string, err error) {
@@ -253,30 +308,51 @@ func IsTargetExist(config *rest.Config, target api_v1beta1.TargetRef) (bool, err
 		return true, nil
 	}
 
-	mapping, err := getRESTMapping(config, target)
+	ri, err := getTargetResourceInterface(config, target)
 	if err != nil {
 		return false, err
 	}
 
-	di, err := dynamic.NewForConfig(config)
+	_, err = ri.Get(context.TODO(), target.Name, metav1.GetOptions{})
 	if err != nil {
+		if kerr.IsNotFound(err) {
+			return false, nil
+		}
 		return false, err
 	}
+	return true, nil
+}
+
+// GetTargetLabels returns the labels of the target object.
+func GetTargetLabels(config *rest.Config, target api_v1beta1.TargetRef) (map[string]string, error) {
+	ri, err := getTargetResourceInterface(config, target)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ri.Get(context.TODO(), target.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return obj.GetLabels(), nil
+}
+
+func getTargetResourceInterface(config *rest.Config, target api_v1beta1.TargetRef) (dynamic.ResourceInterface, error) {
+	mapping, err := getRESTMapping(config, target)
+	if err != nil {
+		return nil, err
+	}
+
+	di, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
 
 	var ri dynamic.ResourceInterface
 	ri = di.Resource(mapping.Resource)
 	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
 		ri = di.Resource(mapping.Resource).Namespace(target.Namespace)
 	}
-
-	_, err = ri.Get(context.TODO(), target.Name, metav1.GetOptions{})
-	if err != nil {
-		if kerr.IsNotFound(err) {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
+	return ri, nil
 }
 
 func getRESTMapping(config *rest.Config, target api_v1beta1.TargetRef) (*meta.RESTMapping, error) {
@@ -444,6 +520,9 @@ func OwnerWorkload(w *wapi.Workload) (*metav1.OwnerReference, error) {
 	case apis.KindDeploymentConfig:
 		return metav1.NewControllerRef(w, ocapps.GroupVersion.WithKind(w.Kind)), nil
 	default:
+		if a, ok := GetWorkloadAdapter(w.APIVersion, w.Kind); ok {
+			return metav1.NewControllerRef(w, a.GroupVersionKind), nil
+		}
 		return nil, fmt.Errorf("failed to set workload as owner. Reason: unknown workload kind")
 	}
 }
@@ -0,0 +1,135 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"stash.appscode.dev/apimachinery/apis"
+	api_v1beta1 "stash.appscode.dev/apimachinery/apis/stash/v1beta1"
+
+	"k8s.io/utils/ptr"
+	ofst "kmodules.xyz/offshoot-api/api/v1"
+)
+
+func TestSourceHostForHost(t *testing.T) {
+	statefulSet := api_v1beta1.TargetRef{Kind: apis.KindStatefulSet, Name: "db"}
+	deployment := api_v1beta1.TargetRef{Kind: apis.KindDeployment, Name: "app"}
+
+	testCases := []struct {
+		description string
+		target      *api_v1beta1.RestoreTarget
+		hostname    string
+		expected    string
+		expectErr   bool
+	}{
+		{
+			description: "no target",
+			target:      nil,
+			hostname:    "host-0",
+			expected:    "host-0",
+		},
+		{
+			description: "no source",
+			target:      &api_v1beta1.RestoreTarget{Ref: statefulSet},
+			hostname:    "host-1",
+			expected:    "host-1",
+		},
+		{
+			description: "replica restores the replica with the same ordinal",
+			target:      &api_v1beta1.RestoreTarget{Ref: statefulSet, Source: &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet, Alias: "old-db"}},
+			hostname:    "new-db-2",
+			expected:    "old-db-2",
+		},
+		{
+			description: "replica of a source without alias",
+			target:      &api_v1beta1.RestoreTarget{Ref: statefulSet, Source: &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet}},
+			hostname:    "host-1",
+			expected:    "host-1",
+		},
+		{
+			description: "ordinal of the target host wins over the source ordinal",
+			target:      &api_v1beta1.RestoreTarget{Ref: statefulSet, Source: &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet, Ordinal: ptr.To[int32](3)}},
+			hostname:    "host-1",
+			expected:    "host-1",
+		},
+		{
+			description: "single host target restores the specified ordinal",
+			target:      &api_v1beta1.RestoreTarget{Ref: deployment, Source: &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet, Alias: "db", Ordinal: ptr.To[int32](3)}},
+			hostname:    "app",
+			expected:    "db-3",
+		},
+		{
+			description: "single host target restores ordinal 0 by default",
+			target:      &api_v1beta1.RestoreTarget{Ref: deployment, Source: &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet}},
+			hostname:    apis.DefaultHost,
+			expected:    "host-0",
+		},
+		{
+			description: "replicas of volumeClaimTemplates restore the same ordinal",
+			target: &api_v1beta1.RestoreTarget{
+				Replicas:             ptr.To[int32](3),
+				VolumeClaimTemplates: []ofst.PersistentVolumeClaim{{}},
+				Source:               &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet, Alias: "db"},
+			},
+			hostname: "host-2",
+			expected: "db-2",
+		},
+		{
+			description: "host without ordinal",
+			target:      &api_v1beta1.RestoreTarget{Ref: statefulSet, Source: &api_v1beta1.RestoreSource{Kind: apis.KindStatefulSet}},
+			hostname:    "db",
+			expectErr:   true,
+		},
+		{
+			description: "DaemonSet source",
+			target:      &api_v1beta1.RestoreTarget{Ref: deployment, Source: &api_v1beta1.RestoreSource{Kind: apis.KindDaemonSet}},
+			hostname:    "app",
+			expectErr:   true,
+		},
+		{
+			description: "single host source with alias",
+			target:      &api_v1beta1.RestoreTarget{Ref: deployment, Source: &api_v1beta1.RestoreSource{Kind: apis.KindDeployment, Alias: "web"}},
+			hostname:    "app",
+			expected:    "web",
+		},
+		{
+			description: "single host source without alias",
+			target:      &api_v1beta1.RestoreTarget{Ref: deployment, Source: &api_v1beta1.RestoreSource{Kind: apis.KindDeployment}},
+			hostname:    "app",
+			expected:    apis.DefaultHost,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			host, err := SourceHostForHost(tc.target, tc.hostname)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, found host %q", host)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if host != tc.expected {
+				t.Errorf("expected source host %q, found %q", tc.expected, host)
+			}
+		})
+	}
+}
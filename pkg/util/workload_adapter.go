@@ -0,0 +1,338 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"stash.appscode.dev/apimachinery/apis"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	wapi "kmodules.xyz/webhook-runtime/apis/workload/v1"
+	wcs "kmodules.xyz/webhook-runtime/client/workload/v1"
+)
+
+// WorkloadHostModel specifies which replicas of a workload take backup and restore.
+type WorkloadHostModel string
+
+const (
+	// WorkloadHostModelSingle means only one replica takes backup as a single host, like the replicas of a Deployment.
+	WorkloadHostModelSingle WorkloadHostModel = "Single"
+	// WorkloadHostModelOrdinal means every replica takes backup as a separate host, like the replicas of a StatefulSet.
+	// The hosts are named after the ordinal suffix of the pod names.
+	WorkloadHostModelOrdinal WorkloadHostModel = "Ordinal"
+)
+
+// WorkloadAdapter lets Stash inject its sidecar and init-container into a resource that is not one of the
+// built-in workloads but owns a long running pod template, i.e. an Argo Rollout or a custom resource.
+// Jobs and CronJobs are out of scope. They can't be registered for either backup or restore. For any other
+// resource whose pods run to completion, the backup sidecar is rejected, as it never exits and would keep the
+// pods from completing. Back them up with a backup Task instead.
+type WorkloadAdapter struct {
+	GroupVersionKind schema.GroupVersionKind
+	// Resource is the plural name of the resource
+	Resource string
+	// TemplatePath is the JSONPath of the pod template, i.e. "{.spec.template}"
+	TemplatePath string
+	// ReplicasPath is the JSONPath of the number of replicas, i.e. "{.spec.replicas}".
+	// The resource has a single replica when it is empty.
+	ReplicasPath string
+	HostModel    WorkloadHostModel
+}
+
+var (
+	workloadAdapterLock sync.RWMutex
+	workloadAdapters    = map[schema.GroupKind]WorkloadAdapter{}
+)
+
+// ParseWorkloadAdapter parses a workload adapter given in the following format:
+// "kind=<Kind>.<version>.<group>;resource=<plural>;template=<JSONPath>[;replicas=<JSONPath>][;hosts=Single|Ordinal]"
+// i.e. "kind=Rollout.v1alpha1.argoproj.io;resource=rollouts;template={.spec.template};replicas={.spec.replicas}"
+func ParseWorkloadAdapter(value string) (WorkloadAdapter, error) {
+	a := WorkloadAdapter{
+		HostModel: WorkloadHostModelSingle,
+	}
+	for _, field := range strings.Split(value, ";") {
+		key, val, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return a, fmt.Errorf("invalid field %q in workload adapter %q", field, value)
+		}
+		switch key {
+		case "kind":
+			gvk, _ := schema.ParseKindArg(val)
+			if gvk == nil {
+				return a, fmt.Errorf("invalid kind %q in workload adapter %q. Use <Kind>.<version>.<group> format", val, value)
+			}
+			a.GroupVersionKind = *gvk
+		case "resource":
+			a.Resource = val
+		case "template":
+			a.TemplatePath = val
+		case "replicas":
+			a.ReplicasPath = val
+		case "hosts":
+			a.HostModel = WorkloadHostModel(val)
+		default:
+			return a, fmt.Errorf("unknown field %q in workload adapter %q", key, value)
+		}
+	}
+	return a, a.validate()
+}
+
+// String returns the workload adapter in the format accepted by ParseWorkloadAdapter
+func (a WorkloadAdapter) String() string {
+	fields := []string{
+		"kind=" + a.GroupVersionKind.Kind + "." + a.GroupVersionKind.Version + "." + a.GroupVersionKind.Group,
+		"resource=" + a.Resource,
+		"template=" + a.TemplatePath,
+	}
+	if a.ReplicasPath != "" {
+		fields = append(fields, "replicas="+a.ReplicasPath)
+	}
+	if a.HostModel != "" {
+		fields = append(fields, "hosts="+string(a.HostModel))
+	}
+	return strings.Join(fields, ";")
+}
+
+func (a WorkloadAdapter) validate() error {
+	if a.GroupVersionKind.Kind == "" || a.GroupVersionKind.Version == "" {
+		return fmt.Errorf("kind of the workload adapter is not specified")
+	}
+	if isBuiltinWorkload(a.GroupVersionKind.Kind) {
+		return fmt.Errorf("%s is a built-in workload. It can't be registered as a workload adapter", a.GroupVersionKind.Kind)
+	}
+	if isRunToCompletionWorkload(a.GroupVersionKind.GroupKind()) {
+		return fmt.Errorf("the pods of %s run to completion. Workload adapters do not support them for backup or restore. Use a backup Task instead", a.GroupVersionKind.Kind)
+	}
+	if a.Resource == "" {
+		return fmt.Errorf("resource of the workload adapter for %s is not specified", a.GroupVersionKind.Kind)
+	}
+	if _, err := jsonPathFields(a.TemplatePath); err != nil {
+		return fmt.Errorf("invalid template path of the workload adapter for %s. Reason: %w", a.GroupVersionKind.Kind, err)
+	}
+	if a.ReplicasPath != "" {
+		if _, err := jsonPathFields(a.ReplicasPath); err != nil {
+			return fmt.Errorf("invalid replicas path of the workload adapter for %s. Reason: %w", a.GroupVersionKind.Kind, err)
+		}
+	}
+	if a.HostModel != WorkloadHostModelSingle && a.HostModel != WorkloadHostModelOrdinal {
+		return fmt.Errorf("host model of the workload adapter for %s must be either %q or %q", a.GroupVersionKind.Kind, WorkloadHostModelSingle, WorkloadHostModelOrdinal)
+	}
+	return nil
+}
+
+// GroupVersionResource returns the resource that the workload adapter watches
+func (a WorkloadAdapter) GroupVersionResource() schema.GroupVersionResource {
+	return a.GroupVersionKind.GroupVersion().WithResource(a.Resource)
+}
+
+// RegisterWorkloadAdapter registers a workload adapter. The resources of its kind can then be used as backup and restore targets.
+func RegisterWorkloadAdapter(a WorkloadAdapter) error {
+	if a.HostModel == "" {
+		a.HostModel = WorkloadHostModelSingle
+	}
+	if err := a.validate(); err != nil {
+		return err
+	}
+	workloadAdapterLock.Lock()
+	defer workloadAdapterLock.Unlock()
+	workloadAdapters[a.GroupVersionKind.GroupKind()] = a
+	return nil
+}
+
+// GetWorkloadAdapter returns the workload adapter registered for the group of the apiVersion and the kind.
+// The version does not matter as the adapter handles all the served versions of the resource.
+func GetWorkloadAdapter(apiVersion, kind string) (WorkloadAdapter, bool) {
+	workloadAdapterLock.RLock()
+	defer workloadAdapterLock.RUnlock()
+	a, ok := workloadAdapters[schema.FromAPIVersionAndKind(apiVersion, kind).GroupKind()]
+	return a, ok
+}
+
+// WorkloadAdapters returns the registered workload adapters sorted by their kind and group
+func WorkloadAdapters() []WorkloadAdapter {
+	workloadAdapterLock.RLock()
+	defer workloadAdapterLock.RUnlock()
+	adapters := make([]WorkloadAdapter, 0, len(workloadAdapters))
+	for _, a := range workloadAdapters {
+		adapters = append(adapters, a)
+	}
+	sort.Slice(adapters, func(i, j int) bool {
+		if adapters[i].GroupVersionKind.Kind != adapters[j].GroupVersionKind.Kind {
+			return adapters[i].GroupVersionKind.Kind < adapters[j].GroupVersionKind.Kind
+		}
+		return adapters[i].GroupVersionKind.Group < adapters[j].GroupVersionKind.Group
+	})
+	return adapters
+}
+
+// NewWorkload converts the resource into the generic Workload type. The pod template is read from the TemplatePath.
+func (a WorkloadAdapter) NewWorkload(obj *unstructured.Unstructured) (*wapi.Workload, error) {
+	w := &wapi.Workload{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+		},
+		Object: obj,
+	}
+	if md, ok := obj.Object["metadata"].(map[string]any); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(md, &w.ObjectMeta); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := jsonPathFields(a.TemplatePath)
+	if err != nil {
+		return nil, err
+	}
+	template, found, err := unstructured.NestedMap(obj.Object, fields...)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s %s/%s does not have any pod template at %s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), a.TemplatePath)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(template, &w.Spec.Template); err != nil {
+		return nil, err
+	}
+
+	replicas, err := a.Replicas(obj)
+	if err != nil {
+		return nil, err
+	}
+	w.Spec.Replicas = &replicas
+	return w, nil
+}
+
+// ApplyWorkload writes the pod template and the annotations of the generic Workload back into the resource
+func (a WorkloadAdapter) ApplyWorkload(w *wapi.Workload) error {
+	obj, ok := w.Object.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("workload adapter for %s can't apply changes into %T", a.GroupVersionKind.Kind, w.Object)
+	}
+	fields, err := jsonPathFields(a.TemplatePath)
+	if err != nil {
+		return err
+	}
+	template, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&w.Spec.Template)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedMap(obj.Object, template, fields...); err != nil {
+		return err
+	}
+	obj.SetAnnotations(w.Annotations)
+	return nil
+}
+
+// Replicas returns the number of replicas of the resource read from the ReplicasPath
+func (a WorkloadAdapter) Replicas(obj *unstructured.Unstructured) (int32, error) {
+	if a.ReplicasPath == "" {
+		return 1, nil
+	}
+	fields, err := jsonPathFields(a.ReplicasPath)
+	if err != nil {
+		return 0, err
+	}
+	replicas, found, err := unstructured.NestedInt64(obj.Object, fields...)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		// same as the built-in workloads, the number of replicas defaults to 1
+		return 1, nil
+	}
+	return int32(replicas), nil
+}
+
+// jsonPathFields returns the fields of a simple JSONPath like "{.spec.template}".
+// The pod template must be reachable through the fields of nested objects. So, array indexes and filters are not supported.
+func jsonPathFields(path string) ([]string, error) {
+	p := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(path), "{"), "}")
+	if !strings.HasPrefix(p, ".") || len(p) < 2 {
+		return nil, fmt.Errorf("invalid JSONPath %q. Use the format {.spec.template}", path)
+	}
+	fields := strings.Split(p[1:], ".")
+	for _, f := range fields {
+		if f == "" || strings.ContainsAny(f, "[]*@?()") {
+			return nil, fmt.Errorf("invalid JSONPath %q. Only the fields of nested objects are supported", path)
+		}
+	}
+	return fields, nil
+}
+
+func isBuiltinWorkload(kind string) bool {
+	return kind == apis.KindDeployment ||
+		kind == apis.KindStatefulSet ||
+		kind == apis.KindDaemonSet ||
+		kind == apis.KindDeploymentConfig
+}
+
+func isRunToCompletionWorkload(gk schema.GroupKind) bool {
+	return gk == batchv1.SchemeGroupVersion.WithKind(apis.KindJob).GroupKind() ||
+		gk == batchv1.SchemeGroupVersion.WithKind(apis.KindCronJob).GroupKind()
+}
+
+// IsSingleHostWorkload checks whether only one replica of the workload takes backup, chosen by leader election
+func IsSingleHostWorkload(apiVersion, kind string) bool {
+	if kind == apis.KindDeployment || kind == apis.KindDeploymentConfig {
+		return true
+	}
+	a, ok := GetWorkloadAdapter(apiVersion, kind)
+	return ok && a.HostModel == WorkloadHostModelSingle
+}
+
+// IsOrdinalHostWorkload checks whether every replica of the workload is a separate host named after its pod ordinal
+func IsOrdinalHostWorkload(apiVersion, kind string) bool {
+	if kind == apis.KindStatefulSet {
+		return true
+	}
+	a, ok := GetWorkloadAdapter(apiVersion, kind)
+	return ok && a.HostModel == WorkloadHostModelOrdinal
+}
+
+// ConvertToWorkload converts a built-in workload or a resource with a registered workload adapter into the generic Workload type
+func ConvertToWorkload(obj runtime.Object) (*wapi.Workload, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		a, found := GetWorkloadAdapter(u.GetAPIVersion(), u.GetKind())
+		if !found {
+			return nil, fmt.Errorf("no workload adapter is registered for %s", u.GetKind())
+		}
+		return a.NewWorkload(u)
+	}
+	return wcs.ConvertToWorkload(obj)
+}
+
+// ApplyWorkload applies the changes of the generic Workload into its original object
+func ApplyWorkload(w *wapi.Workload) error {
+	if _, ok := w.Object.(*unstructured.Unstructured); ok {
+		a, found := GetWorkloadAdapter(w.APIVersion, w.Kind)
+		if !found {
+			return fmt.Errorf("no workload adapter is registered for %s", w.Kind)
+		}
+		return a.ApplyWorkload(w)
+	}
+	return wcs.ApplyWorkload(w.Object, w)
+}
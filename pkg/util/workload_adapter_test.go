@@ -0,0 +1,280 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseWorkloadAdapter(t *testing.T) {
+	rollout := schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+
+	testCases := []struct {
+		description string
+		value       string
+		expected    WorkloadAdapter
+		expectErr   bool
+	}{
+		{
+			description: "all fields",
+			value:       "kind=Rollout.v1alpha1.argoproj.io;resource=rollouts;template={.spec.template};replicas={.spec.replicas};hosts=Ordinal",
+			expected: WorkloadAdapter{
+				GroupVersionKind: rollout,
+				Resource:         "rollouts",
+				TemplatePath:     "{.spec.template}",
+				ReplicasPath:     "{.spec.replicas}",
+				HostModel:        WorkloadHostModelOrdinal,
+			},
+		},
+		{
+			description: "single host by default",
+			value:       "kind=Rollout.v1alpha1.argoproj.io; resource=rollouts; template={.spec.template}",
+			expected: WorkloadAdapter{
+				GroupVersionKind: rollout,
+				Resource:         "rollouts",
+				TemplatePath:     "{.spec.template}",
+				HostModel:        WorkloadHostModelSingle,
+			},
+		},
+		{description: "kind without version", value: "kind=Rollout;resource=rollouts;template={.spec.template}", expectErr: true},
+		{description: "missing resource", value: "kind=Rollout.v1alpha1.argoproj.io;template={.spec.template}", expectErr: true},
+		{description: "missing template", value: "kind=Rollout.v1alpha1.argoproj.io;resource=rollouts", expectErr: true},
+		{description: "invalid replicas path", value: "kind=Rollout.v1alpha1.argoproj.io;resource=rollouts;template={.spec.template};replicas=spec.replicas", expectErr: true},
+		{description: "unknown host model", value: "kind=Rollout.v1alpha1.argoproj.io;resource=rollouts;template={.spec.template};hosts=All", expectErr: true},
+		{description: "unknown field", value: "kind=Rollout.v1alpha1.argoproj.io;resource=rollouts;template={.spec.template};scale=2", expectErr: true},
+		{description: "field without value", value: "kind=Rollout.v1alpha1.argoproj.io;rollouts;template={.spec.template}", expectErr: true},
+		{description: "built-in workload", value: "kind=Deployment.v1.apps;resource=deployments;template={.spec.template}", expectErr: true},
+		{description: "Job", value: "kind=Job.v1.batch;resource=jobs;template={.spec.template}", expectErr: true},
+		{description: "CronJob", value: "kind=CronJob.v1.batch;resource=cronjobs;template={.spec.jobTemplate.spec.template}", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			a, err := ParseWorkloadAdapter(tc.value)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, found adapter %+v", a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if !reflect.DeepEqual(a, tc.expected) {
+				t.Errorf("expected adapter %+v, found %+v", tc.expected, a)
+			}
+			// the adapter is passed to the sidecar and init-container in its string form
+			if parsed, err := ParseWorkloadAdapter(a.String()); err != nil || !reflect.DeepEqual(parsed, a) {
+				t.Errorf("expected %q to parse back into %+v, found %+v with error %v", a.String(), a, parsed, err)
+			}
+		})
+	}
+}
+
+func TestJSONPathFields(t *testing.T) {
+	testCases := []struct {
+		description string
+		path        string
+		expected    []string
+		expectErr   bool
+	}{
+		{description: "single field", path: "{.spec}", expected: []string{"spec"}},
+		{description: "nested fields", path: "{.spec.jobTemplate.spec.template}", expected: []string{"spec", "jobTemplate", "spec", "template"}},
+		{description: "without braces", path: ".spec.template", expected: []string{"spec", "template"}},
+		{description: "surrounding spaces", path: " {.spec.template} ", expected: []string{"spec", "template"}},
+		{description: "empty", path: "", expectErr: true},
+		{description: "root only", path: "{.}", expectErr: true},
+		{description: "without leading dot", path: "{spec.template}", expectErr: true},
+		{description: "empty field", path: "{.spec..template}", expectErr: true},
+		{description: "array index", path: "{.spec.templates[0]}", expectErr: true},
+		{description: "wildcard", path: "{.spec.*}", expectErr: true},
+		{description: "filter", path: "{.spec.containers[?(@.name=='app')]}", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			fields, err := jsonPathFields(tc.path)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, found fields %v", fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if !reflect.DeepEqual(fields, tc.expected) {
+				t.Errorf("expected fields %v, found %v", tc.expected, fields)
+			}
+		})
+	}
+}
+
+func TestNewAndApplyWorkload(t *testing.T) {
+	adapter := WorkloadAdapter{
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps.example.com", Version: "v1", Kind: "App"},
+		Resource:         "apps",
+		TemplatePath:     "{.spec.workload.template}",
+		ReplicasPath:     "{.spec.workload.size}",
+		HostModel:        WorkloadHostModelOrdinal,
+	}
+	newObject := func(workload map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apps.example.com/v1",
+			"kind":       "App",
+			"metadata": map[string]any{
+				"name":        "demo",
+				"namespace":   "default",
+				"annotations": map[string]any{"owner": "team-a"},
+			},
+			"spec": map[string]any{"workload": workload},
+		}}
+	}
+	template := map[string]any{
+		"metadata": map[string]any{"labels": map[string]any{"app": "demo"}},
+		"spec": map[string]any{
+			"containers": []any{map[string]any{"name": "app", "image": "demo:1.0"}},
+		},
+	}
+
+	testCases := []struct {
+		description      string
+		workload         map[string]any
+		expectedReplicas int32
+		expectErr        bool
+	}{
+		{description: "template and replicas", workload: map[string]any{"template": template, "size": int64(3)}, expectedReplicas: 3},
+		{description: "replicas default to 1", workload: map[string]any{"template": template}, expectedReplicas: 1},
+		{description: "missing template", workload: map[string]any{"size": int64(3)}, expectErr: true},
+		{description: "template is not an object", workload: map[string]any{"template": "demo"}, expectErr: true},
+		{description: "replicas is not a number", workload: map[string]any{"template": template, "size": "three"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			obj := newObject(tc.workload)
+			w, err := adapter.NewWorkload(obj)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, found workload %+v", w)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			if w.Name != "demo" || w.Namespace != "default" || w.Kind != "App" {
+				t.Errorf("expected the metadata of App default/demo, found %s %s/%s", w.Kind, w.Namespace, w.Name)
+			}
+			if w.Spec.Replicas == nil || *w.Spec.Replicas != tc.expectedReplicas {
+				t.Errorf("expected %d replicas, found %v", tc.expectedReplicas, w.Spec.Replicas)
+			}
+			if len(w.Spec.Template.Spec.Containers) != 1 || w.Spec.Template.Spec.Containers[0].Image != "demo:1.0" {
+				t.Fatalf("expected the container of the pod template, found %+v", w.Spec.Template.Spec.Containers)
+			}
+
+			// inject a container and an annotation, then write them back into the resource
+			w.Spec.Template.Spec.Containers = append(w.Spec.Template.Spec.Containers, core.Container{Name: "stash", Image: "stash:1.0"})
+			w.Annotations["stash"] = "applied"
+			if err := adapter.ApplyWorkload(w); err != nil {
+				t.Fatalf("expected no error, found %v", err)
+			}
+			containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workload", "template", "spec", "containers")
+			if len(containers) != 2 {
+				t.Errorf("expected 2 containers in the resource, found %d", len(containers))
+			}
+			if labels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "workload", "template", "metadata", "labels"); labels["app"] != "demo" {
+				t.Errorf("expected the labels of the pod template to be kept, found %v", labels)
+			}
+			if annotations := obj.GetAnnotations(); annotations["owner"] != "team-a" || annotations["stash"] != "applied" {
+				t.Errorf("expected the annotations to be applied, found %v", annotations)
+			}
+		})
+	}
+}
+
+func TestApplyWorkloadIntoTypedObject(t *testing.T) {
+	adapter := WorkloadAdapter{TemplatePath: "{.spec.template}"}
+	w, err := ConvertToWorkload(&core.ReplicationController{})
+	if err != nil {
+		t.Fatalf("expected no error, found %v", err)
+	}
+	if err := adapter.ApplyWorkload(w); err == nil {
+		t.Errorf("expected an error for a typed object")
+	}
+}
+
+func TestWorkloadAdaptersByGroupKind(t *testing.T) {
+	rollouts := WorkloadAdapter{
+		GroupVersionKind: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+		Resource:         "rollouts",
+		TemplatePath:     "{.spec.template}",
+		HostModel:        WorkloadHostModelSingle,
+	}
+	otherRollouts := WorkloadAdapter{
+		GroupVersionKind: schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Rollout"},
+		Resource:         "rollouts",
+		TemplatePath:     "{.spec.podTemplate}",
+		HostModel:        WorkloadHostModelOrdinal,
+	}
+	for _, a := range []WorkloadAdapter{rollouts, otherRollouts} {
+		if err := RegisterWorkloadAdapter(a); err != nil {
+			t.Fatalf("expected no error, found %v", err)
+		}
+		gk := a.GroupVersionKind.GroupKind()
+		t.Cleanup(func() {
+			workloadAdapterLock.Lock()
+			defer workloadAdapterLock.Unlock()
+			delete(workloadAdapters, gk)
+		})
+	}
+
+	testCases := []struct {
+		description string
+		apiVersion  string
+		expected    *WorkloadAdapter
+	}{
+		{description: "registered version", apiVersion: "argoproj.io/v1alpha1", expected: &rollouts},
+		{description: "other version of the same group", apiVersion: "argoproj.io/v1", expected: &rollouts},
+		{description: "same kind of another group", apiVersion: "example.com/v1", expected: &otherRollouts},
+		{description: "unregistered group", apiVersion: "apps/v1", expected: nil},
+		{description: "missing apiVersion", apiVersion: "", expected: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			a, ok := GetWorkloadAdapter(tc.apiVersion, "Rollout")
+			if tc.expected == nil {
+				if ok {
+					t.Errorf("expected no adapter, found %+v", a)
+				}
+				return
+			}
+			if !ok || !reflect.DeepEqual(a, *tc.expected) {
+				t.Errorf("expected adapter %+v, found %+v", *tc.expected, a)
+			}
+		})
+	}
+
+	if IsOrdinalHostWorkload("argoproj.io/v1alpha1", "Rollout") || !IsOrdinalHostWorkload("example.com/v1", "Rollout") {
+		t.Errorf("expected only the Rollout of example.com to have ordinal hosts")
+	}
+}